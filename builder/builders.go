@@ -1,14 +1,20 @@
 package builder
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/dorzheh/deployer/builder/image"
 	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	ssh "github.com/dorzheh/infra/comm/common"
 	"github.com/dorzheh/infra/comm/sshfs"
 )
@@ -26,44 +32,118 @@ type ImageBuilder struct {
 	Utils *image.Utils
 }
 
+// Id identifies the builder by the path to the image,
+// so that a builder is able to depend on the build of another image
+// (e.g. LocalImageBuilder(/var/lib/libvirt/images/va-data))
 func (b *ImageBuilder) Id() string {
-	if b.SshfsConfig == nil {
-		return "LocalImageBuilder"
+	kind := "LocalImageBuilder"
+	if b.SshfsConfig != nil {
+		kind = "RemoteImageBuilder"
 	}
-	return "RemoteImageBuilder"
+	return kind + "(" + imageName(b.ImageConfig) + ")"
+}
+
+func (b *ImageBuilder) Depends() []string {
+	return b.Dependencies
 }
 
+// Run builds the image.
+// The build is interrupted in case SIGHUP, SIGINT or SIGTERM signal received
 func (b *ImageBuilder) Run() (deployer.Artifact, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return b.RunContext(ctx)
+}
+
+// RunContext builds the image.
+// Once the context is done the running command is killed,
+// the image is released and the context error is returned.
+// If the cache is set, the image is copied from the cache instead of being built
+// once it is cached; otherwise the built image is stored to the cache.
+// The image is recorded by the transaction carried by the context (if any)
+func (b *ImageBuilder) RunContext(ctx context.Context) (deployer.Artifact, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r := progress.FromContext(ctx)
+	executor := b.executor()
+	key, err := b.Cache.Key(b.ImageConfig, b.Filler)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if key != "" {
+		path := image.ArtifactPath(b.ImageConfig)
+		r.Stage("cache", "lookup "+key)
+		cached, err := b.Cache.Lookup(ctx, executor, key, path)
+		if err != nil {
+			return nil, utils.FormatError(err)
+		}
+		if cached {
+			deployer.TransactionFromContext(ctx).RecordArtifact("remove image "+path, func() error {
+				if out, err := utils.Run(executor, "rm -f "+path); err != nil {
+					return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
+				}
+				return nil
+			})
+			b.ImageConfig.Path = path
+			return b.artifact(executor), nil
+		}
+	}
+
 	if err := os.MkdirAll(b.RootfsMp, 0755); err != nil {
 		return nil, utils.FormatError(err)
 	}
 
 	defer os.RemoveAll(b.RootfsMp)
 
+	if f, ok := b.Filler.(deployer.ProgressRootfsFiller); ok {
+		f.SetProgressReporter(r)
+	}
+
 	// create new image artifact
-	img, err := image.New(b.ImageConfig, b.RootfsMp, b.Utils, b.SshfsConfig)
+	finalPath := b.ImageConfig.Path
+	r.Stage("create", finalPath)
+	img, err := image.NewContext(ctx, b.ImageConfig, b.RootfsMp, b.Utils, b.SshfsConfig, executor)
 	if err != nil {
 		return nil, utils.FormatError(err)
 	}
-	// interrupt handler
-	img.ReleaseOnInterrupt()
+	// remove intermediate and final images on rollback
+	rawPath := b.ImageConfig.Path
+	deployer.TransactionFromContext(ctx).RecordArtifact("remove image "+finalPath, func() error {
+		if out, err := utils.Run(executor, "rm -f "+rawPath+" "+finalPath); err != nil {
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
+		}
+		return nil
+	})
 	defer func() {
 		img.Cleanup()
 	}()
+	img.SetProgressReporter(r)
 
 	// parse the image
 	if err := img.Parse(); err != nil {
 		return nil, utils.FormatError(err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// customize rootfs
 	if b.Filler != nil {
+		r.Stage("customize rootfs", "")
 		if err := b.Filler.CustomizeRootfs(b.RootfsMp); err != nil {
 			return nil, utils.FormatError(err)
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		// install application.
+		r.Stage("install application", "")
 		if err := b.Filler.InstallApp(b.RootfsMp); err != nil {
 			return nil, utils.FormatError(err)
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 	}
 	if b.ImageConfig.Bootable {
 		if err := img.MakeBootable(); err != nil {
@@ -71,20 +151,108 @@ func (b *ImageBuilder) Run() (deployer.Artifact, error) {
 		}
 	}
 	if b.Filler != nil {
+		r.Stage("hooks", "")
 		if err := b.Filler.RunHooks(b.RootfsMp); err != nil {
 			return nil, utils.FormatError(err)
 		}
 	}
+	r.Stage("cleanup", "")
 	if err := img.Cleanup(); err != nil {
 		return nil, utils.FormatError(err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if err := img.Convert(); err != nil {
 		return nil, utils.FormatError(err)
 	}
-	return &deployer.CommonArtifact{
-		Name: filepath.Base(b.ImageConfig.Path),
-		Path: b.ImageConfig.Path,
-		Type: deployer.ImageArtifact,
+	if key != "" {
+		// the image is built anyway, so failing to cache it doesn't fail the build
+		r.Stage("cache", "store "+key)
+		if err := b.Cache.Store(ctx, executor, key, b.ImageConfig.Path); err != nil {
+			r.Stage("cache", "storing the image failed: "+err.Error())
+		}
+	}
+	return b.artifact(executor), nil
+}
+
+// artifact returns the image artifact
+func (b *ImageBuilder) artifact(executor utils.Executor) *deployer.CommonArtifact {
+	a := &deployer.CommonArtifact{
+		Name:     filepath.Base(b.ImageConfig.Path),
+		Path:     b.ImageConfig.Path,
+		Type:     deployer.ImageArtifact,
+		Executor: executor,
+	}
+	if b.SshfsConfig != nil {
+		a.SshConfig = b.SshfsConfig.Common
+	}
+	return a
+}
+
+// imageName returns path to the image without the extensions added during
+// the build, so it doesn't change once the image is created or converted
+func imageName(config *image.Disk) string {
+	name := strings.TrimSuffix(config.Path, ".raw")
+	return strings.TrimSuffix(name, "."+string(config.Type))
+}
+
+// executor returns the executor running the commands on the host the image is built on
+func (b *ImageBuilder) executor() utils.Executor {
+	if b.Executor != nil {
+		return b.Executor
+	}
+	if b.SshfsConfig != nil {
+		return utils.NewExecutor(b.SshfsConfig.Common)
+	}
+	return utils.NewExecutor(nil)
+}
+
+// Plan writes the commands building the image to w.
+// Returns the image artifact the build would create.
+func (b *ImageBuilder) Plan(w io.Writer) (deployer.Artifact, error) {
+	if b.SshfsConfig != nil {
+		fmt.Fprintf(w, "# executed on %s, rootfs is attached to %s over sshfs\n", b.SshfsConfig.Common.Host, b.RootfsMp)
+	}
+	key, err := b.Cache.Key(b.ImageConfig, b.Filler)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if key != "" {
+		fmt.Fprintf(w, "# the image is copied from %s instead of being built once it is cached\n", filepath.Join(b.Cache.Dir, key))
+	}
+	p := image.NewPlanner(w, b.ImageConfig, b.RootfsMp, b.Utils)
+	if err := p.Parse(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if b.Filler != nil {
+		fmt.Fprintln(w, "# customize rootfs and install application")
+		if f, ok := b.Filler.(deployer.PlanRootfsFiller); ok {
+			if err := f.PlanRootfs(w, b.RootfsMp); err != nil {
+				return nil, utils.FormatError(err)
+			}
+		} else {
+			fmt.Fprintln(w, "# the rootfs filler cannot be planned")
+		}
+	}
+	if b.ImageConfig.Bootable {
+		if err := p.MakeBootable(); err != nil {
+			return nil, utils.FormatError(err)
+		}
+	}
+	if err := p.Cleanup(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	path, err := p.Convert()
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return &deployer.PlannedArtifact{
+		CommonArtifact: deployer.CommonArtifact{
+			Name: filepath.Base(path),
+			Path: path,
+			Type: deployer.ImageArtifact,
+		},
 	}, nil
 }
 
@@ -102,6 +270,10 @@ func (b *MetadataBuilder) Id() string {
 	return "MetadataBuilder"
 }
 
+func (b *MetadataBuilder) Depends() []string {
+	return b.Dependencies
+}
+
 func (b *MetadataBuilder) Run() (deployer.Artifact, error) {
 	// in case no source template exists apparently we should use the default metadata
 	_, err := os.Stat(b.Source)
@@ -119,14 +291,47 @@ func (b *MetadataBuilder) Run() (deployer.Artifact, error) {
 		return nil, utils.FormatError(err)
 	}
 
-	run := utils.RunFunc(b.SshConfig)
-	if _, err := run(fmt.Sprintf("echo \"%s\" > %s", data, b.Dest)); err != nil {
+	executor := b.Executor
+	if executor == nil {
+		executor = utils.NewExecutor(b.SshConfig)
+	}
+	if _, err := utils.Run(executor, fmt.Sprintf("echo \"%s\" > %s", data, b.Dest)); err != nil {
 		return nil, utils.FormatError(err)
 	}
 	return &deployer.CommonArtifact{
-		Name: filepath.Base(b.Dest),
-		Path: b.Dest,
-		Type: deployer.MetadataArtifact,
+		Name:      filepath.Base(b.Dest),
+		Path:      b.Dest,
+		Type:      deployer.MetadataArtifact,
+		SshConfig: b.SshConfig,
+		Executor:  executor,
+	}, nil
+}
+
+// Plan writes the rendered metadata to w.
+// Returns the metadata artifact the build would create.
+func (b *MetadataBuilder) Plan(w io.Writer) (deployer.Artifact, error) {
+	source := b.Source
+	if _, err := os.Stat(source); err != nil {
+		source = b.Dest
+	}
+	f, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	data, err := utils.ProcessTemplate(string(f), b.UserData)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if _, err := fmt.Fprintf(w, "cat > %s <<'EOF'\n%s\nEOF\n", b.Dest, data); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return &deployer.PlannedArtifact{
+		CommonArtifact: deployer.CommonArtifact{
+			Name: filepath.Base(b.Dest),
+			Path: b.Dest,
+			Type: deployer.MetadataArtifact,
+		},
+		Content: string(data),
 	}, nil
 }
 
@@ -0,0 +1,81 @@
+package builder
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+)
+
+func TestImageBuilderDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "builders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &utils.RecordingExecutor{
+		Respond: func(c *utils.Command) (*utils.Result, error) {
+			// the images don't exist yet
+			if strings.HasPrefix(c.Cmd, "ls") {
+				return nil, &utils.ExitError{Cmd: c.Cmd, ExitCode: 2}
+			}
+			if strings.HasPrefix(c.Cmd, "qemu-img convert") && strings.Contains(c.Cmd, "va-root") {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return nil, nil
+		},
+	}
+	newBuilder := func(name string, depends ...string) *ImageBuilder {
+		return &ImageBuilder{
+			ImageBuilderData: &deployer.ImageBuilderData{
+				ImageConfig:  &image.Disk{Path: filepath.Join(dir, name+".qcow2"), Type: image.StorageTypeQCOW2, SizeMb: 10},
+				RootfsMp:     filepath.Join(dir, name+"_mp"),
+				Dependencies: depends,
+				Executor:     e,
+			},
+			Utils: &image.Utils{Kpartx: "kpartx"},
+		}
+	}
+	root := newBuilder("va-root")
+	data := newBuilder("va-data", root.Id())
+	if root.Id() == data.Id() {
+		t.Fatalf("the builders are supposed to have different ids (%s)", root.Id())
+	}
+	id := root.Id()
+
+	artifacts, err := (&deployer.Scheduler{Parallelism: 2}).Build(context.Background(), []deployer.Builder{data, root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 || artifacts[0].GetPath() != filepath.Join(dir, "va-data.qcow2") {
+		t.Fatalf("unexpected artifacts %v", artifacts)
+	}
+	if root.Id() != id {
+		t.Fatalf("the id is not supposed to change during the build (%s)", root.Id())
+	}
+	if c := artifacts[1].(*deployer.CommonArtifact); c.Builder != id {
+		t.Fatalf("unexpected builder %s", c.Builder)
+	}
+
+	// the data disk is created once the root disk is converted
+	var created, converted int
+	for i, cmd := range e.Commands() {
+		if strings.HasPrefix(cmd, "dd ") && strings.Contains(cmd, "va-data") {
+			created = i
+		}
+		if strings.HasPrefix(cmd, "qemu-img convert") && strings.Contains(cmd, "va-root") {
+			converted = i
+		}
+	}
+	if created < converted {
+		t.Fatalf("unexpected build order %v", e.Commands())
+	}
+}
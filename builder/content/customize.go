@@ -3,6 +3,7 @@
 package content
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -12,8 +13,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/audit"
 	"github.com/dorzheh/infra/utils/ioutils"
 )
 
@@ -67,10 +71,10 @@ const (
 
 // Represents Item to inject
 type InjectItem struct {
-	Name        string      `xml:"name"`
+	Name        string      `xml:"name" validate:"required"`
 	BkpName     string      `xml:"bkp_name"`
-	Action      string      `xml:"action"`
-	Type        string      `xml:"type"`
+	Action      string      `xml:"action" validate:"required,oneof=create upload remove"`
+	Type        string      `xml:"type" validate:"oneof=file directory link"`
 	Location    string      `xml:"location"`
 	Permissions os.FileMode `xml:"permissions"`
 	UID         int         `xml:"owner_id"`
@@ -85,10 +89,10 @@ type InjectItems struct {
 
 // Represents services
 type Service struct {
-	Name   string `xml:"name"`
-	Type   string `xml:"type"`
-	Action string `xml:"action"`
-	Status string `xml:"status"`
+	Name   string `xml:"name" validate:"required"`
+	Type   string `xml:"type" validate:"required,oneof=sysv upstart"`
+	Action string `xml:"action" validate:"oneof=start stop restart reload"`
+	Status string `xml:"status" validate:"required,oneof=on off"`
 	Chroot bool   `xml:"chroot"`
 }
 
@@ -100,9 +104,9 @@ type Services struct {
 
 // Represents packages
 type Package struct {
-	Name   string `xml:"name"`
-	Type   string `xml:"type"`
-	Action string `xml:"action"`
+	Name   string `xml:"name" validate:"required"`
+	Type   string `xml:"type" validate:"required,oneof=rpm deb"`
+	Action string `xml:"action" validate:"required,oneof=install remove"`
 	Chroot bool   `xml:"chroot"`
 }
 
@@ -114,9 +118,9 @@ type Packages struct {
 
 // Represents a file content
 type FileContent struct {
-	Path       string `xml:"path"`
+	Path       string `xml:"path" validate:"required"`
 	BkpName    string `xml:"bkp_name"`
-	Action     string `xml:"action"`
+	Action     string `xml:"action" validate:"required,oneof=append replace"`
 	OldPattern string `xml:"old_pattern"`
 	NewPattern string `xml:"new_pattern"`
 }
@@ -127,33 +131,34 @@ type FilesContent struct {
 	FContent []FileContent `xml:"file"`
 }
 
-// ImageCustomize treating image customization according to XML config files
+// ImageCustomize treating image customization according to the config files
+// (XML, YAML or JSON, see utils.LoadFile)
 // Returns error or nil
 func Customize(pathToSlash, pathToConfigDir string) error {
 	//install/deinstall appropriate packages
-	pathToXml := pathToConfigDir + "/packages.xml"
-	if _, err := os.Stat(pathToXml); err == nil {
+	pathToXml := utils.FindConfigFile(pathToConfigDir, "packages")
+	if pathToXml != "" {
 		if err := packageManip(pathToXml, pathToSlash); err != nil {
 			return utils.FormatError(err)
 		}
 	}
 	// inject appropriate stuff
-	pathToXml = pathToConfigDir + "/inject_items.xml"
-	if _, err := os.Stat(pathToXml); err == nil {
+	pathToXml = utils.FindConfigFile(pathToConfigDir, "inject_items")
+	if pathToXml != "" {
 		if err := injectManip(pathToXml, pathToSlash); err != nil {
 			return utils.FormatError(err)
 		}
 	}
 	// services manipulation
-	pathToXml = pathToConfigDir + "/services.xml"
-	if _, err := os.Stat(pathToXml); err == nil {
+	pathToXml = utils.FindConfigFile(pathToConfigDir, "services")
+	if pathToXml != "" {
 		if err := serviceManip(pathToXml, pathToSlash); err != nil {
 			return utils.FormatError(err)
 		}
 	}
 	// file content modification
-	pathToXml = pathToConfigDir + "/files_content.xml"
-	if _, err := os.Stat(pathToXml); err == nil {
+	pathToXml = utils.FindConfigFile(pathToConfigDir, "files_content")
+	if pathToXml != "" {
 		if err := filesContentManip(pathToXml, pathToSlash); err != nil {
 			return utils.FormatError(err)
 		}
@@ -176,14 +181,9 @@ func Customize(pathToSlash, pathToConfigDir string) error {
 //	</package>
 //</packages>
 func packageManip(pathToXml, pathToSlash string) error {
-	// read the XML file to a buffer
-	dataBuf, err := ioutil.ReadFile(pathToXml)
-	if err != nil {
-		return utils.FormatError(err)
-	}
 	// parse the data structure
 	pkgsStruct := Packages{}
-	if err := xml.Unmarshal(dataBuf, &pkgsStruct); err != nil {
+	if err := utils.LoadFile(pathToXml, &pkgsStruct); err != nil {
 		return utils.FormatError(err)
 	}
 	var pkgCmd string
@@ -207,12 +207,12 @@ func packageManip(pathToXml, pathToSlash string) error {
 			return utils.FormatError(errors.New("unsupported package manip action"))
 		}
 		if val.Chroot {
-			if err := exec.Command("chroot", pathToSlash,
-				pkgCmd, "-y", action, val.Name).Run(); err != nil {
+			if err := run("chroot", pathToSlash,
+				pkgCmd, "-y", action, val.Name); err != nil {
 				return utils.FormatError(fmt.Errorf("chroot %s %s -y %s %s", pathToSlash, pkgCmd, action, val.Name))
 			}
 		} else {
-			if err := exec.Command(pkgCmd, "-y", action, val.Name).Run(); err != nil {
+			if err := run(pkgCmd, "-y", action, val.Name); err != nil {
 				return utils.FormatError(fmt.Errorf("%s -y %s %s", pkgCmd, action, val.Name))
 			}
 		}
@@ -240,12 +240,8 @@ func packageManip(pathToXml, pathToSlash string) error {
 //	</inject_item>
 //</inject_items
 func injectManip(pathToXml, pathToSlash string) error {
-	dataBuf, err := ioutil.ReadFile(pathToXml)
-	if err != nil {
-		return utils.FormatError(err)
-	}
 	itemsStruct := InjectItems{}
-	if err := xml.Unmarshal(dataBuf, &itemsStruct); err != nil {
+	if err := utils.LoadFile(pathToXml, &itemsStruct); err != nil {
 		return utils.FormatError(err)
 	}
 	for _, val := range itemsStruct.InjItems {
@@ -370,12 +366,8 @@ func injectManip(pathToXml, pathToSlash string) error {
 //	</service>
 //</services>
 func serviceManip(pathToXml, pathToSlash string) error {
-	dataBuf, err := ioutil.ReadFile(pathToXml)
-	if err != nil {
-		return utils.FormatError(err)
-	}
 	servicesStruct := Services{}
-	if err := xml.Unmarshal(dataBuf, &servicesStruct); err != nil {
+	if err := utils.LoadFile(pathToXml, &servicesStruct); err != nil {
 		return utils.FormatError(err)
 	}
 	for _, val := range servicesStruct.Srvcs {
@@ -387,7 +379,7 @@ func serviceManip(pathToXml, pathToSlash string) error {
 				var cmd string
 				var action string
 				if val.Chroot {
-					if err := exec.Command("chroot", pathToSlash, "which", "update-rc.d").Run(); err != nil {
+					if err := run("chroot", pathToSlash, "which", "update-rc.d"); err != nil {
 						cmd = "chkconfig"
 						action = val.Status
 					} else {
@@ -399,11 +391,11 @@ func serviceManip(pathToXml, pathToSlash string) error {
 							action = "disable"
 						}
 					}
-					if err := exec.Command("chroot", pathToSlash, cmd, val.Name, action).Run(); err != nil {
+					if err := run("chroot", pathToSlash, cmd, val.Name, action); err != nil {
 						return utils.FormatError(fmt.Errorf("chroot %s %s %s %s", pathToSlash, cmd, val.Name, action))
 					}
 				} else {
-					if err := exec.Command(cmd, val.Name, action).Run(); err != nil {
+					if err := run(cmd, val.Name, action); err != nil {
 						return utils.FormatError(fmt.Errorf("%s %s %s", cmd, val.Name, action))
 					}
 				}
@@ -413,8 +405,8 @@ func serviceManip(pathToXml, pathToSlash string) error {
 			// switch appropriate action towards the service
 			switch val.Action {
 			case ACTION_STOP, ACTION_START, ACTION_RESTART, ACTION_RELOAD:
-				if err := exec.Command("service",
-					val.Name, val.Action).Run(); err != nil {
+				if err := run("service",
+					val.Name, val.Action); err != nil {
 					return utils.FormatError(fmt.Errorf("service %s %s", val.Name, val.Action))
 				}
 			case "":
@@ -442,8 +434,8 @@ func serviceManip(pathToXml, pathToSlash string) error {
 			}
 			switch val.Action {
 			case ACTION_STOP, ACTION_START, ACTION_RESTART, ACTION_RELOAD:
-				if err := exec.Command("initctl", val.Name,
-					val.Action).Run(); err != nil {
+				if err := run("initctl", val.Name,
+					val.Action); err != nil {
 					return utils.FormatError(fmt.Errorf("initctl %s %s", val.Name, val.Action))
 				}
 			case "":
@@ -475,19 +467,12 @@ func serviceManip(pathToXml, pathToSlash string) error {
 //	</file>
 //</files>
 func filesContentManip(pathToXml, pathToSlash string) error {
-	dataBuf, err := ioutil.ReadFile(pathToXml)
-	if err != nil {
-		return utils.FormatError(err)
-	}
 	fileContentStruct := FilesContent{}
-	if err := xml.Unmarshal(dataBuf, &fileContentStruct); err != nil {
+	if err := utils.LoadFile(pathToXml, &fileContentStruct); err != nil {
 		return utils.FormatError(err)
 	}
 	for _, val := range fileContentStruct.FContent {
 		targetPath := filepath.Join(pathToSlash, val.Path)
-		if err != nil {
-			return utils.FormatError(err)
-		}
 		finfo, err := os.Stat(targetPath)
 		if err != nil {
 			continue
@@ -528,6 +513,34 @@ func filesContentManip(pathToXml, pathToSlash string) error {
 	return nil
 }
 
+// run executes the command and records it to the audit log
+func run(name string, args ...string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err := cmd.Run()
+
+	e := &audit.Entry{
+		Host:    audit.Localhost,
+		User:    audit.LocalUser(),
+		Op:      audit.OpExec,
+		Command: strings.Join(cmd.Args, " "),
+		Stdout:  stdout.String(),
+		Stderr:  stderr.String(),
+		Error:   audit.ErrorString(err),
+	}
+	if err != nil {
+		e.ExitStatus = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			e.ExitStatus = exitErr.ExitCode()
+		}
+	}
+	audit.Record(e, start)
+	return err
+}
+
 // ProcessHooks is intended for executing appropriate hooks.
 // The hooks must contain the following prefix : [0-9]+_
 // If arguments are being passed to the function, they will be
@@ -557,7 +570,7 @@ func ProcessHooks(pathToHooksDir string, hookArgs ...string) error {
 	})
 	sort.Strings(scriptsSlice)
 	for _, file := range scriptsSlice {
-		if err := exec.Command(file, hookArgs[0:]...).Run(); err != nil {
+		if err := run(file, hookArgs[0:]...); err != nil {
 			return utils.FormatError(err)
 		}
 	}
@@ -0,0 +1,199 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/dorzheh/deployer/utils"
+)
+
+// Plan writes the actions Customize would perform to w
+// without touching the target.
+func Plan(w io.Writer, pathToSlash, pathToConfigDir string) error {
+	planners := []struct {
+		file string
+		plan func(io.Writer, string, string) error
+	}{
+		{"packages", packagePlan},
+		{"inject_items", injectPlan},
+		{"services", servicePlan},
+		{"files_content", filesContentPlan},
+	}
+	for _, p := range planners {
+		pathToXml := utils.FindConfigFile(pathToConfigDir, p.file)
+		if pathToXml == "" {
+			continue
+		}
+		fmt.Fprintf(w, "# %s\n", pathToXml)
+		if err := p.plan(w, pathToXml, pathToSlash); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	return nil
+}
+
+// packagePlan describes packageManip
+func packagePlan(w io.Writer, pathToXml, pathToSlash string) error {
+	pkgsStruct := Packages{}
+	if err := utils.LoadFile(pathToXml, &pkgsStruct); err != nil {
+		return utils.FormatError(err)
+	}
+	for _, val := range pkgsStruct.Pkgs {
+		var pkgCmd string
+		switch val.Type {
+		case PKG_TYPE_RPM:
+			pkgCmd = "yum"
+		case PKG_TYPE_DEB:
+			pkgCmd = "apt-get"
+		default:
+			return utils.FormatError(errors.New("unsupported package format"))
+		}
+		if val.Action != ACTION_INSTALL && val.Action != ACTION_REMOVE {
+			return utils.FormatError(errors.New("unsupported package manip action"))
+		}
+		if val.Chroot {
+			fmt.Fprintf(w, "chroot %s %s -y %s %s\n", pathToSlash, pkgCmd, val.Action, val.Name)
+		} else {
+			fmt.Fprintf(w, "%s -y %s %s\n", pkgCmd, val.Action, val.Name)
+		}
+	}
+	return nil
+}
+
+// injectPlan describes injectManip
+func injectPlan(w io.Writer, pathToXml, pathToSlash string) error {
+	itemsStruct := InjectItems{}
+	if err := utils.LoadFile(pathToXml, &itemsStruct); err != nil {
+		return utils.FormatError(err)
+	}
+	for _, val := range itemsStruct.InjItems {
+		srcPath := filepath.Dir(pathToXml) + "/items/" + val.Name
+		targetLocationPath := filepath.Join(pathToSlash, val.Location)
+		dstPath := filepath.Join(targetLocationPath, val.Name)
+		dstBkpPath := filepath.Join(targetLocationPath, val.BkpName)
+		switch val.Action {
+		case ACTION_REMOVE:
+			if val.BkpName == "" {
+				fmt.Fprintf(w, "rm -rf %s\n", dstPath)
+			} else {
+				fmt.Fprintf(w, "mv %s %s\n", dstPath, dstBkpPath)
+			}
+		case ACTION_UPLOAD, ACTION_CREATE:
+			switch val.Type {
+			case ITEM_TYPE_FILE:
+				fmt.Fprintf(w, "mkdir -p %s\n", targetLocationPath)
+				if val.Action == ACTION_UPLOAD {
+					if val.BkpName != "" {
+						fmt.Fprintf(w, "mv %s %s\n", dstPath, dstBkpPath)
+					}
+					fmt.Fprintf(w, "cp -p %s %s\n", srcPath, dstPath)
+					fmt.Fprintf(w, "chown %d:%d %s\n", val.UID, val.GID, dstPath)
+				} else {
+					fmt.Fprintf(w, "touch %s\n", dstPath)
+				}
+			case ITEM_TYPE_DIR:
+				fmt.Fprintf(w, "mkdir -p -m %o %s\n", val.Permissions, dstPath)
+				fmt.Fprintf(w, "chown %d:%d %s\n", val.UID, val.GID, dstPath)
+				if val.Action == ACTION_UPLOAD {
+					if val.BkpName != "" {
+						fmt.Fprintf(w, "mv %s %s\n", dstPath, dstBkpPath)
+					}
+					fmt.Fprintf(w, "cp -a %s %s\n", srcPath, dstPath)
+				}
+			case ITEM_TYPE_LINK:
+				fmt.Fprintf(w, "mkdir -p -m %o %s\n", val.Permissions, targetLocationPath)
+				fmt.Fprintf(w, "ln -sf %s %s\n", val.BkpName, dstPath)
+			default:
+				return utils.FormatError(errors.New("injectPlan: configuration error - unexpected element type"))
+			}
+		default:
+			return utils.FormatError(errors.New("injectPlan: configuration error - unexpected action"))
+		}
+	}
+	return nil
+}
+
+// servicePlan describes serviceManip
+func servicePlan(w io.Writer, pathToXml, pathToSlash string) error {
+	servicesStruct := Services{}
+	if err := utils.LoadFile(pathToXml, &servicesStruct); err != nil {
+		return utils.FormatError(err)
+	}
+	for _, val := range servicesStruct.Srvcs {
+		switch val.Type {
+		case SVC_TYPE_SYSV:
+			var action string
+			switch val.Status {
+			case SVC_STATUS_ON:
+				action = "enable"
+			case SVC_STATUS_OFF:
+				action = "disable"
+			default:
+				return utils.FormatError(errors.New(`servicePlan :sysv:status configuration error - unsupported service status`))
+			}
+			if val.Chroot {
+				fmt.Fprintf(w, "chroot %s update-rc.d %s %s || chroot %s chkconfig %s %s\n",
+					pathToSlash, val.Name, action, pathToSlash, val.Name, val.Status)
+			} else {
+				fmt.Fprintf(w, "chkconfig %s %s\n", val.Name, val.Status)
+			}
+			switch val.Action {
+			case ACTION_STOP, ACTION_START, ACTION_RESTART, ACTION_RELOAD:
+				fmt.Fprintf(w, "service %s %s\n", val.Name, val.Action)
+			case "":
+			default:
+				return utils.FormatError(errors.New(`servicePlan :sysv:action: configuration error - unsupported action ` + val.Action))
+			}
+
+		case SVC_TYPE_UPSTART:
+			dummyServicePath := filepath.Join(pathToSlash, "/etc/init/", val.Name+".override")
+			switch val.Status {
+			case SVC_STATUS_OFF:
+				fmt.Fprintf(w, "echo -n manual > %s\n", dummyServicePath)
+			case SVC_STATUS_ON:
+				fmt.Fprintf(w, "rm -f %s\n", dummyServicePath)
+			default:
+				return utils.FormatError(errors.New(`configuration error - unsupported service status`))
+			}
+			switch val.Action {
+			case ACTION_STOP, ACTION_START, ACTION_RESTART, ACTION_RELOAD:
+				fmt.Fprintf(w, "initctl %s %s\n", val.Name, val.Action)
+			case "":
+			default:
+				return utils.FormatError(errors.New(`servicePlan : upstart :configuration error - unsupported action`))
+			}
+		}
+	}
+	return nil
+}
+
+// filesContentPlan describes filesContentManip
+func filesContentPlan(w io.Writer, pathToXml, pathToSlash string) error {
+	fileContentStruct := FilesContent{}
+	if err := utils.LoadFile(pathToXml, &fileContentStruct); err != nil {
+		return utils.FormatError(err)
+	}
+	for _, val := range fileContentStruct.FContent {
+		targetPath := filepath.Join(pathToSlash, val.Path)
+		if val.NewPattern == "" {
+			return utils.FormatError(errors.New("configuration error - NewPattern is empty"))
+		}
+		if val.BkpName != "" {
+			fmt.Fprintf(w, "cp %s %s\n", targetPath, filepath.Join(pathToSlash, val.BkpName))
+		}
+		switch val.Action {
+		case ACTION_APPEND:
+			fmt.Fprintf(w, "grep -qF %q %s || echo %q >> %s\n", val.NewPattern, targetPath, val.NewPattern, targetPath)
+		case ACTION_REPLACE:
+			if val.OldPattern == "" {
+				return utils.FormatError(errors.New("configuration error - replace action is set but OldPattern is empty"))
+			}
+			fmt.Fprintf(w, "# replace %q with %q in %s\n", val.OldPattern, val.NewPattern, targetPath)
+		default:
+			return utils.FormatError(errors.New(`filesContentPlan:configuration error - unsupported action`))
+		}
+	}
+	return nil
+}
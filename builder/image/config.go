@@ -38,7 +38,6 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 
 	"github.com/dorzheh/deployer/utils"
 )
@@ -71,21 +70,21 @@ type Config struct {
 
 type Disk struct {
 	Path            string
-	Type            StorageType    `xml:"storage_type"`
-	SizeMb          int            `xml:"size_mb"`
+	Type            StorageType    `xml:"storage_type" validate:"oneof=raw qcow2 vmdk"`
+	SizeMb          int            `xml:"size_mb" validate:"required,min=1"`
 	Bootable        bool           `xml:"bootable"`
-	BootLoader      BootLoaderType `xml:"bootloader"`
-	ActivePartition int            `xml:"active_part"`
+	BootLoader      BootLoaderType `xml:"bootloader" validate:"oneof=grub grub2 extlinux"`
+	ActivePartition int            `xml:"active_part" validate:"min=1"`
 	FdiskCmd        string         `xml:"fdisk_cmd"`
 	Description     string         `xml:"description"`
 	Partitions      []*Partition   `xml:"partition"`
 }
 
 type Partition struct {
-	Sequence       int    `xml:"sequence"`
-	Type           int    `xml:"type"`
-	SizeMb         int    `xml:"size_mb"`
-	SizePercents   int    `xml:"size_percents"`
+	Sequence       int    `xml:"sequence" validate:"required,min=1"`
+	Type           int    `xml:"type" validate:"required,min=0"`
+	SizeMb         int    `xml:"size_mb" validate:"min=0"`
+	SizePercents   int    `xml:"size_percents" validate:"min=0,max=100"`
 	Label          string `xml:"label"`
 	MountPoint     string `xml:"mount_point"`
 	FileSystem     string `xml:"file_system"`
@@ -93,14 +92,14 @@ type Partition struct {
 	Description    string `xml:"description"`
 }
 
-// ParseConfigFile is responsible for reading appropriate XML file
-// and calling ParseConfig for further processing
+// ParseConfigFile is responsible for reading appropriate configuration file
+// (XML, YAML or JSON, see utils.LoadFile)
 func ParseConfigFile(xmlpath string) (*Storage, error) {
-	fb, err := ioutil.ReadFile(xmlpath)
-	if err != nil {
+	p := new(Storage)
+	if err := utils.LoadFile(xmlpath, p); err != nil {
 		return nil, utils.FormatError(err)
 	}
-	return ParseConfig(fb)
+	return p, nil
 }
 
 // ParseConfig is responsible for processing XML content
@@ -3,8 +3,10 @@
 package image
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -15,6 +17,8 @@ import (
 
 	"github.com/dorzheh/deployer/builder/content"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/audit"
+	"github.com/dorzheh/deployer/utils/progress"
 	"github.com/dorzheh/infra/comm/sshfs"
 )
 
@@ -61,7 +65,13 @@ type image struct {
 	localmount string
 
 	// executes commands locally or remotely
-	run func(string) (string, error)
+	executor utils.Executor
+
+	// the commands manipulating the image are killed once the context is done
+	ctx context.Context
+
+	// reports progress of the image manipulation
+	progress *progress.Reporter
 
 	// sshfs client
 	client *sshfs.Client
@@ -78,18 +88,37 @@ type Utils struct {
 // path to temporary directory where the vHDD image supposed to be mounted
 // and path to vHDD image.
 // Returns a pointer to the structure and error/nil
-func New(config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config) (i *image, err error) {
+func New(config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config) (*image, error) {
+	return NewWithExecutor(config, rootfsMp, bins, remoteConfig, nil)
+}
+
+// NewWithExecutor is like New but the commands are run by means of the executor.
+// If the executor is nil, it is derived from remoteConfig.
+func NewWithExecutor(config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config, e utils.Executor) (*image, error) {
+	return NewContext(context.Background(), config, rootfsMp, bins, remoteConfig, e)
+}
+
+// NewContext is like NewWithExecutor but the commands creating and manipulating
+// the image are killed once the context is done.
+// The commands releasing the image (see Cleanup) are not bound to the context.
+func NewContext(ctx context.Context, config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config, e utils.Executor) (i *image, err error) {
 	i = new(image)
+	i.ctx = ctx
 	i.needToFormat = false
 	var qemuImgError string
 
+	i.executor = e
 	if remoteConfig == nil {
-		i.run = utils.RunFunc(nil)
+		if i.executor == nil {
+			i.executor = utils.NewExecutor(nil)
+		}
 		i.slashpath = rootfsMp
 		i.utils = bins
 		qemuImgError = "please install qemu-img"
 	} else {
-		i.run = utils.RunFunc(remoteConfig.Common)
+		if i.executor == nil {
+			i.executor = utils.NewExecutor(remoteConfig.Common)
+		}
 		i.client, err = sshfs.NewClient(remoteConfig)
 		if err != nil {
 			err = utils.FormatError(err)
@@ -100,7 +129,9 @@ func New(config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config)
 			err = utils.FormatError(err)
 			return
 		}
-		if err = i.client.Attach(i.slashpath, i.localmount); err != nil {
+		if err = i.sshfs(audit.OpAttach, i.localmount+" => "+i.slashpath, func() error {
+			return i.client.Attach(i.slashpath, i.localmount)
+		}); err != nil {
 			err = utils.FormatError(err)
 			return
 		}
@@ -116,12 +147,10 @@ func New(config *Disk, rootfsMp string, bins *Utils, remoteConfig *sshfs.Config)
 			err = utils.FormatError(errors.New(qemuImgError))
 			return
 		}
-		// set temporary name
-		config.Path = strings.Replace(config.Path, "."+string(config.Type), "", -1)
 	}
 
 	i.config = config
-	i.config.Path = config.Path + ".raw"
+	i.config.Path = rawImagePath(config)
 	if _, err = i.run("ls" + config.Path); err != nil {
 		if err = i.create(); err != nil {
 			err = utils.FormatError(err)
@@ -148,6 +177,60 @@ func setUtilNewPaths(i *image, u *Utils) error {
 	return nil
 }
 
+// SetProgressReporter sets the reporter the image manipulation
+// progress (partitioning, mkfs, bootloader installation, conversion) is reported to
+func (i *image) SetProgressReporter(r *progress.Reporter) {
+	i.progress = r
+}
+
+// run executes the command unless the context is done and returns its output
+func (i *image) run(command string) (string, error) {
+	return i.execute(i.ctx, command, nil)
+}
+
+// stream is like run but the output of the command is also written to w
+func (i *image) stream(command string, w io.Writer) (string, error) {
+	return i.execute(i.ctx, command, w)
+}
+
+// release executes the command releasing the image resources.
+// The command runs even if the context is done, so that a cancelled
+// build doesn't leave mounted loop devices behind
+func (i *image) release(command string) (string, error) {
+	return i.execute(context.Background(), command, nil)
+}
+
+func (i *image) execute(ctx context.Context, command string, w io.Writer) (string, error) {
+	c := &utils.Command{Cmd: command}
+	if w != nil {
+		c.Stdout = w
+		c.Stderr = w
+	}
+	res, err := i.executor.Execute(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// sshfs performs the sshfs operation and records it to the audit log
+func (i *image) sshfs(op, desc string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	e := &audit.Entry{
+		Host:    i.client.Config.Common.Host,
+		User:    i.client.Config.Common.User,
+		Op:      op,
+		Command: desc,
+		Error:   audit.ErrorString(err),
+	}
+	if err != nil {
+		e.ExitStatus = -1
+	}
+	audit.Record(e, start)
+	return err
+}
+
 // Parse processes RAW image
 // Returns error/nil
 func (i *image) Parse() error {
@@ -182,7 +265,9 @@ func (i *image) Customize(pathToConfigDir string) error {
 // Returns error or nil
 func (i *image) Cleanup() error {
 	if i.localmount != "" {
-		if err := i.client.Detach(i.localmount); err != nil {
+		if err := i.sshfs(audit.OpDetach, i.localmount, func() error {
+			return i.client.Detach(i.localmount)
+		}); err != nil {
 			return utils.FormatError(err)
 		}
 	}
@@ -190,35 +275,35 @@ func (i *image) Cleanup() error {
 	var index uint8 = i.loopDevice.amountOfMappers - 1
 	for i.loopDevice.amountOfMappers != 0 {
 		if i.loopDevice.mappers[index].mountPoint != "/" {
-			if out, err := i.run(fmt.Sprintf("umount -l %s", i.loopDevice.mappers[index].mountPoint)); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			if out, err := i.release(fmt.Sprintf("umount -l %s", i.loopDevice.mappers[index].mountPoint)); err != nil {
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 			i.loopDevice.amountOfMappers--
 			index--
 		}
 	}
-	if out, err := i.run(fmt.Sprintf("umount -l %s", i.slashpath)); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+	if out, err := i.release(fmt.Sprintf("umount -l %s", i.slashpath)); err != nil {
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	// unbind mappers and image
-	if out, err := i.run(i.utils.Kpartx + " -d " + i.loopDevice.name); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+	if out, err := i.release(i.utils.Kpartx + " -d " + i.loopDevice.name); err != nil {
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
-	if out, err := i.run("losetup -d " + i.loopDevice.name); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+	if out, err := i.release("losetup -d " + i.loopDevice.name); err != nil {
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	// remove mount point
-	if out, err := i.run("rm -rf " + i.slashpath); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+	if out, err := i.release("rm -rf " + i.slashpath); err != nil {
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	if i.localmount != "" {
 		// remove mount point
-		if out, err := i.run("rm -rf " + i.utils.dir); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		if out, err := i.release("rm -rf " + i.utils.dir); err != nil {
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 		// remove mount point
-		if out, err := i.run("rm -rf " + i.localmount); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		if out, err := i.release("rm -rf " + i.localmount); err != nil {
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 	}
 	return nil
@@ -227,17 +312,16 @@ func (i *image) Cleanup() error {
 // MakeBootable is responsible for making RAW disk bootable.
 // The target disk could be either local or remote image
 func (i *image) MakeBootable() error {
+	i.progress.Stage("bootloader", string(i.config.BootLoader))
 	switch i.config.BootLoader {
 	case BootLoaderGrub:
 		grubPath, err := i.run("chroot " + i.slashpath + "  which grub")
 		if err != nil {
 			return utils.FormatError(err)
 		}
-		cmd := fmt.Sprintf("echo -e \"device (hd0) %s\nroot (hd0,0)\nsetup (hd0)\n\"|%s",
-			i.config.Path, filepath.Join(i.slashpath, grubPath))
-		out, err := i.run(cmd)
+		out, err := i.run(grubCmd(i.config.Path, filepath.Join(i.slashpath, grubPath)))
 		if err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 		if strings.Contains(out, "Error 15: File not found") {
 			return utils.FormatError(errors.New("installing GRUB [Error 15: File not found]"))
@@ -248,32 +332,21 @@ func (i *image) MakeBootable() error {
 		if err != nil {
 			return utils.FormatError(err)
 		}
-		defer i.run("losetup -d " + dummyLoopDevice)
+		defer i.release("losetup -d " + dummyLoopDevice)
 
 		dummyLoopDeviceMp, err := i.run("mktemp -d --suffix _deployer_dummy_loop")
 		if err != nil {
 			return utils.FormatError(err)
 		}
 		if out, err := i.run("mount " + dummyLoopDevice + " " + dummyLoopDeviceMp); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 		defer func() {
-			cmd := "umount -l " + dummyLoopDeviceMp + "/proc " + dummyLoopDeviceMp + "/dev;"
-			cmd += "umount -f " + dummyLoopDeviceMp
-			cmd += ";rm -rf " + dummyLoopDeviceMp
-			i.run(cmd)
+			i.release(grub2CleanupCmd(dummyLoopDeviceMp))
 		}()
 
-		cmd := fmt.Sprintf("mkdir -p %s/boot/grub; echo -e \"(hd0) %s\n(hd0,1) %s\" > %s/boot/grub/device.map;",
-			dummyLoopDeviceMp, i.loopDevice.name, dummyLoopDevice, dummyLoopDeviceMp)
-		cmd += "mount --bind /dev " + dummyLoopDeviceMp + "/dev ;chroot " + dummyLoopDeviceMp + " mount -t proc none /proc;"
-		cmd += "chroot " + dummyLoopDeviceMp + " grub-install --no-floppy --grub-mkdevicemap=/boot/grub/device.map " + i.loopDevice.name
-		cmd += ";chroot " + dummyLoopDeviceMp + " update-grub;"
-		cmd += "rm -f " + dummyLoopDeviceMp + "/boot/grub/device.map;"
-		cmd += "sed -i '/loop/d' " + dummyLoopDeviceMp + "/boot/grub/grub.cfg"
-
-		if out, err := i.run(cmd); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		if out, err := i.run(grub2Cmd(i.loopDevice.name, dummyLoopDevice, dummyLoopDeviceMp)); err != nil {
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 
 	case BootLoaderExtlinux:
@@ -282,7 +355,7 @@ func (i *image) MakeBootable() error {
 		}
 
 		defer func() {
-			i.run("umount -l " + i.slashpath + "/proc " + i.slashpath + "/dev")
+			i.release("umount -l " + i.slashpath + "/proc " + i.slashpath + "/dev")
 		}()
 
 		var extlinuxMbrPath string
@@ -294,15 +367,8 @@ func (i *image) MakeBootable() error {
 			return utils.FormatError(errors.New("Extlinux mbr binary not found"))
 		}
 
-		cmd := "mount --bind /dev " + i.slashpath + "/dev;"
-		cmd += "chroot " + i.slashpath + " /bin/bash -c "
-		cmd += "\"LC_ALL=C export PATH=/usr/local/bin:/usr/local/sbin:/usr/bin:/usr/sbin:/bin:/sbin;"
-		cmd += "mount -t proc none /proc;"
-		cmd += "dd if=" + extlinuxMbrPath + " of=" + i.loopDevice.name + " bs=440 count=1 conv=notrunc;"
-		cmd += "extlinux -i /boot/extlinux;"
-		cmd += "extlinux-update || true\""
-		if out, err := i.run(cmd); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		if out, err := i.run(extlinuxCmd(i.slashpath, extlinuxMbrPath, i.loopDevice.name)); err != nil {
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 	}
 	return nil
@@ -348,7 +414,8 @@ func (i *image) partTableMakefs() error {
 		i.generateFdiskCmd()
 	}
 
-	i.run(fmt.Sprintf("echo -e  \"%s\"|%s %s", i.config.FdiskCmd, "fdisk", i.loopDevice.name))
+	i.progress.Stage("fdisk", "fdisk "+i.loopDevice.name)
+	i.run(fdiskCmd(i.config.FdiskCmd, i.loopDevice.name))
 	mappers, err := i.getMappers(i.loopDevice.name)
 	if err != nil {
 		return utils.FormatError(err)
@@ -356,13 +423,12 @@ func (i *image) partTableMakefs() error {
 	// first iteration - find root mount point and mount it
 	for index, part := range i.config.Partitions {
 		if part.MountPoint == "/" {
-			cmd := fmt.Sprintf("mkfs -t %v -L %s %s %s", part.FileSystem,
-				part.Label, part.FileSystemArgs, mappers[index])
-			if out, err := i.run(cmd); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			cmd := mkfsCmd(part, mappers[index])
+			if out, err := i.stream(cmd, i.progress.Writer("mkfs", cmd)); err != nil {
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 			if out, err := i.run(fmt.Sprintf("mount %s %s", mappers[index], i.slashpath)); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 		}
 	}
@@ -370,14 +436,13 @@ func (i *image) partTableMakefs() error {
 	for index, part := range i.config.Partitions {
 		mapper := mappers[index]
 		if part.Type == 82 {
-			if out, err := i.run(fmt.Sprintf("mkswap -L %s %s", part.Label, mapper)); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			if out, err := i.run(mkswapCmd(part, mapper)); err != nil {
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 		} else if part.MountPoint != "/" {
-			cmd := fmt.Sprintf("mkfs -t %v -L %s %s %s", part.FileSystem,
-				part.Label, part.FileSystemArgs, mapper)
-			if out, err := i.run(cmd); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			cmd := mkfsCmd(part, mapper)
+			if out, err := i.stream(cmd, i.progress.Writer("mkfs", cmd)); err != nil {
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 			if err := i.addMapper(mapper, part.MountPoint); err != nil {
 				return utils.FormatError(err)
@@ -463,7 +528,7 @@ func (i *image) addMappers() error {
 	for index, part := range i.config.Partitions {
 		if part.MountPoint == "/" {
 			if out, err := i.run(fmt.Sprintf("mount %s %s", mappers[index], i.slashpath)); err != nil {
-				return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+				return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 			}
 		}
 	}
@@ -483,7 +548,7 @@ func (i *image) addMappers() error {
 func (i *image) addMapper(mapperDeviceName, path string) error {
 	mountPoint := filepath.Join(i.slashpath, path)
 	if out, err := i.run("mkdir -p " + mountPoint); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	// check if the volume is already mounted
 	mounted, err := isMounted(mapperDeviceName)
@@ -492,7 +557,7 @@ func (i *image) addMapper(mapperDeviceName, path string) error {
 	}
 	if !mounted {
 		if out, err := i.run(fmt.Sprintf("mount %s %s", mapperDeviceName, mountPoint)); err != nil {
-			return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+			return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 		}
 	}
 	// add mapper
@@ -509,9 +574,9 @@ func (i *image) addMapper(mapperDeviceName, path string) error {
 
 // create is intended for creating RAW image
 func (i *image) create() error {
-	out, err := i.run(fmt.Sprintf("dd if=/dev/zero of=%s count=1 bs=1 seek=%vM", i.config.Path, i.config.SizeMb))
+	out, err := i.run(createCmd(i.config))
 	if err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	return nil
 }
@@ -535,7 +600,7 @@ func (i *image) getMappers(loopDeviceName string) ([]string, error) {
 		strings.TrimSpace(strings.SplitAfter(loopDeviceName, "/dev/loop")[1]))
 	out, err := i.run(cmd)
 	if err != nil {
-		return mappers, utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		return mappers, utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	for _, line := range strings.Split(out, "\n") {
 		if line != "" {
@@ -552,29 +617,107 @@ func (i *image) getMappers(loopDeviceName string) ([]string, error) {
 // convert is responsible for converting RAW image to other format
 func (i *image) convert() error {
 	// set the new path - append extention
-	newPath := fmt.Sprintf("%s.%s", strings.TrimSuffix(i.config.Path, ".raw"), i.config.Type)
-	if out, err := i.run(fmt.Sprintf("qemu-img convert -f raw -O %s %s %s", i.config.Type, i.config.Path, newPath)); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+	newPath := convertedImagePath(i.config)
+	cmd := convertCmd(i.config.Type, i.config.Path, newPath)
+	if out, err := i.stream(cmd, i.progress.Writer("convert", cmd)); err != nil {
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	//remove temporary image
 	if out, err := i.run("rm -rf " + i.config.Path); err != nil {
-		return utils.FormatError(fmt.Errorf("%s [%v]", out, err))
+		return utils.FormatError(fmt.Errorf("%s [%w]", out, err))
 	}
 	// expose the new path
 	i.config.Path = newPath
 	return nil
 }
 
+// bind attaches the image to the first unused loop device.
+// Finding and attaching the device is done by a single command
+// so that builders running in parallel don't race for the same device
 func (i *image) bind(imagePath string) (loopDevice string, err error) {
-	loopDevice, err = i.run("losetup -f")
-	if err != nil {
+	if loopDevice, err = i.run("losetup -f --show " + imagePath); err != nil {
 		err = utils.FormatError(err)
-		return
-	}
-	cmd := fmt.Sprintf("losetup %s %s", loopDevice, imagePath)
-	if out, er := i.run(cmd); err != nil {
-		err = utils.FormatError(fmt.Errorf("%s [%v]", out, er))
-		return
 	}
 	return
 }
+
+/// Commands ///
+
+// rawImagePath returns path to the RAW image the disk is created from
+func rawImagePath(config *Disk) string {
+	path := config.Path
+	if config.Type != StorageTypeRAW {
+		// set temporary name
+		path = strings.Replace(path, "."+string(config.Type), "", -1)
+	}
+	return path + ".raw"
+}
+
+// convertedImagePath returns path to the image converted from the RAW one
+func convertedImagePath(config *Disk) string {
+	return fmt.Sprintf("%s.%s", strings.TrimSuffix(config.Path, ".raw"), config.Type)
+}
+
+// ArtifactPath returns path to the image built according to the configuration
+func ArtifactPath(config *Disk) string {
+	path := rawImagePath(config)
+	if config.Type == StorageTypeRAW {
+		return path
+	}
+	return convertedImagePath(&Disk{Path: path, Type: config.Type})
+}
+
+func createCmd(config *Disk) string {
+	return fmt.Sprintf("dd if=/dev/zero of=%s count=1 bs=1 seek=%vM", config.Path, config.SizeMb)
+}
+
+func fdiskCmd(fdiskScript, device string) string {
+	return fmt.Sprintf("echo -e  \"%s\"|%s %s", fdiskScript, "fdisk", device)
+}
+
+func mkfsCmd(part *Partition, device string) string {
+	return fmt.Sprintf("mkfs -t %v -L %s %s %s", part.FileSystem,
+		part.Label, part.FileSystemArgs, device)
+}
+
+func mkswapCmd(part *Partition, device string) string {
+	return fmt.Sprintf("mkswap -L %s %s", part.Label, device)
+}
+
+func grubCmd(imagePath, grubPath string) string {
+	return fmt.Sprintf("echo -e \"device (hd0) %s\nroot (hd0,0)\nsetup (hd0)\n\"|%s",
+		imagePath, grubPath)
+}
+
+func grub2Cmd(loopDevice, dummyLoopDevice, dummyLoopDeviceMp string) string {
+	cmd := fmt.Sprintf("mkdir -p %s/boot/grub; echo -e \"(hd0) %s\n(hd0,1) %s\" > %s/boot/grub/device.map;",
+		dummyLoopDeviceMp, loopDevice, dummyLoopDevice, dummyLoopDeviceMp)
+	cmd += "mount --bind /dev " + dummyLoopDeviceMp + "/dev ;chroot " + dummyLoopDeviceMp + " mount -t proc none /proc;"
+	cmd += "chroot " + dummyLoopDeviceMp + " grub-install --no-floppy --grub-mkdevicemap=/boot/grub/device.map " + loopDevice
+	cmd += ";chroot " + dummyLoopDeviceMp + " update-grub;"
+	cmd += "rm -f " + dummyLoopDeviceMp + "/boot/grub/device.map;"
+	cmd += "sed -i '/loop/d' " + dummyLoopDeviceMp + "/boot/grub/grub.cfg"
+	return cmd
+}
+
+func grub2CleanupCmd(dummyLoopDeviceMp string) string {
+	cmd := "umount -l " + dummyLoopDeviceMp + "/proc " + dummyLoopDeviceMp + "/dev;"
+	cmd += "umount -f " + dummyLoopDeviceMp
+	cmd += ";rm -rf " + dummyLoopDeviceMp
+	return cmd
+}
+
+func extlinuxCmd(slashpath, extlinuxMbrPath, loopDevice string) string {
+	cmd := "mount --bind /dev " + slashpath + "/dev;"
+	cmd += "chroot " + slashpath + " /bin/bash -c "
+	cmd += "\"LC_ALL=C export PATH=/usr/local/bin:/usr/local/sbin:/usr/bin:/usr/sbin:/bin:/sbin;"
+	cmd += "mount -t proc none /proc;"
+	cmd += "dd if=" + extlinuxMbrPath + " of=" + loopDevice + " bs=440 count=1 conv=notrunc;"
+	cmd += "extlinux -i /boot/extlinux;"
+	cmd += "extlinux-update || true\""
+	return cmd
+}
+
+func convertCmd(storageType StorageType, src, dst string) string {
+	return fmt.Sprintf("qemu-img convert -p -f raw -O %s %s %s", storageType, src, dst)
+}
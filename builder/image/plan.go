@@ -0,0 +1,154 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Placeholders for values known only once the image is being built
+const (
+	PlanLoopDevice      = "<loop_device>"
+	PlanDummyLoopDevice = "<dummy_loop_device>"
+	PlanDummyLoopMp     = "<dummy_loop_mount_point>"
+	PlanGrubPath        = "<grub_path>"
+	PlanExtlinuxMbrPath = "<extlinux_mbr_path>"
+)
+
+// Planner describes the image manipulation without performing it.
+// The commands are written in the order the image builder executes them;
+// values known only at the build time are represented by placeholders.
+type Planner struct {
+	w         io.Writer
+	config    *Disk
+	slashpath string
+	utils     *Utils
+	mounts    []string
+	err       error
+}
+
+// NewPlanner gets the storage configuration, path to the directory the image
+// is supposed to be mounted to, set of utilities and a writer the commands are written to.
+// The configuration is not modified.
+func NewPlanner(w io.Writer, config *Disk, rootfsMp string, bins *Utils) *Planner {
+	c := *config
+	c.Partitions = nil
+	for _, part := range config.Partitions {
+		p := *part
+		c.Partitions = append(c.Partitions, &p)
+	}
+	c.Path = rawImagePath(config)
+	return &Planner{
+		w:         w,
+		config:    &c,
+		slashpath: rootfsMp,
+		utils:     bins,
+	}
+}
+
+// Parse describes creating the RAW image, partitioning,
+// formatting and mounting the partitions
+func (p *Planner) Parse() error {
+	p.printf("# create RAW image %s", p.config.Path)
+	p.printf("%s", createCmd(p.config))
+	p.printf("losetup -f --show %s # => %s", p.config.Path, PlanLoopDevice)
+	if p.config.Partitions == nil {
+		return p.err
+	}
+	if p.config.FdiskCmd == "" {
+		(&image{config: p.config}).generateFdiskCmd()
+	}
+	p.printf("# partition table")
+	p.printf("%s", fdiskCmd(p.config.FdiskCmd, PlanLoopDevice))
+	p.printf("%s -a %s", p.kpartx(), PlanLoopDevice)
+
+	// first iteration - root partition
+	for index, part := range p.config.Partitions {
+		if part.MountPoint == "/" {
+			p.printf("%s", mkfsCmd(part, p.mapper(index)))
+			p.printf("mount %s %s", p.mapper(index), p.slashpath)
+		}
+	}
+	// second iteration - everything else except /
+	for index, part := range p.config.Partitions {
+		if part.Type == 82 {
+			p.printf("%s", mkswapCmd(part, p.mapper(index)))
+		} else if part.MountPoint != "/" {
+			mountPoint := filepath.Join(p.slashpath, part.MountPoint)
+			p.printf("%s", mkfsCmd(part, p.mapper(index)))
+			p.printf("mkdir -p %s", mountPoint)
+			p.printf("mount %s %s", p.mapper(index), mountPoint)
+			p.mounts = append(p.mounts, mountPoint)
+		}
+	}
+	return p.err
+}
+
+// MakeBootable describes the bootloader installation
+func (p *Planner) MakeBootable() error {
+	p.printf("# install %s bootloader", p.config.BootLoader)
+	switch p.config.BootLoader {
+	case BootLoaderGrub:
+		p.printf("chroot %s  which grub # => %s", p.slashpath, PlanGrubPath)
+		p.printf("%s", grubCmd(p.config.Path, filepath.Join(p.slashpath, PlanGrubPath)))
+	case BootLoaderGrub2:
+		p.printf("losetup -f --show %s # => %s", p.mapper(0), PlanDummyLoopDevice)
+		p.printf("mktemp -d --suffix _deployer_dummy_loop # => %s", PlanDummyLoopMp)
+		p.printf("mount %s %s", PlanDummyLoopDevice, PlanDummyLoopMp)
+		p.printf("%s", grub2Cmd(PlanLoopDevice, PlanDummyLoopDevice, PlanDummyLoopMp))
+		p.printf("%s", grub2CleanupCmd(PlanDummyLoopMp))
+		p.printf("losetup -d %s", PlanDummyLoopDevice)
+	case BootLoaderExtlinux:
+		p.printf("# %s is either /usr/lib/EXTLINUX/mbr.bin or /usr/lib/extlinux/mbr.bin", PlanExtlinuxMbrPath)
+		p.printf("%s", extlinuxCmd(p.slashpath, PlanExtlinuxMbrPath, PlanLoopDevice))
+		p.printf("umount -l %s/proc %s/dev", p.slashpath, p.slashpath)
+	default:
+		p.printf("# unsupported bootloader")
+	}
+	return p.err
+}
+
+// Cleanup describes releasing the image
+func (p *Planner) Cleanup() error {
+	p.printf("# release the image")
+	for index := len(p.mounts) - 1; index >= 0; index-- {
+		p.printf("umount -l %s", p.mounts[index])
+	}
+	p.printf("umount -l %s", p.slashpath)
+	p.printf("%s -d %s", p.kpartx(), PlanLoopDevice)
+	p.printf("losetup -d %s", PlanLoopDevice)
+	p.printf("rm -rf %s", p.slashpath)
+	return p.err
+}
+
+// Convert describes converting the RAW image to the target format
+// Returns path to the final image
+func (p *Planner) Convert() (string, error) {
+	if p.config.Type == StorageTypeRAW {
+		return p.config.Path, p.err
+	}
+	newPath := convertedImagePath(p.config)
+	p.printf("# convert the image to %s", p.config.Type)
+	p.printf("%s", convertCmd(p.config.Type, p.config.Path, newPath))
+	p.printf("rm -rf %s", p.config.Path)
+	return newPath, p.err
+}
+
+func (p *Planner) kpartx() string {
+	if p.utils == nil || p.utils.Kpartx == "" {
+		return "kpartx"
+	}
+	return p.utils.Kpartx
+}
+
+// mapper returns placeholder of the device mapper the partition is bound to
+func (p *Planner) mapper(index int) string {
+	return fmt.Sprintf("%sp%d", PlanLoopDevice, index+1)
+}
+
+// printf writes a line unless writing has already failed
+func (p *Planner) printf(format string, a ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format+"\n", a...)
+	}
+}
@@ -0,0 +1,572 @@
+// Command line deploying a product to the environments registered
+// by deployer.RegisterEnvironment. A product only registers its
+// environments and calls Main:
+//
+//	func main() {
+//		cli.Main(&cli.Product{Name: "MyProduct", RootDir: rootDir, Arch: "x86_64"})
+//	}
+//
+// Usage:
+//
+//	myproduct deploy [-env libvirt-kvm] [-answers answers.xml] [-host 192.168.1.10] [-export-dir /var/lib/images] [-sign-key key.pem] [-cache-dir /var/cache/myproduct]
+//	myproduct plan -answers answers.xml [-output plan.sh]
+//	myproduct list-envs
+//	myproduct hwinfo -env libvirt-kvm [-host 192.168.1.10]
+//	myproduct status|start|stop|restart|undeploy [-env libvirt-kvm] [-host 192.168.1.10] [domain]
+//	myproduct list [-env libvirt-kvm] [-host 192.168.1.10]
+//	myproduct validate [-schema storage_config] [file|directory...]
+//	myproduct verify [-manifest .manifest.json] [-host 192.168.1.10]
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	deploy "github.com/dorzheh/deployer"
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/config/inventory"
+	"github.com/dorzheh/deployer/deployer"
+	gui "github.com/dorzheh/deployer/ui"
+	"github.com/dorzheh/deployer/ui/dialog_ui"
+	"github.com/dorzheh/deployer/utils"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+// Product describes the product deployed by the command line
+type Product struct {
+	// Name of the product (default name of the virtual appliance)
+	Name string
+
+	// RootDir is the directory containing the components of the product
+	RootDir string
+
+	// Arch is the architecture the deployer is running on
+	Arch string
+
+	// Eula (optional) is path to the EULA shown by interactive deployment
+	Eula string
+
+	// Prepare (optional) is called before the appliance is deployed
+	// or planned (extracting the components and so forth)
+	Prepare func() error
+
+	// Schemas (optional) maps the names of the product specific configuration
+	// files (without extension) to the structures the files are decoded to.
+	// The validate command checks them in addition to the deployer ones.
+	Schemas map[string]interface{}
+
+	// TrustedKeys (optional) is a path to the ed25519 public key (or to the directory
+	// of keys) trusted to sign the manifest of the artifacts
+	// (default "trusted_keys" directory of the product).
+	TrustedKeys string
+
+	// RequireSignature indicates that the manifest must be signed by a trusted key
+	// even if no keys are found (see deployer.CommonData.RequireSignature).
+	RequireSignature bool
+}
+
+// command represents a subcommand
+type command struct {
+	name  string
+	usage string
+	run   func(p *Product, args []string, w io.Writer) error
+}
+
+var commands = []*command{
+	{"deploy", "deploy the appliance", runDeploy},
+	{"plan", "write the actions the deployment would perform", runPlan},
+	{"list-envs", "list the environments the appliance can be deployed to", runListEnvs},
+	{"hwinfo", "show hardware of the host", runHwinfo},
+}
+
+// Main runs the command given by the arguments of the process and exits
+func Main(p *Product) {
+	if err := Run(p, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Run runs the command given by the arguments.
+// The output of the command is written to w.
+func Run(p *Product, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		usage(w)
+		return errors.New("command is not set")
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(w)
+		return nil
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(p, args[1:], w)
+		}
+	}
+	usage(w)
+	return fmt.Errorf("unknown command \"%s\"", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "\nRun '<command> -h' for the flags of the command.\n")
+}
+
+// options contains the flags of the commands
+type options struct {
+	env         string
+	answersFile string
+	host        string
+	sshPort     string
+	sshUser     string
+	sshKey      string
+	exportDir   string
+
+	recordFile     string
+	keepArtifacts  bool
+	auditLog       string
+	checkpoint     string
+	resume         bool
+	inventoryFile  string
+	groups         string
+	parallel       int
+	logDir         string
+	reportFile     string
+	reportHTMLFile string
+	manifestFile   string
+	noCache        bool
+	cacheDir       string
+	cacheSizeMb    int
+	cacheEntries   int
+	signingKey     string
+	requireSig     bool
+
+	output string
+}
+
+// flagSet creates the flag set of the command.
+// Every command accepts the environment and the host flags.
+func flagSet(name string, w io.Writer, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&o.env, "env", "", "environment to deploy to (see list-envs)")
+	fs.StringVar(&o.answersFile, "answers", "", "path to answers file (unattended deployment)")
+	fs.StringVar(&o.host, "host", "", "IP of the remote host (unattended deployment)")
+	fs.StringVar(&o.sshPort, "ssh-port", "", "SSH port of the remote host")
+	fs.StringVar(&o.sshUser, "ssh-user", "", "SSH user of the remote host")
+	fs.StringVar(&o.sshKey, "ssh-key", "", "path to SSH private key file of the remote host")
+	return fs
+}
+
+// deploymentFlags adds the flags of the commands deploying the appliance
+func deploymentFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.exportDir, "export-dir", "", "directory the artifacts are stored to (unattended deployment)")
+	fs.BoolVar(&o.keepArtifacts, "keep-artifacts", false, "keep artifacts of a failed deployment for debugging")
+	fs.StringVar(&o.recordFile, "record", "", "path to answers file the interactive session is recorded to")
+	fs.StringVar(&o.manifestFile, "manifest", "", "path to the manifest of the artifacts (default .manifest.json in the product directory)")
+	fs.StringVar(&o.signingKey, "sign-key", "", "path to the ed25519 private key (PEM) the manifest of the artifacts is signed with")
+	fs.BoolVar(&o.requireSig, "require-signature", false, "fail unless the manifest is signed by a trusted key")
+	fs.BoolVar(&o.noCache, "no-cache", false, "always build the images instead of copying them from the cache")
+	fs.StringVar(&o.cacheDir, "cache-dir", "", "directory on the build host the images are cached in (empty means no cache)")
+	fs.IntVar(&o.cacheSizeMb, "cache-size", 20480, "maximal size of the image cache in MB (0 means no limit)")
+	fs.IntVar(&o.cacheEntries, "cache-entries", 0, "maximal amount of cached images (0 means no limit)")
+}
+
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument \"%s\"", fs.Name(), fs.Arg(0))
+	}
+	return nil
+}
+
+func runDeploy(p *Product, args []string, w io.Writer) error {
+	o := new(options)
+	fs := flagSet("deploy", w, o)
+	deploymentFlags(fs, o)
+	fs.StringVar(&o.auditLog, "audit-log", "", "path to the log every executed command is recorded to")
+	fs.StringVar(&o.checkpoint, "checkpoint", "", "path to the file the state of the deployment is persisted to")
+	fs.BoolVar(&o.resume, "resume", false, "resume the deployment persisted to the checkpoint file")
+	fs.StringVar(&o.inventoryFile, "inventory", "", "path to inventory file (deploy to many hosts)")
+	fs.StringVar(&o.groups, "groups", "", "comma separated groups of the inventory hosts to deploy to (default all)")
+	fs.IntVar(&o.parallel, "parallel", 4, "maximal amount of hosts deployed simultaneously")
+	fs.StringVar(&o.logDir, "log-dir", "", "directory the per-host logs are written to")
+	fs.StringVar(&o.reportFile, "report", "", "path to the JSON report of the deployment")
+	fs.StringVar(&o.reportHTMLFile, "report-html", "", "path to the HTML report of the deployment")
+	if err := parse(fs, args); err != nil {
+		return ignoreHelp(err)
+	}
+
+	if err := prepare(p); err != nil {
+		return err
+	}
+	msg := p.Name + " installation completed successfully"
+	switch {
+	case o.inventoryFile != "":
+		return multiHost(p, o, w)
+	case o.resume:
+		if err := resume(p, o); err != nil {
+			return err
+		}
+	default:
+		a, err := o.answers()
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			return interactive(p, o, nil, msg)
+		}
+		if err := unattended(p, o, a, nil); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w, msg)
+	return nil
+}
+
+func runPlan(p *Product, args []string, w io.Writer) error {
+	o := new(options)
+	fs := flagSet("plan", w, o)
+	deploymentFlags(fs, o)
+	fs.StringVar(&o.output, "output", "-", "path to the file the plan is written to (\"-\" for stdout)")
+	if err := parse(fs, args); err != nil {
+		return ignoreHelp(err)
+	}
+
+	out := w
+	if o.output != "-" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			return utils.FormatError(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := prepare(p); err != nil {
+		return err
+	}
+	a, err := o.answers()
+	if err != nil {
+		return err
+	}
+	msg := p.Name + " deployment plan created successfully"
+	if a == nil {
+		return interactive(p, o, out, msg)
+	}
+	if err := unattended(p, o, a, out); err != nil {
+		return err
+	}
+	if out != w {
+		fmt.Fprintln(w, msg)
+	}
+	return nil
+}
+
+func runListEnvs(p *Product, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("list-envs", flag.ContinueOnError)
+	fs.SetOutput(w)
+	if err := parse(fs, args); err != nil {
+		return ignoreHelp(err)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTITLE")
+	for _, e := range deployer.Environments() {
+		fmt.Fprintf(tw, "%s\t%s\n", e.Name, e)
+	}
+	return tw.Flush()
+}
+
+func runHwinfo(p *Product, args []string, w io.Writer) error {
+	o := new(options)
+	fs := flagSet("hwinfo", w, o)
+	if err := parse(fs, args); err != nil {
+		return ignoreHelp(err)
+	}
+	a, err := o.answers()
+	if err != nil {
+		return err
+	}
+	env, err := o.environment(a)
+	if err != nil {
+		return err
+	}
+	if env.NewHostinfoDriver == nil {
+		return fmt.Errorf("environment %s doesn't provide hardware information", env.Name)
+	}
+	var conf *ssh.Config
+	if a != nil {
+		if conf, err = a.SshConfig(); err != nil {
+			return err
+		}
+	}
+	defer utils.DefaultSshPool.Close()
+
+	c := commonData(p, o)
+	if conf != nil {
+		c.Host = conf.Host
+	}
+	hw, err := env.NewHostinfoDriver(c, conf)
+	if err != nil {
+		return err
+	}
+	if err := hw.Init(); err != nil {
+		return err
+	}
+	h, err := deployer.CollectHardware(hw)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, h)
+}
+
+// ignoreHelp returns nil if the usage of the command was requested
+func ignoreHelp(err error) error {
+	if err == flag.ErrHelp {
+		return nil
+	}
+	return err
+}
+
+func prepare(p *Product) error {
+	if p.Prepare == nil {
+		return nil
+	}
+	return p.Prepare()
+}
+
+// answers returns the answers amended by the host and the export
+// directory flags or nil if the deployment is interactive
+func (o *options) answers() (*answers.Answers, error) {
+	var a *answers.Answers
+	if o.answersFile != "" {
+		var err error
+		if a, err = answers.ParseFile(o.answersFile); err != nil {
+			return nil, err
+		}
+	}
+	if o.host == "" && o.exportDir == "" {
+		return a, nil
+	}
+	if a == nil {
+		a = new(answers.Answers)
+	}
+	if o.host != "" {
+		ssh := new(answers.Ssh)
+		if a.Ssh != nil {
+			*ssh = *a.Ssh
+		}
+		ssh.Host = o.host
+		if o.sshPort != "" {
+			ssh.Port = o.sshPort
+		}
+		if o.sshUser != "" {
+			ssh.User = o.sshUser
+		}
+		if o.sshKey != "" {
+			ssh.PrvtKeyFile = o.sshKey
+		}
+		a.Ssh = ssh
+		a.RemoteMode = true
+	}
+	if o.exportDir != "" {
+		a.ExportDir = o.exportDir
+	}
+	if err := a.Verify(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return a, nil
+}
+
+// environment returns the environment selected by the flags or the answers.
+// The only registered environment is selected by default.
+func (o *options) environment(a *answers.Answers) (*deployer.Environment, error) {
+	name := o.env
+	if name == "" && a != nil {
+		name = a.Env
+	}
+	if name != "" {
+		return deployer.LookupEnvironment(name)
+	}
+	envs := deployer.Environments()
+	switch len(envs) {
+	case 0:
+		return nil, errors.New("no environments registered")
+	case 1:
+		return envs[0], nil
+	}
+	return nil, errors.New("environment is not set (see list-envs)")
+}
+
+// environments returns the environments the user can select from
+func (o *options) environments() ([]*deployer.Environment, error) {
+	if o.env == "" {
+		return deployer.Environments(), nil
+	}
+	env, err := deployer.LookupEnvironment(o.env)
+	if err != nil {
+		return nil, err
+	}
+	return []*deployer.Environment{env}, nil
+}
+
+// commonData creates the data shared by all the deployment modes
+func commonData(p *Product, o *options) *deployer.CommonData {
+	return &deployer.CommonData{
+		RootDir:          p.RootDir,
+		RootfsMp:         filepath.Join(p.RootDir, "rootfs_mnt"),
+		DefaultExportDir: p.RootDir,
+		VaName:           p.Name,
+		Arch:             p.Arch,
+		KeepArtifacts:    o.keepArtifacts,
+		AuditLog:         o.auditLog,
+		Checkpoint:       o.checkpoint,
+		ReportFile:       o.reportFile,
+		ReportHTMLFile:   o.reportHTMLFile,
+		ManifestFile:     o.manifestFile,
+		SigningKey:       o.signingKey,
+		TrustedKeys:      p.TrustedKeys,
+		RequireSignature: p.RequireSignature || o.requireSig,
+		Cache:            o.cache(),
+	}
+}
+
+// cache returns the cache of the images or nil if caching is disabled.
+// The images are cached only if the cache directory is set: the directory resides
+// on the host the images are built on (the remote host in remote mode)
+func (o *options) cache() *deployer.ArtifactCache {
+	if o.noCache || o.cacheDir == "" {
+		return nil
+	}
+	return &deployer.ArtifactCache{
+		Dir:        o.cacheDir,
+		MaxSize:    int64(o.cacheSizeMb) << 20,
+		MaxEntries: o.cacheEntries,
+	}
+}
+
+// unattended runs the deployment without user interaction.
+// The deployment is planned if planOutput is set.
+func unattended(p *Product, o *options, a *answers.Answers, planOutput io.Writer) error {
+	env, err := o.environment(a)
+	if err != nil {
+		return err
+	}
+	// the environment is persisted to the checkpoint and to the records
+	a.Env = env.String()
+	c := commonData(p, o)
+	c.Answers = a
+	c.Plan = planOutput != nil
+	c.PlanOutput = planOutput
+	return deploy.Deploy(c, env.NewFlowCreator())
+}
+
+// interactive runs the deployment using the dialog based UI.
+// The deployment is planned if planOutput is set.
+func interactive(p *Product, o *options, planOutput io.Writer, msg string) error {
+	envs, err := o.environments()
+	if err != nil {
+		return err
+	}
+	if len(envs) == 0 {
+		return errors.New("no environments registered")
+	}
+	var titles []string
+	var flows []deployer.FlowCreator
+	for _, e := range envs {
+		titles = append(titles, e.String())
+		flows = append(flows, e.NewFlowCreator())
+	}
+
+	ui := dialog_ui.NewDialogUi()
+	ui.Shadow(false)
+	ui.SetCancelLabel("Exit")
+	if planOutput == nil {
+		// planning doesn't require root privileges
+		gui.UiValidateUser(ui, 0)
+	}
+	gui.UiWelcomeMsg(ui, p.Name)
+	if p.Eula != "" {
+		gui.UiEulaMsg(ui, p.Eula)
+	}
+	c := commonData(p, o)
+	c.Ui = ui
+	c.RecordFile = o.recordFile
+	c.Plan = planOutput != nil
+	c.PlanOutput = planOutput
+	err = gui.UiSelectEnv(c, titles, flows)
+	gui.UiDeploymentResult(ui, msg, err)
+	return err
+}
+
+// resume continues the deployment persisted to the checkpoint file
+func resume(p *Product, o *options) error {
+	if o.checkpoint == "" {
+		return errors.New("-resume requires -checkpoint")
+	}
+	cp, err := deployer.LoadCheckpoint(o.checkpoint)
+	if err != nil {
+		return err
+	}
+	if cp.Config == nil {
+		return fmt.Errorf("checkpoint %s doesn't contain configuration", o.checkpoint)
+	}
+	env, err := o.environment(cp.Config)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %v", o.checkpoint, err)
+	}
+	return deploy.Resume(commonData(p, o), env.NewFlowCreator())
+}
+
+// multiHost deploys the appliance to the inventory hosts
+func multiHost(p *Product, o *options, w io.Writer) error {
+	if o.host != "" {
+		return errors.New("-host cannot be used with -inventory (the inventory defines the hosts)")
+	}
+	a, err := o.answers()
+	if err != nil {
+		return err
+	}
+	env, err := o.environment(a)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		a.Env = env.String()
+	}
+	inv, err := inventory.ParseFile(o.inventoryFile)
+	if err != nil {
+		return err
+	}
+	c := commonData(p, o)
+	c.Answers = a
+	m := &deploy.MultiHost{
+		Inventory:      inv,
+		Parallelism:    o.parallel,
+		LogDir:         o.logDir,
+		NewFlowCreator: env.NewFlowCreator,
+	}
+	if o.groups != "" {
+		m.Groups = strings.Split(o.groups, ",")
+	}
+	results, err := m.Deploy(c)
+	if results != nil {
+		deploy.WriteResults(w, results)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, p.Name+" installation completed successfully")
+	return nil
+}
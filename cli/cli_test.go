@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+)
+
+// testFlow creates an empty image in the export directory
+type testFlow struct {
+	dir string
+}
+
+func (f *testFlow) CreateConfig(c *deployer.CommonData) error {
+	if c.Answers == nil || c.Answers.ExportDir == "" {
+		return errors.New("export directory is not set")
+	}
+	f.dir = c.Answers.ExportDir
+	return nil
+}
+
+func (f *testFlow) CreateBuilders(c *deployer.CommonData) ([]deployer.Builder, error) {
+	return []deployer.Builder{&testBuilder{filepath.Join(f.dir, c.VaName+".img")}}, nil
+}
+
+func (f *testFlow) CreatePostProcessor(c *deployer.CommonData) (deployer.PostProcessor, error) {
+	return nil, nil
+}
+
+type testBuilder struct {
+	path string
+}
+
+func (b *testBuilder) Id() string {
+	return "ImageBuilder"
+}
+
+func (b *testBuilder) Run() (deployer.Artifact, error) {
+	if err := ioutil.WriteFile(b.path, nil, 0644); err != nil {
+		return nil, err
+	}
+	return &deployer.CommonArtifact{Name: "image", Path: b.path}, nil
+}
+
+func init() {
+	deployer.RegisterEnvironment(&deployer.Environment{
+		Name:           "test-env",
+		Title:          "Test(Env)",
+		NewFlowCreator: func() deployer.FlowCreator { return new(testFlow) },
+	})
+}
+
+func TestDeploy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &Product{Name: "appliance", RootDir: dir}
+	var out bytes.Buffer
+	if err := Run(p, []string{"deploy", "-env", "test-env", "-export-dir", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "appliance.img")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "installation completed successfully") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	if err := Run(p, []string{"deploy", "-env", "unknown", "-export-dir", dir}, &out); err == nil {
+		t.Fatal("unknown environment is supposed to produce an error")
+	}
+
+	out.Reset()
+	if err := Run(p, []string{"verify"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1 artifacts match") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "appliance.img"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(p, []string{"verify"}, &out); err == nil {
+		t.Fatal("changed artifact is supposed to produce an error")
+	}
+}
+
+func TestListEnvs(t *testing.T) {
+	var out bytes.Buffer
+	if err := Run(new(Product), []string{"list-envs"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "test-env") || !strings.Contains(out.String(), "Test(Env)") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := Run(new(Product), []string{"destroy"}, &out); err == nil {
+		t.Fatal("unknown command is supposed to produce an error")
+	}
+	if !strings.Contains(out.String(), "list-envs") {
+		t.Fatalf("usage is not printed: %q", out.String())
+	}
+}
+
+func TestInventoryHost(t *testing.T) {
+	args := []string{"deploy", "-env", "test-env", "-inventory", "inventory.xml", "-host", "10.0.0.1"}
+	if err := Run(new(Product), args, ioutil.Discard); err == nil || !strings.Contains(err.Error(), "-inventory") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"storage_config.xml": "<storage><config><disk><size_mb>1024</size_mb></disk></config></storage>",
+		"packages.yaml":      "package:\n  - name: tunctl\n    type: rpm\n    action: install\n",
+		"README.md":          "not a configuration file",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := &Product{Name: "appliance", RootDir: dir}
+	var out bytes.Buffer
+	if err := Run(p, []string{"validate"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "2 configuration files are valid") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	services := filepath.Join(dir, "services.json")
+	if err := ioutil.WriteFile(services, []byte(`{"service": [{"name": "sshd", "type": "systemd", "status": "on"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := Run(p, []string{"validate"}, &out); err == nil {
+		t.Fatal("invalid service type is supposed to produce an error")
+	}
+	if !strings.Contains(out.String(), services+":1:31: services/service/type") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if err := Run(p, []string{"validate", "-schema", "packages", services}, &out); err == nil {
+		t.Fatal("services are not supposed to match packages schema")
+	}
+}
+
+func TestSignedDeploy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "build.key")
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	trusted := filepath.Join(dir, "trusted.pem")
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(trusted, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Product{Name: "appliance", RootDir: dir, TrustedKeys: trusted}
+	var out bytes.Buffer
+	if err := Run(p, []string{"deploy", "-env", "test-env", "-export-dir", dir, "-sign-key", key}, &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := Run(p, []string{"verify"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "signed by key "+deployer.KeyId(pub)) {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	// nothing is deployed unless the manifest is signed by the trusted key
+	if err := Run(p, []string{"deploy", "-env", "test-env", "-export-dir", dir}, &out); !errors.Is(err, deployer.ErrUnsigned) {
+		t.Fatalf("unsigned deployment is supposed to produce an error: %v", err)
+	}
+
+	// the signature is required, but no keys are trusted
+	p = &Product{Name: "appliance", RootDir: dir, TrustedKeys: filepath.Join(dir, "missing")}
+	for _, args := range [][]string{
+		{"deploy", "-env", "test-env", "-export-dir", dir, "-sign-key", key, "-require-signature"},
+		{"verify", "-require-signature"},
+	} {
+		if err := Run(p, args, &out); !errors.Is(err, deployer.ErrNoTrustedKeys) {
+			t.Fatalf("%v: unexpected error %v", args, err)
+		}
+	}
+}
+
+func TestCacheOptIn(t *testing.T) {
+	for _, c := range []struct {
+		args    []string
+		enabled bool
+	}{
+		{nil, false},
+		{[]string{"-cache-dir", "/var/cache/appliance"}, true},
+		{[]string{"-cache-dir", "/var/cache/appliance", "-no-cache"}, false},
+	} {
+		o := new(options)
+		fs := flagSet("deploy", ioutil.Discard, o)
+		deploymentFlags(fs, o)
+		if err := parse(fs, c.args); err != nil {
+			t.Fatal(err)
+		}
+		if cache := o.cache(); (cache != nil) != c.enabled {
+			t.Fatalf("%v: unexpected cache %+v", c.args, cache)
+		}
+	}
+}
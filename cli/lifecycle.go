@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/lifecycle"
+	"github.com/dorzheh/deployer/utils"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+func init() {
+	commands = append(commands,
+		&command{"start", "start the appliance", runStart},
+		&command{"stop", "stop the appliance", runStop},
+		&command{"restart", "restart the appliance", runRestart},
+		&command{"status", "show state of the appliance", runStatus},
+		&command{"undeploy", "stop the appliance and remove its definitions (the images are kept)", runUndeploy},
+		&command{"list", "list the domains of the host", runList},
+	)
+}
+
+// lifecycleOptions contains the flags of the life cycle commands
+type lifecycleOptions struct {
+	options
+	force   bool
+	timeout time.Duration
+	json    bool
+}
+
+// lifecycleFlagSet creates the flag set of the life cycle command
+func lifecycleFlagSet(name string, w io.Writer, o *lifecycleOptions) *flag.FlagSet {
+	fs := flagSet(name, w, &o.options)
+	switch name {
+	case "stop", "restart":
+		fs.BoolVar(&o.force, "force", false, "destroy the domain instead of shutting it down")
+		fs.DurationVar(&o.timeout, "timeout", lifecycle.DefaultTimeout, "maximal time the shutdown takes")
+	case "status", "list":
+		fs.BoolVar(&o.json, "json", false, "write JSON")
+	}
+	return fs
+}
+
+// lifecycleManager parses the arguments of the command.
+// Returns the manager of the domains on the host and the name of the domain
+// (the appliance name of the answers or the product name by default)
+func lifecycleManager(p *Product, name string, args []string, w io.Writer, o *lifecycleOptions) (*lifecycle.Manager, string, error) {
+	fs := lifecycleFlagSet(name, w, o)
+	fs.Usage = func() {
+		fmt.Fprintf(w, "Usage of %s [flags] [domain]:\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if fs.NArg() > 1 {
+		return nil, "", fmt.Errorf("%s: unexpected argument \"%s\"", name, fs.Arg(1))
+	}
+
+	a, err := o.answers()
+	if err != nil {
+		return nil, "", err
+	}
+	env, err := o.environment(a)
+	if err != nil {
+		return nil, "", err
+	}
+	if env.NewEnvDriver == nil {
+		return nil, "", fmt.Errorf("environment %s doesn't provide domain management", env.Name)
+	}
+	var conf *ssh.Config
+	if a != nil {
+		if conf, err = a.SshConfig(); err != nil {
+			return nil, "", err
+		}
+	}
+	m, err := lifecycle.NewManager(env.NewEnvDriver(conf))
+	if err != nil {
+		return nil, "", err
+	}
+	m.Timeout = o.timeout
+
+	domain := fs.Arg(0)
+	if domain == "" && a != nil {
+		domain = a.ApplianceName
+	}
+	if domain == "" {
+		domain = p.Name
+	}
+	return m, domain, nil
+}
+
+func runStart(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, domain, err := lifecycleManager(p, "start", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	if err := m.Start(domain); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s started\n", domain)
+	return nil
+}
+
+func runStop(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, domain, err := lifecycleManager(p, "stop", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	if err := m.Stop(domain, o.force); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s stopped\n", domain)
+	return nil
+}
+
+func runRestart(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, domain, err := lifecycleManager(p, "restart", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	if err := m.Restart(domain, o.force); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s restarted\n", domain)
+	return nil
+}
+
+func runStatus(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, domain, err := lifecycleManager(p, "status", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	dom, err := m.Status(domain)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return writeJSON(w, dom)
+	}
+	return writeDomains(w, []*deployer.Domain{dom})
+}
+
+func runUndeploy(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, domain, err := lifecycleManager(p, "undeploy", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	if err := m.Undeploy(domain); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s undeployed\n", domain)
+	return nil
+}
+
+func runList(p *Product, args []string, w io.Writer) error {
+	o := new(lifecycleOptions)
+	m, _, err := lifecycleManager(p, "list", args, w, o)
+	if err != nil {
+		return ignoreHelp(err)
+	}
+	defer utils.DefaultSshPool.Close()
+	domains, err := m.List()
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return writeJSON(w, domains)
+	}
+	return writeDomains(w, domains)
+}
+
+func writeDomains(w io.Writer, domains []*deployer.Domain) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tAUTOSTART")
+	for _, d := range domains {
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", d.Name, d.State, d.Autostart)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	fb, err := json.MarshalIndent(v, "", "   ")
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", fb)
+	return err
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dorzheh/deployer/builder/content"
+	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/config/bundle"
+	"github.com/dorzheh/deployer/config/xmlinput"
+	"github.com/dorzheh/deployer/utils"
+)
+
+func init() {
+	commands = append(commands,
+		&command{"validate", "validate the configuration files of the product", runValidate},
+	)
+}
+
+// schemas maps the names of the configuration files (without extension)
+// to the structures the files are decoded to
+var schemas = map[string]func() interface{}{
+	"storage_config":    func() interface{} { return new(image.Storage) },
+	"input_data_config": func() interface{} { return new(xmlinput.XMLInputData) },
+	"bundle_config":     func() interface{} { return new(bundle.DefaultBundle) },
+	"packages":          func() interface{} { return new(content.Packages) },
+	"inject_items":      func() interface{} { return new(content.InjectItems) },
+	"services":          func() interface{} { return new(content.Services) },
+	"files_content":     func() interface{} { return new(content.FilesContent) },
+}
+
+// schemaOf returns the structure the configuration file is decoded to
+// or nil if the file is not a configuration file
+func schemaOf(p *Product, name string) interface{} {
+	if s, ok := p.Schemas[name]; ok {
+		return s
+	}
+	if f, ok := schemas[name]; ok {
+		return f()
+	}
+	return nil
+}
+
+// schemaNames returns the names of the known configuration files
+func schemaNames(p *Product) []string {
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	for name := range p.Schemas {
+		if _, ok := schemas[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runValidate(p *Product, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(w)
+	schema := fs.String("schema", "", "schema of the given files ("+strings.Join(schemaNames(p), ", ")+")")
+	fs.Usage = func() {
+		fmt.Fprintf(w, "Usage of validate [flags] [file|directory...] (the product directory by default):\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return ignoreHelp(err)
+	}
+	if *schema != "" && schemaOf(p, *schema) == nil {
+		return fmt.Errorf("validate: unknown schema \"%s\"", *schema)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		if err := prepare(p); err != nil {
+			return err
+		}
+		paths = []string{p.RootDir}
+	}
+	var validated, invalid int
+	for _, path := range paths {
+		files, err := configFiles(p, path, *schema)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			validated++
+			if err := utils.ValidateFile(f.path, f.schema); err != nil {
+				invalid++
+				fmt.Fprintln(w, err)
+			}
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d configuration files are invalid", invalid, validated)
+	}
+	fmt.Fprintf(w, "%d configuration files are valid\n", validated)
+	return nil
+}
+
+// configFile is a configuration file and the structure it is decoded to
+type configFile struct {
+	path   string
+	schema interface{}
+}
+
+// configFiles returns the configuration files of the path.
+// A directory is walked looking for the files named after the known schemas.
+// A file is validated against the given schema or the schema of its name.
+func configFiles(p *Product, path, schema string) ([]*configFile, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if !fi.IsDir() {
+		name := schema
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		s := schemaOf(p, name)
+		if s == nil {
+			return nil, fmt.Errorf("validate: unknown configuration file %s (see -schema)", path)
+		}
+		return []*configFile{{path, s}}, nil
+	}
+
+	var files []*configFile
+	err = filepath.Walk(path, func(f string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		ext := filepath.Ext(f)
+		known := false
+		for _, e := range utils.ConfigExtensions {
+			if strings.EqualFold(ext, e) {
+				known = true
+			}
+		}
+		if !known {
+			return nil
+		}
+		name := schema
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(f), ext)
+		}
+		if s := schemaOf(p, name); s != nil {
+			files = append(files, &configFile{f, s})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return files, nil
+}
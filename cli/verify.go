@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+func init() {
+	commands = append(commands,
+		&command{"verify", "check the artifacts (and the signature) against the manifest written by the deployment", runVerify},
+	)
+}
+
+func runVerify(p *Product, args []string, w io.Writer) error {
+	o := new(options)
+	fs := flagSet("verify", w, o)
+	fs.StringVar(&o.manifestFile, "manifest", "", "path to the manifest of the artifacts (default .manifest.json in the product directory)")
+	fs.BoolVar(&o.requireSig, "require-signature", false, "fail unless the manifest is signed by a trusted key")
+	if err := parse(fs, args); err != nil {
+		return ignoreHelp(err)
+	}
+	a, err := o.answers()
+	if err != nil {
+		return err
+	}
+	var conf *ssh.Config
+	if a != nil {
+		if conf, err = a.SshConfig(); err != nil {
+			return err
+		}
+	}
+	defer utils.DefaultSshPool.Close()
+
+	c := commonData(p, o)
+	path := c.ManifestPath()
+	m, err := deployer.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	keys, err := c.TrustedPublicKeys()
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := m.VerifySignature(keys); err != nil {
+			return err
+		}
+	}
+	if err := m.Verify(conf); err != nil {
+		return err
+	}
+	if m.Signature != nil && len(keys) > 0 {
+		fmt.Fprintf(w, "%d artifacts match %s signed by key %s\n", len(m.Artifacts), path, m.Signature.KeyId)
+		return nil
+	}
+	fmt.Fprintf(w, "%d artifacts match %s\n", len(m.Artifacts), path)
+	return nil
+}
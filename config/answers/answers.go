@@ -0,0 +1,276 @@
+// Parses answers file (XML, YAML or JSON) used for unattended deployments.
+// The answers pre-fill everything that otherwise has to be provided
+// by the user through the dialog based UI.
+
+// Configuration example:
+//
+//<?xml version="1.0" encoding="UTF-8"?>
+//<answers>
+//   <env>Libvirt(KVM)</env>
+//   <remote_mode>true</remote_mode>
+//   <ssh>
+//      <host>192.168.1.10</host>
+//      <port>22</port>
+//      <user>root</user>
+//      <password>secret</password>
+//      <private_key_file></private_key_file>
+//   </ssh>
+//   <export_dir>/var/lib/libvirt/images</export_dir>
+//   <appliance_name>myproduct</appliance_name>
+//   <!-- name of the bundle configuration; empty means custom configuration -->
+//   <bundle>Test2</bundle>
+//   <vm>
+//      <cpus>2</cpus>
+//      <ram_mb>4096</ram_mb>
+//      <disk_mb>10240</disk_mb>
+//   </vm>
+//   <networks>
+//      <network name="Management">
+//         <mode>bridged</mode>
+//         <!-- host port name or PCI address -->
+//         <nic>br0</nic>
+//      </network>
+//      <network name="Traffic">
+//         <nic>0000:03:00.0</nic>
+//         <nic>0000:03:00.1</nic>
+//      </network>
+//   </networks>
+//   <numa>
+//      <vcpu id="0" vnuma="0" cpus="0-3"/>
+//   </numa>
+//   <continue_on_warnings>true</continue_on_warnings>
+//</answers>
+
+package answers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dorzheh/deployer/config/xmlinput"
+	"github.com/dorzheh/deployer/utils"
+	sshconf "github.com/dorzheh/infra/comm/common"
+)
+
+// Answers represents a pre-filled deployment configuration
+type Answers struct {
+	XMLName xml.Name `xml:"answers" json:"-"`
+
+	// Env is the name of the environment to deploy to
+	Env string `xml:"env" json:"env"`
+
+	// RemoteMode indicates whether the deployment occures remotely
+	RemoteMode bool `xml:"remote_mode" json:"remote_mode"`
+
+	// Ssh contains remote host properties (remote mode only)
+	Ssh *Ssh `xml:"ssh" json:"ssh,omitempty"`
+
+	// ExportDir is a directory for storing appropriate artifacts
+	ExportDir string `xml:"export_dir" json:"export_dir"`
+
+	// ApplianceName is the name of the virtual appliance
+	ApplianceName string `xml:"appliance_name" json:"appliance_name"`
+
+	// Bundle is the name of the selected bundle configuration
+	Bundle string `xml:"bundle" json:"bundle"`
+
+	// VM contains virtual machine sizing
+	VM *VM `xml:"vm" json:"vm,omitempty"`
+
+	// Networks contains host NICs selected per network
+	Networks []*Network `xml:"networks>network" json:"networks,omitempty"`
+
+	// NUMA contains vCPU affinity overrides
+	NUMA []*VCPUPin `xml:"numa>vcpu" json:"numa,omitempty"`
+
+	// ContinueOnWarnings allows to proceed in cases the dialog
+	// based UI asks user for a confirmation
+	ContinueOnWarnings bool `xml:"continue_on_warnings" json:"continue_on_warnings"`
+}
+
+type Ssh struct {
+	Host        string `xml:"host" json:"host"`
+	Port        string `xml:"port" json:"port"`
+	User        string `xml:"user" json:"user"`
+	Password    string `xml:"password,omitempty" json:"password,omitempty"`
+	PrvtKeyFile string `xml:"private_key_file,omitempty" json:"private_key_file,omitempty"`
+}
+
+type VM struct {
+	CPUs    int   `xml:"cpus" json:"cpus"`
+	RamMb   int   `xml:"ram_mb" json:"ram_mb"`
+	DisksMb []int `xml:"disk_mb" json:"disk_mb,omitempty"`
+}
+
+type Network struct {
+	Name string                  `xml:"name,attr" json:"name"`
+	Mode xmlinput.ConnectionMode `xml:"mode,omitempty" json:"mode,omitempty"`
+	NICs []string                `xml:"nic" json:"nics"`
+}
+
+type VCPUPin struct {
+	VCPU  int    `xml:"id,attr" json:"vcpu"`
+	VNUMA int    `xml:"vnuma,attr" json:"vnuma"`
+	CPUs  string `xml:"cpus,attr" json:"cpus"`
+}
+
+// ParseFile is responsible for reading appropriate answers file.
+// The format is chosen by the file extension (see utils.FormatOf).
+func ParseFile(path string) (*Answers, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	a, err := ParseFormat(fb, utils.FormatOf(path))
+	if err != nil {
+		return nil, utils.FormatError(fmt.Errorf("%s: %w", path, err))
+	}
+	return a, nil
+}
+
+// Parse is responsible for processing answers content (JSON or XML)
+func Parse(fb []byte, isJson bool) (*Answers, error) {
+	if isJson {
+		return ParseFormat(fb, utils.FormatJSON)
+	}
+	return ParseFormat(fb, utils.FormatXML)
+}
+
+// ParseFormat is responsible for processing answers content of the given format.
+// JSON is decoded according to the json tags, XML and YAML share
+// the schema of the XML (see utils.Load).
+func ParseFormat(fb []byte, format utils.Format) (*Answers, error) {
+	a := new(Answers)
+	if format == utils.FormatJSON {
+		if err := json.Unmarshal(fb, a); err != nil {
+			return nil, utils.FormatError(err)
+		}
+	} else if err := utils.Load(fb, format, a); err != nil {
+		return nil, err
+	}
+	if err := a.Verify(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return a, nil
+}
+
+// WriteFile stores the answers in a file that can be replayed by ParseFile.
+// Files with ".json" extension are written as JSON, otherwise XML is used
+// (the answers cannot be written as YAML).
+// The file might contain SSH password and therefore is readable by owner only
+func (a *Answers) WriteFile(path string) error {
+	var fb []byte
+	var err error
+	switch utils.FormatOf(path) {
+	case utils.FormatJSON:
+		fb, err = json.MarshalIndent(a, "", "   ")
+	case utils.FormatYAML:
+		return utils.FormatError(fmt.Errorf("answers: %s: recording to YAML is not supported", path))
+	default:
+		fb, err = xml.MarshalIndent(a, "", "   ")
+		fb = append([]byte(xml.Header), fb...)
+	}
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	if err := ioutil.WriteFile(path, append(fb, '\n'), 0600); err != nil {
+		return utils.FormatError(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// SshConfig returns ssh configuration or nil in case
+// the deployment is not remote
+func (a *Answers) SshConfig() (*sshconf.Config, error) {
+	if !a.RemoteMode {
+		return nil, nil
+	}
+	if a.Ssh == nil {
+		return nil, errors.New("answers: remote mode requires ssh configuration")
+	}
+	cfg := &sshconf.Config{
+		Host:        a.Ssh.Host,
+		Port:        a.Ssh.Port,
+		User:        a.Ssh.User,
+		Password:    a.Ssh.Password,
+		PrvtKeyFile: a.Ssh.PrvtKeyFile,
+	}
+	if cfg.Port == "" {
+		cfg.Port = "22"
+	}
+	if cfg.User == "" {
+		cfg.User = "root"
+	}
+	return cfg, nil
+}
+
+// Network returns answers related to a given network or nil
+func (a *Answers) Network(name string) *Network {
+	for _, n := range a.Networks {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// Verify validates the answers
+func (a *Answers) Verify() error {
+	if a.RemoteMode {
+		if a.Ssh == nil {
+			return errors.New("answers: remote mode requires ssh configuration")
+		}
+		if !validHost(a.Ssh.Host) {
+			return errors.New("answers: invalid host " + a.Ssh.Host)
+		}
+		if a.Ssh.Port != "" {
+			port, err := strconv.Atoi(a.Ssh.Port)
+			if err != nil || port < 1 || port > 65535 {
+				return errors.New("answers: invalid SSH port " + a.Ssh.Port)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, n := range a.Networks {
+		if n.Name == "" {
+			return errors.New("answers: network name is empty")
+		}
+		if seen[n.Name] {
+			return errors.New("answers: network " + n.Name + " is defined more than once")
+		}
+		seen[n.Name] = true
+	}
+	return nil
+}
+
+// validHost returns true if the host is either IP address or DNS name
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
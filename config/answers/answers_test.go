@@ -0,0 +1,190 @@
+package answers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var xmldata = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<answers>
+   <env>Libvirt(KVM)</env>
+   <remote_mode>true</remote_mode>
+   <ssh>
+      <host>192.168.1.10</host>
+      <user>deployer</user>
+      <password>secret</password>
+   </ssh>
+   <export_dir>/var/lib/libvirt/images</export_dir>
+   <appliance_name>myproduct</appliance_name>
+   <vm>
+      <cpus>2</cpus>
+      <ram_mb>4096</ram_mb>
+      <disk_mb>10240</disk_mb>
+      <disk_mb>20480</disk_mb>
+   </vm>
+   <networks>
+      <network name="Management">
+         <mode>bridged</mode>
+         <nic>br0</nic>
+      </network>
+      <network name="Traffic">
+         <nic>0000:03:00.0</nic>
+         <nic>0000:03:00.1</nic>
+      </network>
+   </networks>
+   <numa>
+      <vcpu id="1" vnuma="0" cpus="0-3"/>
+   </numa>
+   <continue_on_warnings>true</continue_on_warnings>
+</answers>`)
+
+var jsondata = []byte(`{
+	"env": "OpenXen",
+	"export_dir": "/var/lib/xen",
+	"bundle": "Test2",
+	"vm": {"cpus": 2, "disk_mb": [10240]},
+	"networks": [{"name": "Management", "nics": ["br0"]}]
+}`)
+
+func TestParseXML(t *testing.T) {
+	a, err := Parse(xmldata, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Env != "Libvirt(KVM)" || !a.RemoteMode || a.ExportDir != "/var/lib/libvirt/images" {
+		t.Fatalf("unexpected answers %+v", a)
+	}
+	if a.VM == nil || a.VM.CPUs != 2 || a.VM.RamMb != 4096 || len(a.VM.DisksMb) != 2 {
+		t.Fatalf("unexpected VM configuration %+v", a.VM)
+	}
+	if n := a.Network("Traffic"); n == nil || len(n.NICs) != 2 {
+		t.Fatalf("unexpected network configuration %+v", n)
+	}
+	if n := a.Network("Management"); n == nil || n.Mode != "bridged" {
+		t.Fatalf("unexpected network configuration %+v", n)
+	}
+	if len(a.NUMA) != 1 || a.NUMA[0].VCPU != 1 || a.NUMA[0].CPUs != "0-3" {
+		t.Fatalf("unexpected NUMA configuration %+v", a.NUMA)
+	}
+
+	conf, err := a.SshConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Port != "22" || conf.User != "deployer" {
+		t.Fatalf("unexpected ssh configuration %+v", conf)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	a, err := Parse(jsondata, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Env != "OpenXen" || a.Bundle != "Test2" || a.RemoteMode {
+		t.Fatalf("unexpected answers %+v", a)
+	}
+	if a.VM == nil || len(a.VM.DisksMb) != 1 {
+		t.Fatalf("unexpected VM configuration %+v", a.VM)
+	}
+	conf, err := a.SshConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf != nil {
+		t.Fatal("ssh configuration is not expected in local mode")
+	}
+	if _, err := Parse([]byte(`{"remote_mode": true, "ssh": {"host": "kvm1.example.com"}}`), true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseBad(t *testing.T) {
+	for _, data := range []string{
+		`{"remote_mode": true}`,
+		`{"remote_mode": true, "ssh": {"host": "not a host"}}`,
+		`{"remote_mode": true, "ssh": {"host": "-kvm1.example.com"}}`,
+		`{"remote_mode": true, "ssh": {"host": "10.0.0.1", "port": "70000"}}`,
+		`{"networks": [{"name": "A"}, {"name": "A"}]}`,
+	} {
+		if _, err := Parse([]byte(data), true); err == nil {
+			t.Fatalf("%s supposed to produce an error", data)
+		}
+	}
+}
+
+var yamldata = []byte(`env: Libvirt(KVM)
+remote_mode: true
+ssh:
+  host: kvm1.example.com
+  user: deployer
+vm:
+  cpus: 2
+  disk_mb: [10240, 20480]
+networks:
+  network:
+    - name: Management
+      nic: [br0]
+`)
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "answers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string][]byte{"answers.xml": xmldata, "answers.json": jsondata, "answers.yaml": yamldata} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		a, err := ParseFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if n := a.Network("Management"); n == nil || n.NICs[0] != "br0" {
+			t.Fatalf("%s: unexpected networks %+v", name, a.Networks)
+		}
+	}
+
+	// the YAML is not parsed as XML
+	path := filepath.Join(dir, "bad.yaml")
+	if err := ioutil.WriteFile(path, []byte("ssh: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(path); err == nil || strings.Contains(err.Error(), "XML") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	a, err := Parse(xmldata, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "answers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"answers.xml", "answers.json"} {
+		path := filepath.Join(dir, name)
+		if err := a.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.XMLName = a.XMLName
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("%s: expected %+v, got %+v", name, a, b)
+		}
+	}
+}
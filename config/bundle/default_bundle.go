@@ -20,20 +20,20 @@ import (
 //   <config>
 // 		<name>Test1</name>
 // 		<cpus>2</cpus>
-//      <ram>4096</ram>
+//      <ram_mb>4096</ram_mb>
 //      <!-- storage configuration index -->
 //      <storage_config_index>0</storage_config_index>
 //   </config>
 //   <config>
 // 	     <name>Test2</name>
 // 	     <cpus>2</cpus>
-// 	     <ram>8192</ram>
+// 	     <ram_mb>8192</ram_mb>
 // 	     <storage_config_index>1</storage_config_index>
 //   </config>
 //   <config>
 // 	     <name>Test3</name>
 // 	     <cpus>8</cpus>
-//        <ram>16384</ram>
+//        <ram_mb>16384</ram_mb>
 //        <storage_config_index>2</storage_config_index>
 //   </config>
 //   <advanced_config>true</advanced_config>
@@ -41,9 +41,9 @@ import (
 //
 
 type Config struct {
-	Name               string            `xml:"name"`
-	CPUs               int               `xml:"cpus"`
-	RAM                int               `xml:"ram_mb"`
+	Name               string            `xml:"name" validate:"required"`
+	CPUs               int               `xml:"cpus" validate:"required,min=1"`
+	RAM                int               `xml:"ram_mb" validate:"required,min=1"`
 	StorageConfigIndex image.ConfigIndex `xml:"storage_config_index"`
 }
 
@@ -68,6 +68,9 @@ func (b *DefaultBundle) Parse(d *deployer.CommonData, hidriver deployer.Hostinfo
 	if err != nil {
 		return nil, utils.FormatError(err)
 	}
+	if d.Answers != nil {
+		return b.answersConfig(d, configs, installedCpus)
+	}
 	for {
 		c, err := uiBundleConfig(d.Ui, configs, b.AdvancedConfig)
 		if err != nil {
@@ -80,17 +83,45 @@ func (b *DefaultBundle) Parse(d *deployer.CommonData, hidriver deployer.Hostinfo
 			if !ui.UiVCPUsOvercommit(d.Ui, installedCpus) {
 				continue
 			}
+			if d.Record != nil {
+				d.Record.ContinueOnWarnings = true
+			}
 		}
-		m := make(map[string]interface{})
-		m["name"] = c.Name
-		m["cpus"] = c.CPUs
-		m["ram_mb"] = c.RAM
-		m["storage_config_index"] = c.StorageConfigIndex
-		return m, nil
+		return configToMap(c), nil
 	}
 	return nil, nil
 }
 
+// answersConfig selects bundle configuration by the name provided by answers.
+// Empty name stands for custom configuration
+func (b *DefaultBundle) answersConfig(d *deployer.CommonData, configs []*Config, installedCpus int) (map[string]interface{}, error) {
+	if d.Answers.Bundle == "" {
+		if !b.AdvancedConfig {
+			return nil, utils.FormatError(errors.New("answers: bundle is not set and custom configuration is not allowed"))
+		}
+		return nil, nil
+	}
+	for _, c := range configs {
+		if c.Name != d.Answers.Bundle {
+			continue
+		}
+		if c.CPUs > installedCpus && !d.Answers.ContinueOnWarnings {
+			return nil, utils.FormatError(fmt.Errorf("The host only has %d CPUs.Overcommitting vCPUs can reduce performance!", installedCpus))
+		}
+		return configToMap(c), nil
+	}
+	return nil, utils.FormatError(fmt.Errorf("answers: bundle configuration \"%s\" is not eligable for the host", d.Answers.Bundle))
+}
+
+func configToMap(c *Config) map[string]interface{} {
+	m := make(map[string]interface{})
+	m["name"] = c.Name
+	m["cpus"] = c.CPUs
+	m["ram_mb"] = c.RAM
+	m["storage_config_index"] = c.StorageConfigIndex
+	return m
+}
+
 func (b *DefaultBundle) getConfigs(ramsizeMb int) []*Config {
 	configs := make([]*Config, 0)
 	for _, c := range b.Configs {
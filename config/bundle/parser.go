@@ -22,11 +22,10 @@ func NewParser(bundleConfigFile string, s BundleStrategy) (*Parser, error) {
 		return nil, utils.FormatError(errors.New("bundle strategy is nil"))
 	}
 
-	data, err := utils.ParseXMLFile(bundleConfigFile, s)
-	if err != nil {
+	if err := utils.LoadFile(bundleConfigFile, s); err != nil {
 		return nil, utils.FormatError(err)
 	}
-	return &Parser{s, data}, nil
+	return &Parser{s, s}, nil
 }
 
 func (p *Parser) Parse(d *deployer.CommonData, hidriver deployer.HostinfoDriver, xid *xmlinput.XMLInputData) (map[string]interface{}, error) {
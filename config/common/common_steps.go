@@ -3,7 +3,12 @@
 package common
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+
 	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/config/answers"
 	"github.com/dorzheh/deployer/controller"
 	"github.com/dorzheh/deployer/deployer"
 	gui "github.com/dorzheh/deployer/ui"
@@ -19,30 +24,83 @@ func RegisterSteps(d *deployer.CommonData, storageConfigFile string) (*deployer.
 		return nil, utils.FormatError(err)
 	}
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			var err error
-			c.RemoteMode, err = gui.UiRemoteMode(d.Ui)
-			return err
+			if d.Answers != nil {
+				c.RemoteMode = d.Answers.RemoteMode
+				if c.RemoteMode {
+					if _, err := exec.LookPath("sshfs"); err != nil {
+						return utils.FormatError(errors.New("sshfs utility is not installed"))
+					}
+				}
+				return nil
+			}
+			if c.RemoteMode, err = gui.UiRemoteMode(d.Ui); err != nil {
+				return err
+			}
+			if d.Record != nil {
+				d.Record.RemoteMode = c.RemoteMode
+				d.Record.Ssh = nil
+			}
+			return nil
 		}
 	}())
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			var err error
 			if c.RemoteMode {
-				c.SshConfig, err = gui.UiSshConfig(d.Ui)
-				return err
+				if d.Answers != nil {
+					if c.SshConfig, err = d.Answers.SshConfig(); err != nil {
+						return utils.FormatError(err)
+					}
+					// verifying that the remote host is reachable over SSH
+					if _, err = utils.Run(utils.NewExecutor(c.SshConfig), "uname"); err != nil {
+						return utils.FormatError(errors.New("unable to establish SSH connection to " + c.SshConfig.Host))
+					}
+					return nil
+				}
+				if c.SshConfig, err = gui.UiSshConfig(d.Ui); err != nil {
+					return err
+				}
+				if d.Record != nil {
+					d.Record.Ssh = &answers.Ssh{
+						Host:        c.SshConfig.Host,
+						Port:        c.SshConfig.Port,
+						User:        c.SshConfig.User,
+						Password:    c.SshConfig.Password,
+						PrvtKeyFile: c.SshConfig.PrvtKeyFile,
+					}
+				}
+				return nil
 			}
 			return controller.SkipStep
 		}
 	}())
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			var err error
-			c.ExportDir, err = gui.UiImagePath(d.Ui, d.DefaultExportDir, c.RemoteMode)
-			return err
+			if d.Answers != nil {
+				c.ExportDir = d.Answers.ExportDir
+				if c.ExportDir == "" {
+					c.ExportDir = d.DefaultExportDir
+				}
+				if !c.RemoteMode {
+					if _, err := os.Stat(c.ExportDir); err != nil {
+						return utils.FormatError(err)
+					}
+				}
+				return nil
+			}
+			if c.ExportDir, err = gui.UiImagePath(d.Ui, d.DefaultExportDir, c.RemoteMode); err != nil {
+				return err
+			}
+			if d.Record != nil {
+				d.Record.ExportDir = c.ExportDir
+			}
+			return nil
 		}
 	}())
 	return c, nil
@@ -0,0 +1,289 @@
+// Parses host inventory (XML, YAML or JSON) used for deploying the appliance
+// to many hosts at once.
+// Every host is deployed remotely using the answers file amended by
+// the overrides of the groups the host belongs to and by its own overrides.
+// The host is reached by its name unless the overrides set ssh.host.
+
+// Inventory example:
+//
+//<?xml version="1.0" encoding="UTF-8"?>
+//<inventory>
+//   <groups>
+//      <group name="lab">
+//         <ssh>
+//            <user>root</user>
+//            <private_key_file>/root/.ssh/id_rsa</private_key_file>
+//         </ssh>
+//         <export_dir>/var/lib/libvirt/images</export_dir>
+//      </group>
+//   </groups>
+//   <hosts>
+//      <host name="kvm1">
+//         <group>lab</group>
+//         <ssh>
+//            <host>192.168.1.10</host>
+//         </ssh>
+//      </host>
+//      <host name="kvm2">
+//         <group>lab</group>
+//         <ssh>
+//            <host>192.168.1.11</host>
+//            <port>2222</port>
+//         </ssh>
+//         <export_dir>/data/images</export_dir>
+//         <networks>
+//            <network name="Management">
+//               <nic>br1</nic>
+//            </network>
+//         </networks>
+//      </host>
+//   </hosts>
+//</inventory>
+
+package inventory
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/utils"
+)
+
+// Inventory represents the hosts the appliance is deployed to
+type Inventory struct {
+	XMLName xml.Name `xml:"inventory" json:"-"`
+
+	// Groups contains the overrides shared by several hosts
+	Groups []*Group `xml:"groups>group" json:"groups,omitempty"`
+
+	// Hosts contains the target hosts
+	Hosts []*Host `xml:"hosts>host" json:"hosts"`
+}
+
+// Overrides represents the answers overridden per group or per host.
+// Empty values are inherited.
+type Overrides struct {
+	// Ssh contains remote host properties
+	Ssh *answers.Ssh `xml:"ssh" json:"ssh,omitempty"`
+
+	// ExportDir is a directory for storing appropriate artifacts
+	ExportDir string `xml:"export_dir,omitempty" json:"export_dir,omitempty"`
+
+	// ApplianceName is the name of the virtual appliance
+	ApplianceName string `xml:"appliance_name,omitempty" json:"appliance_name,omitempty"`
+
+	// VM contains virtual machine sizing
+	VM *answers.VM `xml:"vm" json:"vm,omitempty"`
+
+	// Networks contains host NICs selected per network.
+	// The networks are overridden by name.
+	Networks []*answers.Network `xml:"networks>network" json:"networks,omitempty"`
+}
+
+// Group represents overrides shared by several hosts
+type Group struct {
+	Name string `xml:"name,attr" json:"name"`
+	Overrides
+}
+
+// Host represents a target host
+type Host struct {
+	// Name is a unique name of the host
+	Name string `xml:"name,attr" json:"name"`
+
+	// Groups contains names of the groups the host belongs to.
+	// The overrides of the groups are applied in the given order.
+	Groups []string `xml:"group" json:"groups,omitempty"`
+
+	Overrides
+}
+
+// ParseFile is responsible for reading appropriate inventory file.
+// The format is chosen by the file extension (see utils.FormatOf).
+func ParseFile(path string) (*Inventory, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	inv, err := ParseFormat(fb, utils.FormatOf(path))
+	if err != nil {
+		return nil, utils.FormatError(fmt.Errorf("%s: %w", path, err))
+	}
+	return inv, nil
+}
+
+// Parse is responsible for processing inventory content (JSON or XML)
+func Parse(fb []byte, isJson bool) (*Inventory, error) {
+	if isJson {
+		return ParseFormat(fb, utils.FormatJSON)
+	}
+	return ParseFormat(fb, utils.FormatXML)
+}
+
+// ParseFormat is responsible for processing inventory content of the given format.
+// JSON is decoded according to the json tags, XML and YAML share
+// the schema of the XML (see utils.Load).
+func ParseFormat(fb []byte, format utils.Format) (*Inventory, error) {
+	inv := new(Inventory)
+	if format == utils.FormatJSON {
+		if err := json.Unmarshal(fb, inv); err != nil {
+			return nil, utils.FormatError(err)
+		}
+	} else if err := utils.Load(fb, format, inv); err != nil {
+		return nil, err
+	}
+	if err := inv.verify(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return inv, nil
+}
+
+// Group returns the group by name or nil
+func (inv *Inventory) Group(name string) *Group {
+	for _, g := range inv.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// Select returns the hosts belonging to any of the given groups.
+// All the hosts are returned if no group is given
+func (inv *Inventory) Select(groups ...string) []*Host {
+	if len(groups) == 0 {
+		return inv.Hosts
+	}
+	var hosts []*Host
+	for _, h := range inv.Hosts {
+	loop:
+		for _, hg := range h.Groups {
+			for _, g := range groups {
+				if hg == g {
+					hosts = append(hosts, h)
+					break loop
+				}
+			}
+		}
+	}
+	return hosts
+}
+
+// Answers returns the answers the host is deployed with.
+// The base answers are amended by the overrides of the host groups
+// and by the host overrides; the deployment is always remote.
+// The host is reached by its name unless the overrides set ssh.host.
+func (inv *Inventory) Answers(base *answers.Answers, h *Host) (*answers.Answers, error) {
+	a := new(answers.Answers)
+	if base != nil {
+		*a = *base
+		if base.Ssh != nil {
+			ssh := *base.Ssh
+			a.Ssh = &ssh
+		}
+		a.Networks = append([]*answers.Network(nil), base.Networks...)
+	}
+	a.RemoteMode = true
+	if a.Ssh == nil {
+		a.Ssh = new(answers.Ssh)
+	}
+	// the base host is never inherited, otherwise the hosts
+	// without their own address would be deployed to the same host
+	a.Ssh.Host = h.Name
+
+	for _, name := range h.Groups {
+		g := inv.Group(name)
+		if g == nil {
+			return nil, fmt.Errorf("inventory: host %s refers to unknown group %s", h.Name, name)
+		}
+		g.Overrides.apply(a)
+	}
+	h.Overrides.apply(a)
+
+	if err := a.Verify(); err != nil {
+		return nil, fmt.Errorf("inventory: host %s: %v", h.Name, err)
+	}
+	return a, nil
+}
+
+func (o *Overrides) apply(a *answers.Answers) {
+	if o.Ssh != nil {
+		if o.Ssh.Host != "" {
+			a.Ssh.Host = o.Ssh.Host
+		}
+		if o.Ssh.Port != "" {
+			a.Ssh.Port = o.Ssh.Port
+		}
+		if o.Ssh.User != "" {
+			a.Ssh.User = o.Ssh.User
+		}
+		if o.Ssh.Password != "" {
+			a.Ssh.Password = o.Ssh.Password
+		}
+		if o.Ssh.PrvtKeyFile != "" {
+			a.Ssh.PrvtKeyFile = o.Ssh.PrvtKeyFile
+		}
+	}
+	if o.ExportDir != "" {
+		a.ExportDir = o.ExportDir
+	}
+	if o.ApplianceName != "" {
+		a.ApplianceName = o.ApplianceName
+	}
+	if o.VM != nil {
+		a.VM = o.VM
+	}
+	for _, n := range o.Networks {
+		replaced := false
+		for i, an := range a.Networks {
+			if an.Name == n.Name {
+				a.Networks[i] = n
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			a.Networks = append(a.Networks, n)
+		}
+	}
+}
+
+func (inv *Inventory) verify() error {
+	if len(inv.Hosts) == 0 {
+		return errors.New("inventory: no hosts defined")
+	}
+	groups := make(map[string]bool)
+	for _, g := range inv.Groups {
+		if g.Name == "" {
+			return errors.New("inventory: group name is empty")
+		}
+		if groups[g.Name] {
+			return errors.New("inventory: group " + g.Name + " is defined more than once")
+		}
+		groups[g.Name] = true
+	}
+	hosts := make(map[string]bool)
+	for _, h := range inv.Hosts {
+		if h.Name == "" {
+			return errors.New("inventory: host name is empty")
+		}
+		if strings.ContainsAny(h.Name, "/ ") {
+			return errors.New("inventory: invalid host name " + h.Name)
+		}
+		if hosts[h.Name] {
+			return errors.New("inventory: host " + h.Name + " is defined more than once")
+		}
+		hosts[h.Name] = true
+		for _, g := range h.Groups {
+			if !groups[g] {
+				return fmt.Errorf("inventory: host %s refers to unknown group %s", h.Name, g)
+			}
+		}
+	}
+	return nil
+}
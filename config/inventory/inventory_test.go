@@ -0,0 +1,168 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dorzheh/deployer/config/answers"
+)
+
+var xmldata = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<inventory>
+   <groups>
+      <group name="lab">
+         <ssh>
+            <user>deployer</user>
+            <password>secret</password>
+         </ssh>
+         <export_dir>/var/lib/libvirt/images</export_dir>
+      </group>
+   </groups>
+   <hosts>
+      <host name="kvm1">
+         <group>lab</group>
+         <ssh>
+            <host>192.168.1.10</host>
+         </ssh>
+      </host>
+      <host name="kvm2">
+         <group>lab</group>
+         <ssh>
+            <host>192.168.1.11</host>
+            <port>2222</port>
+         </ssh>
+         <export_dir>/data/images</export_dir>
+         <networks>
+            <network name="Management">
+               <nic>br1</nic>
+            </network>
+         </networks>
+      </host>
+      <host name="kvm3">
+         <ssh>
+            <host>192.168.1.12</host>
+         </ssh>
+      </host>
+   </hosts>
+</inventory>`)
+
+func TestParseXML(t *testing.T) {
+	inv, err := Parse(xmldata, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Hosts) != 3 || len(inv.Groups) != 1 {
+		t.Fatalf("unexpected inventory %+v", inv)
+	}
+	if hosts := inv.Select("lab"); len(hosts) != 2 || hosts[1].Name != "kvm2" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if hosts := inv.Select(); len(hosts) != 3 {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestAnswers(t *testing.T) {
+	inv, err := Parse(xmldata, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := &answers.Answers{
+		Env:       "Libvirt(KVM)",
+		ExportDir: "/tmp",
+		Networks: []*answers.Network{
+			{Name: "Management", NICs: []string{"br0"}},
+			{Name: "Traffic", NICs: []string{"0000:03:00.0"}},
+		},
+	}
+
+	a, err := inv.Answers(base, inv.Hosts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.RemoteMode || a.Ssh.Host != "192.168.1.11" || a.Ssh.Port != "2222" || a.Ssh.User != "deployer" {
+		t.Fatalf("unexpected ssh configuration %+v", a.Ssh)
+	}
+	if a.ExportDir != "/data/images" {
+		t.Fatalf("unexpected export dir %s", a.ExportDir)
+	}
+	if n := a.Network("Management"); n == nil || n.NICs[0] != "br1" {
+		t.Fatalf("unexpected network %+v", n)
+	}
+	if n := a.Network("Traffic"); n == nil || n.NICs[0] != "0000:03:00.0" {
+		t.Fatalf("unexpected network %+v", n)
+	}
+
+	// the base answers are not modified
+	if base.ExportDir != "/tmp" || base.Ssh != nil || base.Network("Management").NICs[0] != "br0" {
+		t.Fatalf("base answers modified %+v", base)
+	}
+
+	a, err = inv.Answers(base, inv.Hosts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Ssh.Host != "192.168.1.12" || a.Ssh.User != "" || a.ExportDir != "/tmp" {
+		t.Fatalf("unexpected answers %+v", a)
+	}
+}
+
+func TestAnswersBaseHost(t *testing.T) {
+	inv, err := Parse([]byte(`{"hosts": [{"name": "kvm1.example.com"}, {"name": "kvm2.example.com"}]}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := &answers.Answers{
+		Env:       "Libvirt(KVM)",
+		ExportDir: "/tmp",
+		Ssh:       &answers.Ssh{Host: "10.0.0.1", User: "deployer"},
+	}
+	for _, h := range inv.Hosts {
+		a, err := inv.Answers(base, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every host is deployed to on its own
+		if a.Ssh.Host != h.Name || a.Ssh.User != "deployer" {
+			t.Fatalf("unexpected ssh configuration %+v", a.Ssh)
+		}
+	}
+	if base.Ssh.Host != "10.0.0.1" {
+		t.Fatalf("base answers modified %+v", base.Ssh)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "inventory.yaml")
+	data := "groups:\n  group:\n    - name: lab\n      export_dir: /data\nhosts:\n  host:\n    - name: kvm1\n      group: [lab]\n    - name: kvm2\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := inv.Select("lab"); len(inv.Hosts) != 2 || len(hosts) != 1 || hosts[0].Name != "kvm1" {
+		t.Fatalf("unexpected inventory %+v", inv)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"hosts": []}`,
+		`{"hosts": [{"name": "kvm1"}, {"name": "kvm1"}]}`,
+		`{"hosts": [{"name": "kvm1", "groups": ["lab"]}]}`,
+	} {
+		if _, err := Parse([]byte(data), true); err == nil {
+			t.Fatalf("%s: error expected", data)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package metadata
 import (
 	// "errors"
 	"errors"
-	"fmt"
 	"github.com/dorzheh/deployer/builder/image"
 	"github.com/dorzheh/deployer/config"
 	"github.com/dorzheh/deployer/config/bundle"
@@ -100,13 +99,26 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 		return utils.FormatError(err)
 	}
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			var err error
+			if d.Answers != nil {
+				if c.Metadata.DomainName, err = applianceName(d.Answers, d.VaName, c.EnvDriver); err != nil {
+					return utils.FormatError(err)
+				}
+				d.VaName = c.Metadata.DomainName
+				if err = c.Hwdriver.Init(); err != nil {
+					return utils.FormatError(err)
+				}
+				return nil
+			}
 			if c.Metadata.DomainName, err = gui.UiApplianceName(d.Ui, d.VaName, c.EnvDriver); err != nil {
 				return err
 			}
 			d.VaName = c.Metadata.DomainName
+			if d.Record != nil {
+				d.Record.ApplianceName = c.Metadata.DomainName
+			}
 			if err = gui.UiGatherHWInfo(d.Ui, c.Hwdriver, c.RemoteMode); err != nil {
 				return utils.FormatError(err)
 			}
@@ -116,7 +128,7 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 
 	// Network configuration
 	if xid.Networks.Configure {
-		controller.RegisterSteps(func() func() error {
+		d.Steps.Register(func() func() error {
 			return func() error {
 				c.GuestConfig.Networks = nil
 				c.GuestConfig.NICLists = nil
@@ -125,8 +137,17 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 				if err != nil {
 					return utils.FormatError(err)
 				}
-				if err = gui.UiNetworks(d.Ui, xid, nics, c.GuestConfig); err != nil {
-					return err
+				if d.Answers != nil {
+					if err = selectNICs(d.Answers, xid, nics, c.GuestConfig); err != nil {
+						return utils.FormatError(err)
+					}
+				} else {
+					if err = gui.UiNetworks(d.Ui, xid, nics, c.GuestConfig); err != nil {
+						return err
+					}
+					if d.Record != nil {
+						recordNICs(d.Record, c.GuestConfig)
+					}
 				}
 				c.Metadata.Networks, err = metaconf.SetNetworkData(c.GuestConfig, i.TemplatesDir, nil)
 				if err != nil {
@@ -138,13 +159,20 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 	}
 
 	// guest configuration
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			if i.BundleParser != nil {
 				m, err := i.BundleParser.Parse(d, c.Hwdriver, xid)
 				if err != nil {
 					return utils.FormatError(err)
 				}
+				if d.Record != nil {
+					d.Record.Bundle = ""
+					d.Record.VM = nil
+					if m != nil {
+						d.Record.Bundle = m["name"].(string)
+					}
+				}
 				if m != nil {
 					c.Bundle = m
 					c.GuestConfig.CPUs = m["cpus"].(int)
@@ -160,8 +188,24 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 				if xid.CPU.Max == xmlinput.UnlimitedAlloc {
 					xid.CPU.Max = c.EnvDriver.MaxVCPUsPerGuest()
 				}
-				if err = gui.UiVmConfig(d.Ui, c.Hwdriver, xid, filepath.Join(c.ExportDir, d.VaName), c.StorageConfig, c.GuestConfig); err != nil {
-					return err
+				if d.Answers != nil {
+					if err = vmConfig(d.Answers, c.Hwdriver, xid, filepath.Join(c.ExportDir, d.VaName), c.StorageConfig, c.GuestConfig); err != nil {
+						return utils.FormatError(err)
+					}
+				} else {
+					if err = gui.UiVmConfig(d.Ui, c.Hwdriver, xid, filepath.Join(c.ExportDir, d.VaName), c.StorageConfig, c.GuestConfig); err != nil {
+						return err
+					}
+					if d.Record != nil {
+						recordVM(d.Record, c.GuestConfig)
+						installedCpus, err := c.Hwdriver.CPUs()
+						if err != nil {
+							return utils.FormatError(err)
+						}
+						if c.GuestConfig.CPUs > installedCpus {
+							d.Record.ContinueOnWarnings = true
+						}
+					}
 				}
 			}
 
@@ -182,7 +226,7 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 	}())
 
 	// NUMA configuration
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			// file, err := os.Create("/tmp/x.txt")
 			// defer file.Close()
@@ -199,8 +243,8 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 						return utils.FormatError(err)
 					}
 					if !pinned {
-						if !gui.UiWarningOnOptimizationFailure(d.Ui, "Not all the virtual machines on the host are configured with CPU pinning.") {
-							os.Exit(0)
+						if err := warning(d, "Not all the virtual machines on the host are configured with CPU pinning."); err != nil {
+							return err
 						}
 					}
 				}
@@ -217,8 +261,8 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 					}
 					if c.GuestConfig.OptimizationFailureMsg != "" {
 						// file.WriteString("RegisterSteps() c.GuestConfig.OptimizationFailureMsg  " + c.GuestConfig.OptimizationFailureMsg + "\n")
-						if !gui.UiWarningOnOptimizationFailure(d.Ui, c.GuestConfig.OptimizationFailureMsg) {
-							os.Exit(0)
+						if err := warning(d, c.GuestConfig.OptimizationFailureMsg); err != nil {
+							return err
 						}
 					}
 				}
@@ -228,18 +272,43 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 				}
 			}
 
-			processNext, err := gui.UiNumaRamNotOK(d.Ui, c.Hwdriver, c.GuestConfig, c.GuestConfig.RamMb)
+			if d.Answers != nil {
+				if msg := c.GuestConfig.NUMARamWarning(numas, c.GuestConfig.RamMb); msg != "" && !d.Answers.ContinueOnWarnings {
+					return utils.FormatError(errors.New(msg))
+				}
+				cpus, err := c.Hwdriver.CPUs()
+				if err != nil {
+					return utils.FormatError(err)
+				}
+				isChanged, err := numaTopology(d.Answers, c.GuestConfig, cpus)
+				if err != nil {
+					return utils.FormatError(err)
+				}
+				if isChanged {
+					if err := c.GuestConfig.ReconfigureMultipleVirtualNUMAs(numas); err != nil {
+						return utils.FormatError(err)
+					}
+				}
+			} else {
+				processNext, err := gui.UiNumaRamNotOK(d.Ui, c.Hwdriver, c.GuestConfig, c.GuestConfig.RamMb)
 
-			if processNext != true {
+				if processNext != true {
 
-				return errors.New(dialog_ui.DialogMoveBack)
-			}
-			if err != nil {
-				// file.WriteString("RegisterSteps() err != nil 1 \n")
-				return utils.FormatError(err)
+					return dialog_ui.ErrMoveBack
+				}
+				if err != nil {
+					// file.WriteString("RegisterSteps() err != nil 1 \n")
+					return utils.FormatError(err)
+				}
+				if d.Record != nil {
+					d.Record.NUMA = nil
+					if c.GuestConfig.NUMARamWarning(numas, c.GuestConfig.RamMb) != "" {
+						d.Record.ContinueOnWarnings = true
+					}
+				}
 			}
 			// file.WriteString("RegisterSteps() xid.UiEditNUMAConfig  \n")
-			if xid.UiEditNUMAConfig {
+			if xid.UiEditNUMAConfig && d.Answers == nil {
 				cpus, err := c.Hwdriver.CPUs()
 				// file.WriteString("RegisterSteps() c.Hwdriver.CPUs() \n")
 				if err != nil {
@@ -252,6 +321,9 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 					// file.WriteString("RegisterSteps() err !=nil gui.UiNUMATopology " + err.Error() + " \n")
 					return err
 				}
+				if isChanged && d.Record != nil {
+					recordNUMA(d.Record, c.GuestConfig)
+				}
 				if isChanged {
 					// err := errors.New("CPU j is assigned to more than one vCPU")
 					// return utils.FormatError(err)
@@ -291,11 +363,31 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 	}())
 
 	// create default metadata
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
-			c.DestMetadataFile = fmt.Sprintf("/tmp/%s-temp-metadata.%d", d.VaName, os.Getpid())
-			// always create default metadata
-			if err := ioutil.WriteFile(c.DestMetadataFile, metaconf.DefaultMetadata(), 0); err != nil {
+			// always create default metadata.
+			// The file is unique, so the deployments running simultaneously
+			// (see MultiHost) don't share it
+			f, err := ioutil.TempFile("", d.VaName+"-temp-metadata.")
+			if err != nil {
+				return utils.FormatError(err)
+			}
+			path := f.Name()
+			d.Transaction.RecordTemporary("remove "+path, func() error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return utils.FormatError(err)
+				}
+				return nil
+			})
+			_, err = f.Write(metaconf.DefaultMetadata())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return utils.FormatError(err)
+			}
+			c.DestMetadataFile = path
+			if err := report(d.Report, c); err != nil {
 				return utils.FormatError(err)
 			}
 			return controller.SkipStep
@@ -305,6 +397,25 @@ func RegisterSteps(d *deployer.CommonData, i *InputData, c *Config, metaconf dep
 	return nil
 }
 
+// warning asks user whether to proceed in spite of the warning.
+// In case of unattended deployment returns error unless the answers
+// allow to continue on warnings
+func warning(d *deployer.CommonData, msg string) error {
+	if d.Answers != nil {
+		if d.Answers.ContinueOnWarnings {
+			return nil
+		}
+		return utils.FormatError(errors.New(msg))
+	}
+	if !gui.UiWarningOnOptimizationFailure(d.Ui, msg) {
+		os.Exit(0)
+	}
+	if d.Record != nil {
+		d.Record.ContinueOnWarnings = true
+	}
+	return nil
+}
+
 func ProcessNetworkTemplate(mode *xmlinput.Mode, defaultTemplate string, tmpltData interface{}, templatesDir string) (string, error) {
 	var customTemplate string
 
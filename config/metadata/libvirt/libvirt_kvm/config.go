@@ -35,10 +35,10 @@ func CreateConfig(d *deployer.CommonData, i *metadata.InputData) (*metadata.Conf
 		return nil, utils.FormatError(err)
 	}
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			var err error
-			m.Hwdriver, err = hwinfodriver.NewHostinfoDriver(m.SshConfig, i.Lshw, filepath.Join(d.RootDir, ".hwinfo.json"))
+			m.Hwdriver, err = hwinfodriver.NewHostinfoDriver(m.SshConfig, i.Lshw, d.HwinfoFile())
 			if err != nil {
 				return utils.FormatError(err)
 			}
@@ -0,0 +1,78 @@
+package metadata
+
+// Helpers recording the configuration selected through the dialog
+// based UI, so that the session can be replayed by answers file.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+)
+
+// recordNICs records host NICs selected per network
+func recordNICs(a *answers.Answers, gconf *guest.Config) {
+	a.Networks = nil
+	for i, net := range gconf.Networks {
+		anet := &answers.Network{Name: net.Name}
+		for _, gnic := range gconf.NICLists[i] {
+			if gnic.HostNIC.PCIAddr != "" && gnic.HostNIC.PCIAddr != "N/A" {
+				anet.NICs = append(anet.NICs, gnic.HostNIC.PCIAddr)
+			} else {
+				anet.NICs = append(anet.NICs, gnic.HostNIC.Name)
+			}
+		}
+		a.Networks = append(a.Networks, anet)
+	}
+}
+
+// recordVM records guest CPUs, RAM and disk sizes
+func recordVM(a *answers.Answers, gconf *guest.Config) {
+	a.VM = &answers.VM{CPUs: gconf.CPUs, RamMb: gconf.RamMb}
+	if gconf.Storage != nil {
+		for _, disk := range gconf.Storage.Disks {
+			a.VM.DisksMb = append(a.VM.DisksMb, disk.SizeMb)
+		}
+	}
+}
+
+// recordNUMA records vCPU affinity of every virtual NUMA
+func recordNUMA(a *answers.Answers, gconf *guest.Config) {
+	a.NUMA = nil
+	for vnuma, n := range gconf.NUMAs {
+		var vcpus []int
+		for vcpu := range n.CPUPin {
+			vcpus = append(vcpus, vcpu)
+		}
+		sort.Ints(vcpus)
+		for _, vcpu := range vcpus {
+			a.NUMA = append(a.NUMA, &answers.VCPUPin{
+				VCPU:  vcpu,
+				VNUMA: vnuma,
+				CPUs:  cpuListString(n.CPUPin[vcpu]),
+			})
+		}
+	}
+}
+
+// cpuListString represents a list of CPUs as "0-3,8"
+func cpuListString(cpus []int) string {
+	sorted := append([]int(nil), cpus...)
+	sort.Ints(sorted)
+	var ranges []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			ranges = append(ranges, fmt.Sprintf("%d", sorted[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
@@ -0,0 +1,57 @@
+package metadata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+)
+
+func TestCPUListString(t *testing.T) {
+	for list, cpus := range map[string][]int{
+		"0-3,8":   {3, 2, 1, 0, 8},
+		"1":       {1},
+		"0,2,4-5": {0, 2, 4, 5},
+	} {
+		if s := cpuListString(cpus); s != list {
+			t.Fatalf("expected %s, got %s", list, s)
+		}
+		parsed, err := parseCPUList(list, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cpuListString(parsed) != list {
+			t.Fatalf("%s: round trip failed", list)
+		}
+	}
+}
+
+func TestRecordNUMA(t *testing.T) {
+	gconf := guest.NewConfig()
+	gconf.CPUs = 3
+	gconf.NUMAs = []*guest.NUMA{
+		{CellID: 0, CPUPin: map[int][]int{0: {0, 1}, 1: {2}}},
+		{CellID: 1, CPUPin: map[int][]int{2: {8, 9, 10}}},
+	}
+	a := new(answers.Answers)
+	recordNUMA(a, gconf)
+
+	expected := []*answers.VCPUPin{
+		{VCPU: 0, VNUMA: 0, CPUs: "0-1"},
+		{VCPU: 1, VNUMA: 0, CPUs: "2"},
+		{VCPU: 2, VNUMA: 1, CPUs: "8-10"},
+	}
+	if !reflect.DeepEqual(a.NUMA, expected) {
+		t.Fatalf("unexpected NUMA answers %+v", a.NUMA)
+	}
+
+	// replaying recorded answers must result in the same topology
+	gconf.NUMAs[1].CPUPin[2] = []int{0}
+	if _, err := numaTopology(a, gconf, 16); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gconf.NUMAs[1].CPUPin[2], []int{8, 9, 10}) {
+		t.Fatalf("unexpected vCPU pinning %v", gconf.NUMAs[1].CPUPin[2])
+	}
+}
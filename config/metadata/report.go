@@ -0,0 +1,18 @@
+package metadata
+
+import (
+	"github.com/dorzheh/deployer/deployer"
+)
+
+// report records the host hardware, the selected bundle, the final guest
+// configuration and the environment driver version
+func report(r *deployer.Report, c *Config) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.SetHardware(c.Hwdriver); err != nil {
+		return err
+	}
+	r.SetGuest(c.Bundle, c.GuestConfig)
+	return r.SetDriver(c.EnvDriver)
+}
@@ -0,0 +1,242 @@
+package metadata
+
+// Unattended counterparts of the dialog based configuration steps.
+// The functions are driven by answers file and report validation
+// failures as errors.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/config"
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/config/xmlinput"
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/host_hwfilter"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+	"github.com/dorzheh/deployer/utils/hwinfo/host"
+)
+
+// applianceName returns the appliance name provided by answers or the default one
+func applianceName(a *answers.Answers, defaultName string, driver deployer.EnvDriver) (string, error) {
+	name := a.ApplianceName
+	if name == "" {
+		name = defaultName
+	}
+	if name == "" {
+		return "", errors.New("answers: appliance name is empty")
+	}
+	name = strings.Replace(name, ".", "-", -1)
+	if driver != nil && driver.DomainExists(name) {
+		return "", fmt.Errorf("domain %s already exists", name)
+	}
+	return name, nil
+}
+
+// selectNICs binds host NICs to the guest networks according to the answers
+func selectNICs(a *answers.Answers, data *xmlinput.XMLInputData, allowedNics host.NICList, gconf *guest.Config) error {
+	guestPciSlotCounter := data.GuestNic.PCI.FirstSlot
+	for _, net := range data.Networks.Configs {
+		anet := a.Network(net.Name)
+		if anet == nil || len(anet.NICs) == 0 {
+			if net.Optional {
+				continue
+			}
+			return fmt.Errorf("answers: no interfaces selected for network \"%s\"", net.Name)
+		}
+
+		var modes []xmlinput.ConnectionMode
+		for _, mode := range net.Modes {
+			if anet.Mode == "" || anet.Mode == mode.Type {
+				modes = append(modes, mode.Type)
+			}
+		}
+		if len(modes) == 0 {
+			return fmt.Errorf("answers: mode \"%s\" is not supported by network \"%s\"", anet.Mode, net.Name)
+		}
+		retainedNics, err := host_hwfilter.NicsByType(allowedNics, modes)
+		if err != nil {
+			return utils.FormatError(err)
+		}
+
+		gnics := guest.NewNICList()
+		var disjuncNicVendor string
+		var disjuncNicModel string
+		for _, name := range anet.NICs {
+			hnic := nicByNameOrPCI(retainedNics, name)
+			if hnic == nil {
+				return fmt.Errorf("answers: interface \"%s\" cannot be used for network \"%s\"", name, net.Name)
+			}
+			if _, _, err := gnics.NicByHostNicObj(hnic); err == nil {
+				return fmt.Errorf("answers: interface \"%s\" is selected more than once for network \"%s\"", name, net.Name)
+			}
+			if net.NicsDisjunction && (hnic.Type == host.NicTypePhys || hnic.Type == host.NicTypePhysVF) &&
+				(hnic.Vendor != disjuncNicVendor && hnic.Model != disjuncNicModel) {
+				if host_hwfilter.NicDisjunctionFound(hnic, data.HostNics.Allowed) && disjuncNicVendor != "" {
+					return fmt.Errorf("answers: '%s' cannot be selected alongside '%s %s'", hnic.Desc, disjuncNicVendor, disjuncNicModel)
+				}
+				disjuncNicVendor = hnic.Vendor
+				disjuncNicModel = hnic.Model
+			}
+
+			gnic := guest.NewNIC()
+			gnic.Network = net.Name
+			gnic.PCIAddr.Domain = data.PCI.Domain
+			gnic.PCIAddr.Bus = data.PCI.Bus
+			gnic.PCIAddr.Slot = utils.IntToHexString(guestPciSlotCounter)
+			gnic.PCIAddr.Function = data.PCI.Function
+			gnic.HostNIC = hnic
+			gnics.Add(gnic)
+			guestPciSlotCounter++
+		}
+		gconf.Networks = append(gconf.Networks, net)
+		gconf.NICLists = append(gconf.NICLists, gnics)
+	}
+	return nil
+}
+
+func nicByNameOrPCI(list host.NICList, id string) *host.NIC {
+	for _, nic := range list {
+		if nic.PCIAddr == id || (nic.Name != "N/A" && nic.Name == id) {
+			return nic
+		}
+	}
+	return nil
+}
+
+// vmConfig sets guest CPUs, RAM and disks according to the answers
+func vmConfig(a *answers.Answers, driver deployer.HostinfoDriver, xidata *xmlinput.XMLInputData,
+	pathToMainImage string, sconf *image.Storage, conf *guest.Config) error {
+	vm := a.VM
+	if vm == nil {
+		vm = new(answers.VM)
+	}
+
+	if xidata.CPU.Configure {
+		installedCpus, err := driver.CPUs()
+		if err != nil {
+			return utils.FormatError(err)
+		}
+		cpus := vm.CPUs
+		if cpus == 0 {
+			cpus = xidata.CPU.Default
+		}
+		if cpus < xidata.CPU.Min {
+			return fmt.Errorf("Minimum vCPUs requirement is %d.", xidata.CPU.Min)
+		}
+		if cpus > xidata.CPU.Max {
+			return fmt.Errorf("Amount of vCPUs exceeds maximum supported vCPUs(%d).", xidata.CPU.Max)
+		}
+		if cpus > installedCpus && !a.ContinueOnWarnings {
+			return fmt.Errorf("The host only has %d CPUs.Overcommitting vCPUs can reduce performance!", installedCpus)
+		}
+		conf.CPUs = cpus
+	} else if xidata.CPU.Default > 0 {
+		conf.CPUs = xidata.CPU.Default
+	}
+
+	if xidata.RAM.Configure {
+		installedRamMb, err := driver.RAMSize()
+		if err != nil {
+			return utils.FormatError(err)
+		}
+		maxRAM := xidata.RAM.Max
+		if xidata.RAM.Max > installedRamMb || xidata.RAM.Max == xmlinput.UnlimitedAlloc {
+			maxRAM = installedRamMb
+		}
+		ramMb := vm.RamMb
+		if ramMb == 0 {
+			ramMb = xidata.RAM.Default
+		}
+		if ramMb > installedRamMb {
+			return errors.New("Required RAM exceeds host machine available memory.")
+		}
+		if ramMb < xidata.RAM.Min {
+			return fmt.Errorf("Minimum RAM requirement is %0.1fGB.", float64(xidata.RAM.Min)/1024)
+		}
+		if ramMb > maxRAM {
+			return fmt.Errorf("Maximum RAM requirement is %0.1fGB.", float64(maxRAM)/1024)
+		}
+		conf.RamMb = ramMb
+	} else if xidata.RAM.Default > 0 {
+		conf.RamMb = xidata.RAM.Default
+	}
+
+	if xidata.Disks.Configure {
+		disks := make([]int, 0)
+		for i, disk := range xidata.Disks.Configs {
+			sizeMb := disk.Default
+			if i < len(vm.DisksMb) && vm.DisksMb[i] > 0 {
+				sizeMb = vm.DisksMb[i]
+			}
+			if sizeMb < disk.Min {
+				return fmt.Errorf("Minimum disk size requirement is %dGB.", disk.Min/1024)
+			}
+			if sizeMb > disk.Max {
+				return fmt.Errorf("Maximum disk size requirement is %dGB.", disk.Max/1024)
+			}
+			disks = append(disks, sizeMb)
+		}
+		var err error
+		if conf.Storage, err = config.StorageConfig(pathToMainImage, 0, sconf, disks); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	return nil
+}
+
+// numaTopology applies vCPU affinity provided by the answers.
+// Returns true if the topology has been changed
+func numaTopology(a *answers.Answers, c *guest.Config, totalCpusOnHost int) (bool, error) {
+	for _, pin := range a.NUMA {
+		if pin.VCPU < 0 || pin.VCPU > c.CPUs-1 {
+			return false, fmt.Errorf("answers: vCPU %d is out of range", pin.VCPU)
+		}
+		if pin.VNUMA < 0 || pin.VNUMA > len(c.NUMAs)-1 {
+			return false, fmt.Errorf("answers: vNUMA %d is out of range", pin.VNUMA)
+		}
+		cpus, err := parseCPUList(pin.CPUs, totalCpusOnHost)
+		if err != nil {
+			return false, err
+		}
+		for _, n := range c.NUMAs {
+			delete(n.CPUPin, pin.VCPU)
+		}
+		c.NUMAs[pin.VNUMA].CPUPin[pin.VCPU] = cpus
+	}
+	return len(a.NUMA) > 0, nil
+}
+
+// parseCPUList parses a list of CPUs represented as "0-3,8"
+func parseCPUList(list string, totalCpusOnHost int) ([]int, error) {
+	cpus := make([]int, 0)
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		firstlast := strings.Split(e, "-")
+		if len(firstlast) > 2 {
+			return nil, fmt.Errorf("Illegal input \"%s\"", e)
+		}
+		var bounds []int
+		for _, s := range firstlast {
+			cpu, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("Illegal input \"%s\"", e)
+			}
+			if cpu < 0 || cpu > totalCpusOnHost-1 {
+				return nil, fmt.Errorf("The value (%d) is out of range", cpu)
+			}
+			bounds = append(bounds, cpu)
+		}
+		last := bounds[len(bounds)-1]
+		for cpu := bounds[0]; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
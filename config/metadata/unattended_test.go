@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/config/xmlinput"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+	"github.com/dorzheh/deployer/utils/hwinfo/host"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-3,8", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpus, []int{0, 1, 2, 3, 8}) {
+		t.Fatalf("unexpected CPUs %v", cpus)
+	}
+	for _, bad := range []string{"16", "a", "1-2-3", "-1"} {
+		if _, err := parseCPUList(bad, 16); err == nil {
+			t.Fatalf("\"%s\" supposed to produce an error", bad)
+		}
+	}
+}
+
+func TestSelectNICs(t *testing.T) {
+	data := &xmlinput.XMLInputData{}
+	data.GuestNic.PCI = &xmlinput.PciAddress{Domain: "0000", Bus: "00", FirstSlot: 6, Function: "0"}
+	data.Networks.Configs = []*xmlinput.Network{
+		{Name: "Management", Modes: []*xmlinput.Mode{{Type: xmlinput.ConTypeBridged}}},
+		{Name: "Traffic", Modes: []*xmlinput.Mode{{Type: xmlinput.ConTypePassthrough}}},
+		{Name: "Optional", Optional: true, Modes: []*xmlinput.Mode{{Type: xmlinput.ConTypeBridged}}},
+	}
+	nics := host.NICList{
+		{Name: "br0", PCIAddr: "N/A", Type: host.NicTypeBridge, NUMANode: host.NoNUMA},
+		{Name: "eth1", PCIAddr: "0000:03:00.0", Type: host.NicTypePhys},
+		{Name: "eth2", PCIAddr: "0000:03:00.1", Type: host.NicTypePhys},
+	}
+	a := &answers.Answers{
+		Networks: []*answers.Network{
+			{Name: "Management", NICs: []string{"br0"}},
+			{Name: "Traffic", NICs: []string{"eth1", "0000:03:00.1"}},
+		},
+	}
+
+	gconf := guest.NewConfig()
+	if err := selectNICs(a, data, nics, gconf); err != nil {
+		t.Fatal(err)
+	}
+	if len(gconf.NICLists) != 2 || gconf.NICLists[1].Length() != 2 {
+		t.Fatalf("unexpected NIC lists %v", gconf.NICLists)
+	}
+	if slot := gconf.NICLists[1][1].PCIAddr.Slot; slot != "08" {
+		t.Fatalf("expected PCI slot 08, got %s", slot)
+	}
+
+	// bridge cannot be used for passthrough network
+	a.Networks[1].NICs = []string{"br0"}
+	if err := selectNICs(a, data, nics, guest.NewConfig()); err == nil {
+		t.Fatal("supposed to produce an error")
+	}
+}
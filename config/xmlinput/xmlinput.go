@@ -8,15 +8,16 @@ import (
 
 // ParseXMLInputFile is responsible for parsing a given configuration file
 // representing appropriate input data to a srtuctured form
+// The file may be XML, YAML or JSON (see utils.LoadFile)
 func ParseXMLInput(config string) (*XMLInputData, error) {
-	d, err := utils.ParseXMLFile(config, new(XMLInputData))
-	if err != nil {
+	d := new(XMLInputData)
+	if err := utils.LoadFile(config, d); err != nil {
 		return nil, utils.FormatError(err)
 	}
-	if err := verify(d.(*XMLInputData)); err != nil {
+	if err := verify(d); err != nil {
 		return nil, utils.FormatError(err)
 	}
-	return d.(*XMLInputData), nil
+	return d, nil
 }
 
 // ParseXMLInputBuf is responsible for parsing a given stream of bytes
@@ -3,6 +3,8 @@ package xmlinput
 import (
 	"fmt"
 	"testing"
+
+	"github.com/dorzheh/deployer/utils"
 )
 
 var xmldata = []byte(`<?xml version="1.0" encoding="UTF-8"?>
@@ -194,3 +196,9 @@ func TestParseXMLInputBad(t *testing.T) {
 		t.Fatalf("supposed to produce an error")
 	}
 }
+
+func TestValidate(t *testing.T) {
+	if err := utils.Validate(xmldata, utils.FormatXML, new(XMLInputData)); err != nil {
+		t.Fatal(err)
+	}
+}
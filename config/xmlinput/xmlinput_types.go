@@ -26,9 +26,9 @@ type XMLInputData struct {
 
 type CPU struct {
 	Configure bool `xml:"cpu>configure"`
-	Min       int  `xml:"cpu>min"`
-	Max       int  `xml:"cpu>max"`
-	Default   int  `xml:"cpu>default_value"`
+	Min       int  `xml:"cpu>min" validate:"min=1"`
+	Max       int  `xml:"cpu>max" validate:"min=-1"`
+	Default   int  `xml:"cpu>default_value" validate:"min=1"`
 }
 
 type NUMA struct {
@@ -39,15 +39,15 @@ type NUMA struct {
 
 type RAM struct {
 	Configure bool `xml:"ram>configure"`
-	Min       int  `xml:"ram>min_mb"`
-	Max       int  `xml:"ram>max_mb"`
-	Default   int  `xml:"ram>default_value_mb"`
+	Min       int  `xml:"ram>min_mb" validate:"min=1"`
+	Max       int  `xml:"ram>max_mb" validate:"min=-1"`
+	Default   int  `xml:"ram>default_value_mb" validate:"min=1"`
 }
 
 type Disk struct {
-	Min     int `xml:"min_mb"`
-	Max     int `xml:"max_mb"`
-	Default int `xml:"default_value_mb"`
+	Min     int `xml:"min_mb" validate:"min=1"`
+	Max     int `xml:"max_mb" validate:"min=-1"`
+	Default int `xml:"default_value_mb" validate:"min=1"`
 }
 
 type Disks struct {
@@ -56,7 +56,7 @@ type Disks struct {
 }
 
 type Network struct {
-	Name            string        `xml:"name,attr"`
+	Name            string        `xml:"name,attr" validate:"required"`
 	Optional        bool          `xml:"optional,attr"`
 	UiResetCounter  bool          `xml:"ui_reset_counter"`
 	NicsDisjunction bool          `xml:"host_nics_disjunction"`
@@ -70,18 +70,18 @@ type Networks struct {
 }
 
 type Template struct {
-	FileName string `xml:"file_name,attr"`
+	FileName string `xml:"file_name,attr" validate:"required"`
 	Dir      string `xml:"dir,attr"`
 }
 
 type Mode struct {
-	Type       ConnectionMode `xml:"type,attr"`
+	Type       ConnectionMode `xml:"type,attr" validate:"required,oneof=bridged ovs direct passthrough sriov virtnetwork"`
 	VnicDriver string         `xml:"vnic_driver,attr"`
 	Tmplt      *Template      `xml:"template"`
 }
 
 type Appearance struct {
-	Type   ConnectionMode `xml:"mode_type,attr"`
+	Type   ConnectionMode `xml:"mode_type,attr" validate:"required,oneof=bridged ovs direct passthrough sriov virtnetwork"`
 	Appear string         `xml:"appear,attr"`
 }
 
@@ -105,7 +105,7 @@ type HostNics struct {
 type PciAddress struct {
 	Domain    string `xml:"domain"`
 	Bus       string `xml:"bus"`
-	FirstSlot int    `xml:"first_slot"`
+	FirstSlot int    `xml:"first_slot" validate:"min=0,max=31"`
 	Function  string `xml:"function"`
 }
 
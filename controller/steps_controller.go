@@ -8,22 +8,46 @@ import (
 
 var SkipStep = errors.New("skip step")
 
-var steps []func() error
+// Steps is a list of configuration steps.
+// Every deployment keeps its own list, so that several configurations
+// can be created simultaneously (see deployer.CommonData.Steps).
+// A nil Steps refers to the global list of the package.
+type Steps struct {
+	steps []func() error
+}
+
+var steps = new(Steps)
 
-func init() {
-	steps = make([]func() error, 0)
+// NewSteps creates an empty list of steps
+func NewSteps() *Steps {
+	return new(Steps)
 }
 
-func RegisterSteps(fs ...func() error) {
-	for _, f := range fs {
-		steps = append(steps, f)
+// Register appends the steps to the list
+func (s *Steps) Register(fs ...func() error) {
+	if s == nil {
+		s = steps
 	}
+	s.steps = append(s.steps, fs...)
 }
 
-func RunSteps() error {
+// Reset removes all the registered steps
+func (s *Steps) Reset() {
+	if s == nil {
+		s = steps
+	}
+	s.steps = nil
+}
+
+// Run runs the registered steps moving back and forth
+// as requested by the user
+func (s *Steps) Run() error {
+	if s == nil {
+		s = steps
+	}
 	stepMoveBack := false
-	for i := 0; i < len(steps); {
-		err := steps[i]()
+	for i := 0; i < len(s.steps); {
+		err := s.steps[i]()
 		if err != nil {
 			if err == SkipStep {
 				if stepMoveBack {
@@ -36,12 +60,12 @@ func RunSteps() error {
 				}
 				continue
 			}
-			switch err.Error() {
-			case dialog_ui.DialogExit:
+			switch dialog_ui.Navigation(err) {
+			case dialog_ui.ErrExit:
 				os.Exit(1)
-			case dialog_ui.DialogNext:
+			case dialog_ui.ErrNext:
 				break
-			case dialog_ui.DialogMoveBack:
+			case dialog_ui.ErrMoveBack:
 				if i > 0 {
 					i--
 				}
@@ -56,3 +80,19 @@ func RunSteps() error {
 	}
 	return nil
 }
+
+// RegisterSteps appends the steps to the global list
+func RegisterSteps(fs ...func() error) {
+	steps.Register(fs...)
+}
+
+// ResetSteps removes all the registered steps.
+// Intended for creating a new configuration in the same process.
+func ResetSteps() {
+	steps.Reset()
+}
+
+// RunSteps runs the steps of the global list
+func RunSteps() error {
+	return steps.Run()
+}
@@ -1,8 +1,21 @@
 package deployer
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/controller"
 	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/audit"
+	ssh "github.com/dorzheh/infra/comm/common"
 )
 
 // Deploy is implementing entire flow
@@ -10,30 +23,503 @@ import (
 // - CreateConfig creates appropriate configuration(user interaction against UI).
 // - CreateBuilders creates appropriate builders and passes them to the build process
 // - CreatePostProcessors creates appropriate post-processors and passes them for post-processing
+// Flow creators implementing deployer.PipelineFlowCreator provide a pipeline of post-processors.
+// If c.RecordFile is set, the answers provided during the interactive session
+// are written to the file once the configuration is created.
+// The deployment is cancelled on SIGHUP, SIGINT or SIGTERM.
+// If c.Plan is set, the builders and the post-processors are not run;
+// the actions they would perform are written to c.PlanOutput instead.
+// The hooks registered by RegisterHooks are run between the stages.
 func Deploy(c *deployer.CommonData, f deployer.FlowCreator) error {
-	if err := f.CreateConfig(c); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return DeployContext(ctx, c, f)
+}
+
+// DeployContext is like Deploy but the builders and the post-processor
+// are cancelled once the given context is done.
+// The deployment is transactional: side effects recorded by the stages
+// are undone in reverse order if the deployment fails
+// (the artifacts are kept if c.KeepArtifacts is set).
+// The SSH connections to the remote host are closed once the deployment is done.
+// If c.AuditLog is set, every executed command is recorded to the audit log
+// and the path to the log is mentioned in the error returned.
+// If c.Checkpoint is set, the state of the deployment is persisted to the file
+// after each stage and the artifacts are kept on failure, so that the deployment
+// can be resumed (see Resume). The checkpoint is removed once the deployment succeeds.
+// If c.SigningKey is set, the manifest of the artifacts is signed. Once the product
+// trusts any keys (or c.RequireSignature is set), the deployment fails unless the
+// signing key is one of them (see deployer.CommonData.TrustedPublicKeys) and the
+// signature of the manifest file is verified before the artifacts are post-processed.
+// Resuming the deployment verifies the manifest signed by the interrupted one
+// instead of signing the restored artifacts again.
+func DeployContext(ctx context.Context, c *deployer.CommonData, f deployer.FlowCreator) error {
+	var cp *deployer.Checkpoint
+	if c.Checkpoint != "" && !c.Plan {
+		cp = deployer.NewCheckpoint(c.Checkpoint)
+	}
+	return withSession(c, func() error {
+		return deploy(ctx, c, f, cp)
+	})
+}
+
+// Resume continues the deployment persisted to c.Checkpoint.
+// The configuration is replayed from the checkpoint (unless c.Answers is set)
+// and the builders whose artifacts are still valid are not run again.
+// If the checkpoint doesn't exist, the deployment starts from scratch.
+func Resume(c *deployer.CommonData, f deployer.FlowCreator) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return ResumeContext(ctx, c, f)
+}
+
+// ResumeContext is like Resume but the builders and the post-processor
+// are cancelled once the given context is done.
+func ResumeContext(ctx context.Context, c *deployer.CommonData, f deployer.FlowCreator) error {
+	if c.Checkpoint == "" {
+		return utils.FormatError(errors.New("checkpoint is not set"))
+	}
+	cp, err := deployer.LoadCheckpoint(c.Checkpoint)
+	if os.IsNotExist(err) {
+		cp, err = deployer.NewCheckpoint(c.Checkpoint), nil
+	}
+	if err != nil {
 		return utils.FormatError(err)
 	}
+	if c.Answers == nil && cp.Config != nil {
+		c.Answers = cp.Config
+	}
+	return withSession(c, func() error {
+		return deploy(ctx, c, f, cp)
+	})
+}
+
+// withSession runs the function sharing the remote connections
+// and the audit log (if c.AuditLog is set) between all the deployments it runs
+func withSession(c *deployer.CommonData, fn func() error) (err error) {
+	// the remote connections are shared by all the stages and the rollback
+	defer utils.DefaultSshPool.Close()
+
+	if c.AuditLog != "" {
+		l, aerr := audit.Open(c.AuditLog)
+		if aerr != nil {
+			return utils.FormatError(aerr)
+		}
+		audit.SetDefault(l)
+		defer func() {
+			audit.SetDefault(nil)
+			l.Close()
+			if err != nil {
+				err = fmt.Errorf("%w\naudit log: %s", err, c.AuditLog)
+			}
+		}()
+	}
+	return fn()
+}
+
+// hooks contains the hooks run by every deployment
+var hooks = deployer.NewHooks()
+
+// RegisterHooks registers functions run by Deploy at the given point
+// of the flow (license checks once the configuration is created,
+// notifications once the artifacts are post-processed and so forth).
+// A hook returning an error aborts the deployment.
+// The hooks are shared by all the deployments, including the ones
+// running simultaneously (see MultiHost).
+func RegisterHooks(point deployer.HookPoint, fs ...deployer.Hook) {
+	hooks.Register(point, fs...)
+}
+
+// ResetHooks removes all the registered hooks
+func ResetHooks() {
+	hooks.Reset()
+}
+
+// createConfig creates the configuration of the flow.
+// The flow registers its steps with the steps of the deployment,
+// so the configurations of several hosts are created simultaneously.
+func createConfig(c *deployer.CommonData, f deployer.FlowCreator) error {
+	c.Steps = controller.NewSteps()
+	return f.CreateConfig(c)
+}
+
+// deploy runs the stages of the deployment persisting its state to the checkpoint (if any)
+func deploy(ctx context.Context, c *deployer.CommonData, f deployer.FlowCreator, cp *deployer.Checkpoint) (err error) {
+	if (c.ReportFile != "" || c.ReportHTMLFile != "") && !c.Plan {
+		c.Report = deployer.NewReport(c.VaName)
+		c.Report.Host = c.Host
+		c.Report.AuditLog = c.AuditLog
+		// the report is written once the deployment is rolled back
+		defer func() {
+			if werr := writeReport(c, err); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+	}
+
+	// the artifacts are needed for resuming the deployment
+	c.Transaction = deployer.NewTransaction(c.KeepArtifacts || cp != nil)
+	ctx = deployer.WithTransaction(ctx, c.Transaction)
+	defer func() {
+		if err == nil {
+			c.Transaction.Commit()
+			return
+		}
+		if rerr := c.Transaction.Rollback(); rerr != nil {
+			err = fmt.Errorf("%w\nrollback failed: %v", err, rerr)
+		}
+	}()
+
+	// the failure hooks run before the rollback and regardless of cancellation
+	var artifacts []deployer.Artifact
+	defer func() {
+		if err == nil {
+			return
+		}
+		d := &deployer.HookData{Point: deployer.OnFailure, Data: c, Artifacts: artifacts, Err: err}
+		if herr := hooks.Run(context.WithoutCancel(ctx), d); herr != nil {
+			err = fmt.Errorf("%w\n%v", err, herr)
+		}
+	}()
+
+	if (c.RecordFile != "" || cp != nil) && c.Answers == nil && c.Record == nil {
+		c.Record = new(answers.Answers)
+	}
+	start := time.Now()
+	err = hooks.Run(ctx, &deployer.HookData{Point: deployer.BeforeConfig, Data: c})
+	if err == nil {
+		err = createConfig(c, f)
+	}
+	if err == nil {
+		err = hooks.Run(ctx, &deployer.HookData{Point: deployer.AfterConfig, Data: c})
+	}
+	c.Report.Stage(deployer.StageConfig, start, err)
+	if err != nil {
+		return utils.StageError(deployer.StageConfig, err)
+	}
+	if c.RecordFile != "" && c.Record != nil {
+		defer func() {
+			if werr := c.Record.WriteFile(c.RecordFile); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+	}
+
+	if cp != nil {
+		cp.Config = c.Answers
+		if cp.Config == nil {
+			cp.Config = c.Record
+		}
+		if err := cp.Complete(deployer.StageConfig); err != nil {
+			return utils.FormatError(err)
+		}
+	}
 
 	builders, err := f.CreateBuilders(c)
 	if err != nil {
 		return utils.FormatError(err)
 	}
+	// once the product trusts any keys, nothing is post-processed
+	// unless the manifest is signed by one of them
+	var keys []ed25519.PublicKey
+	var signer ed25519.PrivateKey
+	var previous *deployer.Manifest
+	restored := make(map[string]string)
+	if !c.Plan {
+		if keys, err = c.TrustedPublicKeys(); err != nil {
+			return utils.StageError(deployer.StageBuild, err)
+		}
+		if signer, err = signingKey(c, keys); err != nil {
+			return utils.StageError(deployer.StageBuild, err)
+		}
+		if cp != nil && len(cp.Artifacts) > 0 {
+			if previous, err = restoreManifest(c, cp, keys); err != nil {
+				return utils.StageError(deployer.StageBuild, err)
+			}
+		}
+	}
+	if cp != nil {
+		if builders, err = cp.Builders(builders); err != nil {
+			return utils.FormatError(err)
+		}
+		for _, ca := range cp.Artifacts {
+			restored[ca.Path] = ca.Checksum
+		}
+	}
 
-	artifacts, err := deployer.BuildProgress(c, builders)
+	post, err := createPostProcessor(c, f)
 	if err != nil {
 		return utils.FormatError(err)
 	}
 
-	post, err := f.CreatePostProcessor(c)
+	if c.Plan {
+		// nothing but the configuration is created, so it can be cleaned up
+		defer c.Transaction.Rollback()
+		w := c.PlanOutput
+		if w == nil {
+			w = os.Stdout
+		}
+		if err := deployer.Plan(w, builders, post); err != nil {
+			return utils.FormatError(err)
+		}
+		return nil
+	}
+
+	builders = hooks.Builders(c, builders)
+	start = time.Now()
+	artifacts, err = deployer.BuildProgressContext(ctx, c, builders)
+	c.Report.Stage(deployer.StageBuild, start, err)
+	if err != nil {
+		return utils.StageError(deployer.StageBuild, err)
+	}
+	manifest, err := newManifest(c, previous, restored, artifacts)
 	if err != nil {
+		return utils.StageError(deployer.StageBuild, err)
+	}
+	if err := writeManifest(c, manifest, signer); err != nil {
+		return utils.StageError(deployer.StageBuild, err)
+	}
+	if err := c.Report.AddArtifacts(artifacts); err != nil {
 		return utils.FormatError(err)
 	}
+	if cp != nil {
+		if err := cp.Complete(deployer.StageBuild); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	if err := hooks.Run(ctx, &deployer.HookData{Point: deployer.BeforePostProcess, Data: c, Artifacts: artifacts}); err != nil {
+		return utils.StageError(deployer.StagePostProcess, err)
+	}
 	if post != nil {
-		err := deployer.PostProcessProgress(c, post, artifacts)
+		start := time.Now()
+		// nothing is defined unless the artifacts are intact
+		err := verifyArtifacts(c, manifest, keys, artifacts)
+		var all []deployer.Artifact
+		// the post-processors may move the artifacts (see updateArtifacts)
+		before := make([]location, len(artifacts))
+		for i, a := range artifacts {
+			before[i] = locationOf(a)
+		}
+		if err == nil {
+			pctx := deployer.WithManifest(ctx, manifest)
+			all, err = deployer.PostProcessProgressContext(pctx, c, post, artifacts)
+		}
+		if err == nil {
+			err = updateArtifacts(c, manifest, before, all, signer)
+		}
+		c.Report.Stage(deployer.StagePostProcess, start, err)
 		if err != nil {
+			return utils.StageError(deployer.StagePostProcess, err)
+		}
+		artifacts = all
+	}
+	if err := hooks.Run(ctx, &deployer.HookData{Point: deployer.AfterPostProcess, Data: c, Artifacts: artifacts}); err != nil {
+		return utils.StageError(deployer.StagePostProcess, err)
+	}
+	if cp != nil {
+		if err := cp.Remove(); err != nil {
 			return utils.FormatError(err)
 		}
 	}
 	return nil
 }
+
+// signingKey loads the key the manifest is signed with (nil if c.SigningKey is not set).
+// Once any keys are trusted, the key must be one of them.
+func signingKey(c *deployer.CommonData, keys []ed25519.PublicKey) (ed25519.PrivateKey, error) {
+	if c.SigningKey == "" {
+		if len(keys) > 0 {
+			return nil, utils.FormatError(fmt.Errorf("%w: the signing key is not set", deployer.ErrUnsigned))
+		}
+		return nil, nil
+	}
+	key, err := deployer.LoadPrivateKey(c.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return key, nil
+	}
+	id := deployer.KeyId(key.Public().(ed25519.PublicKey))
+	for _, k := range keys {
+		if deployer.KeyId(k) == id {
+			return key, nil
+		}
+	}
+	return nil, utils.FormatError(fmt.Errorf("the signing key %s is not trusted (%s)", id, c.TrustedKeysPath()))
+}
+
+// restoreManifest loads the manifest written by the interrupted deployment
+// and verifies its signature against the trusted keys (if any).
+// Once any keys are trusted, the artifacts of the checkpoint the signed manifest
+// doesn't cover are dropped, so that they are built again instead of being signed
+// without verification. Returns nil if there is no manifest to resume from.
+func restoreManifest(c *deployer.CommonData, cp *deployer.Checkpoint, keys []ed25519.PublicKey) (*deployer.Manifest, error) {
+	m, err := deployer.LoadManifest(c.ManifestPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		m = nil
+	case err != nil:
+		return nil, err
+	case len(keys) > 0:
+		if err := m.VerifySignature(keys); errors.Is(err, deployer.ErrUnsigned) {
+			// written by a deployment that didn't sign it
+			m = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return m, nil
+	}
+	var covered []*deployer.CheckpointArtifact
+	for _, ca := range cp.Artifacts {
+		if ma := m.Artifact(ca.Path); ma != nil && ma.Remote == ca.Remote && ma.Checksum == ca.Checksum {
+			covered = append(covered, ca)
+		}
+	}
+	cp.Artifacts = covered
+	return m, nil
+}
+
+// newManifest creates the manifest of the built artifacts.
+// The artifacts restored from the checkpoint (the checksums they were recorded with
+// are mapped by path) keep the entries of the manifest written by the interrupted
+// deployment (see restoreManifest), so that they are not inspected again.
+func newManifest(c *deployer.CommonData, previous *deployer.Manifest, restored map[string]string, artifacts []deployer.Artifact) (*deployer.Manifest, error) {
+	m, err := deployer.NewManifest(c.VaName, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.Host = c.Host
+	for _, a := range artifacts {
+		sum, ok := restored[a.GetPath()]
+		if ma := previous.Artifact(a.GetPath()); ok && ma != nil && ma.Checksum == sum {
+			if ca, ok := a.(*deployer.CommonArtifact); ok {
+				ca.Format = ma.Format
+				ca.VirtualSize = ma.VirtualSize
+				ca.Size = ma.Size
+				ca.Checksum = ma.Checksum
+				ca.Created = ma.Created
+			}
+			m.Artifacts = append(m.Artifacts, ma)
+			continue
+		}
+		if err := m.Add([]deployer.Artifact{a}); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// writeManifest writes the manifest signed by the key (if any)
+func writeManifest(c *deployer.CommonData, m *deployer.Manifest, key ed25519.PrivateKey) error {
+	if key != nil {
+		if err := m.Sign(key); err != nil {
+			return err
+		}
+	}
+	return m.WriteFile(c.ManifestPath())
+}
+
+// verifyArtifacts checks the artifacts against the manifest before they are post-processed.
+// Once any keys are trusted, the manifest is read again and its signature is verified,
+// so that the changes of the manifest file since it was written are detected.
+func verifyArtifacts(c *deployer.CommonData, m *deployer.Manifest, keys []ed25519.PublicKey, artifacts []deployer.Artifact) error {
+	if len(keys) > 0 {
+		var err error
+		if m, err = deployer.LoadManifest(c.ManifestPath()); err != nil {
+			return err
+		}
+		if err := m.VerifySignature(keys); err != nil {
+			return err
+		}
+	}
+	return m.Verify(artifactsSshConfig(artifacts))
+}
+
+// location identifies where an artifact resides
+type location struct {
+	path   string
+	remote bool
+}
+
+func locationOf(a deployer.Artifact) location {
+	l := location{path: a.GetPath()}
+	if c, ok := a.(*deployer.CommonArtifact); ok {
+		l.remote = c.SshConfig != nil
+	}
+	return l
+}
+
+// updateArtifacts refers the manifest and the report to the artifacts moved
+// by the post-processors (uploaded to the remote host and so forth)
+// and adds the artifacts created by them. The artifacts were located
+// at before prior to post-processing. The manifest is signed and written again.
+func updateArtifacts(c *deployer.CommonData, m *deployer.Manifest, before []location, all []deployer.Artifact, key ed25519.PrivateKey) error {
+	changed := false
+	for i, l := range before {
+		if locationOf(all[i]) == l {
+			continue
+		}
+		if err := m.Move(l.path, all[i]); err != nil {
+			return err
+		}
+		c.Report.MoveArtifact(l.path, all[i])
+		changed = true
+	}
+	if created := all[len(before):]; len(created) > 0 {
+		if err := m.Add(created); err != nil {
+			return err
+		}
+		if err := c.Report.AddArtifacts(created); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return writeManifest(c, m, key)
+}
+
+// artifactsSshConfig returns SSH configuration of the host
+// the remote artifacts reside on
+func artifactsSshConfig(artifacts []deployer.Artifact) *ssh.Config {
+	for _, a := range artifacts {
+		if c, ok := a.(*deployer.CommonArtifact); ok && c.SshConfig != nil {
+			return c.SshConfig
+		}
+	}
+	return nil
+}
+
+// writeReport writes the report of the deployment finished with the given error
+func writeReport(c *deployer.CommonData, err error) error {
+	c.Report.Finish(err)
+	if c.ReportFile != "" {
+		if err := c.Report.WriteFile(c.ReportFile); err != nil {
+			return err
+		}
+	}
+	if c.ReportHTMLFile != "" {
+		if err := c.Report.WriteHTMLFile(c.ReportHTMLFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPostProcessor creates the post-processor of the flow.
+// Flow creators implementing deployer.PipelineFlowCreator provide a pipeline.
+// Returns nil if there is nothing to post-process.
+func createPostProcessor(c *deployer.CommonData, f deployer.FlowCreator) (deployer.PostProcessor, error) {
+	if pf, ok := f.(deployer.PipelineFlowCreator); ok {
+		list, err := pf.CreatePostProcessors(c)
+		if err != nil || len(list) == 0 {
+			return nil, err
+		}
+		return deployer.Pipeline(list), nil
+	}
+	return f.CreatePostProcessor(c)
+}
@@ -3,6 +3,7 @@ package deployer
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/dorzheh/deployer/utils"
 	ssh "github.com/dorzheh/infra/comm/common"
@@ -13,6 +14,9 @@ type ArtifactType uint8
 const (
 	ImageArtifact ArtifactType = iota
 	MetadataArtifact
+
+	// PackageArtifact is an archive containing the appliance (OVA and so forth)
+	PackageArtifact
 )
 
 // Artifact is the interface to a real artifact implementation.
@@ -24,7 +28,7 @@ type Artifact interface {
 	// Path to artifact.
 	GetPath() string
 
-	// Artifact type (either ImageArtifact or MetadataArtifact).
+	// Artifact type (ImageArtifact, MetadataArtifact or PackageArtifact).
 	GetType() ArtifactType
 
 	// Destroys the artifact.
@@ -40,6 +44,30 @@ type CommonArtifact struct {
 	Path      string
 	Type      ArtifactType
 	SshConfig *ssh.Config
+
+	// Executor (optional) runs the commands on the host the artifact resides on.
+	// If not set, the executor is derived from SshConfig.
+	Executor utils.Executor
+
+	// Builder is the Id of the builder created the artifact.
+	Builder string
+
+	// The properties below are recorded by Inspect.
+
+	// Format of the artifact ("qcow2", "raw", "xml" and so forth).
+	Format string
+
+	// VirtualSize is the size of the disk the image represents.
+	VirtualSize int64
+
+	// Size is the size of the artifact on disk.
+	Size int64
+
+	// Checksum is SHA256 of the artifact.
+	Checksum string
+
+	// Created is the modification time of the artifact.
+	Created time.Time
 }
 
 // GetName returns artifact's name.
@@ -59,13 +87,36 @@ func (a *CommonArtifact) GetType() ArtifactType {
 
 // Destroy is responsible for removing appropriate artifact.
 func (a *CommonArtifact) Destroy() error {
-	run := utils.RunFunc(a.SshConfig)
-	if _, err := run("rm " + a.Path); err != nil {
+	e := a.Executor
+	if e == nil {
+		e = utils.NewExecutor(a.SshConfig)
+	}
+	if _, err := utils.Run(e, "rm -f "+a.Path); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// Inspect records format, sizes, checksum and creation time of the artifact
+// examining the artifact on the host it resides on.
+func (a *CommonArtifact) Inspect() error {
+	ma, err := inspect(a)
+	if err != nil {
 		return utils.FormatError(err)
 	}
+	a.Format = ma.Format
+	a.VirtualSize = ma.VirtualSize
+	a.Size = ma.Size
+	a.Checksum = ma.Checksum
+	a.Created = ma.Created
 	return nil
 }
 
 func (a *CommonArtifact) String() string {
-	return fmt.Sprintf("Name: %s\nPath: %s\nType: %v\n", a.Name, a.Path, a.Type)
+	s := fmt.Sprintf("Name: %s\nPath: %s\nType: %v\n", a.Name, a.Path, a.Type)
+	if a.Checksum != "" {
+		s += fmt.Sprintf("Format: %s\nVirtual size: %d\nSize: %d\nSHA256: %s\nCreated: %v\n",
+			a.Format, a.VirtualSize, a.Size, a.Checksum, a.Created)
+	}
+	return s
 }
@@ -1,70 +1,81 @@
 package deployer
 
 import (
-	"runtime"
-	"time"
+	"context"
+	"strings"
 
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 )
 
 // BuildProgress is responsible for running appropriate builders
 // and representing a progress bar providing information about the build progress.
+// The progress bar is driven by the progress events reported by the builders.
+// If the UI is not used, the events are sent to c.ProgressEvents (if set).
 func BuildProgress(c *CommonData, builders []Builder) (artifacts []Artifact, err error) {
+	return BuildProgressContext(context.Background(), c, builders)
+}
+
+// BuildProgressContext is like BuildProgress but the build is cancelled
+// once the context is done.
+func BuildProgressContext(ctx context.Context, c *CommonData, builders []Builder) (artifacts []Artifact, err error) {
+	s := &Scheduler{Parallelism: c.BuildParallelism}
 	if c.Ui == nil {
-		return Build(builders)
+		if c.ProgressEvents != nil {
+			ctx = progress.NewContext(ctx, progress.NewReporter(c.ProgressEvents, ctx.Done()))
+		}
+		return s.Build(ctx, builders)
 	}
+
 	errChan := make(chan error)
 	defer close(errChan)
+
+	events := make(chan progress.Event)
+	ctx = progress.NewContext(ctx, progress.NewReporter(events, ctx.Done()))
 	go func() {
-		artifacts, err = Build(builders)
+		artifacts, err = s.Build(ctx, builders)
 		errChan <- err
 	}()
 
 	progressBarTitle := "Building artifacts"
 	progressBarMsg := "\n" + c.VaName + " installation in progress.Please wait..."
-	if err = c.Ui.Progress(progressBarTitle, progressBarMsg, c.Ui.Pb.Sleep(), c.Ui.Pb.Step(), errChan); err != nil {
+	if err = c.Ui.ProgressEvents(progressBarTitle, progressBarMsg, events, errChan); err != nil {
 		err = utils.FormatError(err)
 	}
 	return
 }
 
-// buildResult contains result of a build.
-type buildResult struct {
-	artifact Artifact
-	err      error
+// BuildError combines errors returned by the builders
+// participating in a failed build.
+type BuildError struct {
+	Errors []error
 }
 
-// Build iterates over a slice of builders and runs
-// each builder in a separated goroutine.
-// Returns a slice of artifacts.
-func Build(builders []Builder) ([]Artifact, error) {
-	dur, err := time.ParseDuration("1s")
-	if err != nil {
-		return nil, utils.FormatError(err)
+func (e *BuildError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
 	}
+	return strings.Join(msgs, "\n")
+}
 
-	runtime.GOMAXPROCS(runtime.NumCPU() - 1)
+// Unwrap allows errors.Is and errors.As to inspect every builder error.
+func (e *BuildError) Unwrap() []error {
+	return e.Errors
+}
 
-	var artifacts []Artifact
-	ch := make(chan *buildResult, len(builders))
+// Build runs the builders according to their dependencies
+// (see Scheduler).
+// Returns a slice of artifacts.
+func Build(builders []Builder) ([]Artifact, error) {
+	return BuildContext(context.Background(), builders)
+}
 
-	for _, b := range builders {
-		time.Sleep(dur)
-		go func(b Builder) {
-			artifact, err := b.Run()
-			// Forwards created artifact to the channel.
-			ch <- &buildResult{artifact, err}
-		}(b)
-	}
-	for i := 0; i < len(builders); i++ {
-		select {
-		case result := <-ch:
-			if result.err != nil {
-				//defer close(ch)
-				return nil, utils.FormatError(result.err)
-			}
-			artifacts = append(artifacts, result.artifact)
-		}
-	}
-	return artifacts, nil
+// BuildContext is like Build but the builders are cancelled
+// once the context is done or any of them fails.
+// The artifacts are recorded by the transaction carried by the context (if any).
+// BuildContext waits for all the running builders to return and reports
+// a BuildError containing the errors of the failed builders.
+func BuildContext(ctx context.Context, builders []Builder) ([]Artifact, error) {
+	return new(Scheduler).Build(ctx, builders)
 }
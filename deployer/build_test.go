@@ -0,0 +1,72 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errBuildFailed = errors.New("build failed")
+
+type failingBuilder struct{}
+
+func (b *failingBuilder) Id() string {
+	return "FailingBuilder"
+}
+
+func (b *failingBuilder) Run() (Artifact, error) {
+	return nil, errBuildFailed
+}
+
+type blockingBuilder struct {
+	released bool
+}
+
+func (b *blockingBuilder) Id() string {
+	return "BlockingBuilder"
+}
+
+func (b *blockingBuilder) Run() (Artifact, error) {
+	return b.RunContext(context.Background())
+}
+
+func (b *blockingBuilder) RunContext(ctx context.Context) (Artifact, error) {
+	select {
+	case <-ctx.Done():
+		b.released = true
+		// executors wrap the context error
+		return nil, fmt.Errorf("executing sleep 60 : %w", ctx.Err())
+	case <-time.After(time.Minute):
+		return &CommonArtifact{Name: "blocking"}, nil
+	}
+}
+
+func TestBuildCancelsSiblings(t *testing.T) {
+	blocking := new(blockingBuilder)
+	_, err := (&Scheduler{Parallelism: 2}).Build(context.Background(), []Builder{blocking, new(failingBuilder)})
+	if err == nil {
+		t.Fatal("supposed to produce an error")
+	}
+	if !blocking.released {
+		t.Fatal("sibling builder has not been cancelled")
+	}
+	var berr *BuildError
+	if !errors.As(err, &berr) || len(berr.Errors) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !errors.Is(err, errBuildFailed) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestBuildContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := BuildContext(ctx, []Builder{new(blockingBuilder)})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
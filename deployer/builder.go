@@ -1,7 +1,10 @@
 package deployer
 
 import (
+	"context"
+
 	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/utils"
 )
 
 // Implementers of the interface are responsible for creating
@@ -14,6 +17,47 @@ type Builder interface {
 	Run() (Artifact, error)
 }
 
+// DependentBuilder is implemented by builders that have to be started
+// only after other builders completed successfully.
+type DependentBuilder interface {
+	// Ids of the builders the build depends on.
+	// An Id refers to all the builders having that Id.
+	Depends() []string
+}
+
+// ContextBuilder is implemented by builders supporting cancellation.
+// The builder is expected to stop as soon as the context is done
+// and to release all the resources it holds (loop devices, mount points)
+// before returning.
+type ContextBuilder interface {
+	// Id of the build
+	Id() string
+
+	// Run the build
+	RunContext(context.Context) (Artifact, error)
+}
+
+// AdaptBuilder returns context aware representation of the builder.
+// Builders not implementing ContextBuilder cannot be interrupted, so the context
+// is only checked before the build is started.
+func AdaptBuilder(b Builder) ContextBuilder {
+	if cb, ok := b.(ContextBuilder); ok {
+		return cb
+	}
+	return &builderAdapter{b}
+}
+
+type builderAdapter struct {
+	Builder
+}
+
+func (a *builderAdapter) RunContext(ctx context.Context) (Artifact, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Run()
+}
+
 // ImageBuilderData represents the common data
 // needed by appropriate image builder.
 type ImageBuilderData struct {
@@ -26,6 +70,17 @@ type ImageBuilderData struct {
 	// RootfsMp - path to the mount point where the image
 	// artifact will be mounted during customization.
 	RootfsMp string
+
+	// Dependencies - Ids of the builders the build depends on.
+	Dependencies []string
+
+	// Executor (optional) - runs the commands manipulating the image.
+	// By default the commands run on the host the image is built on.
+	Executor utils.Executor
+
+	// Cache (optional) - the image is copied from the cache
+	// instead of being built if it is cached already.
+	Cache *ArtifactCache
 }
 
 // MetadataBuilderData represents the common data
@@ -40,6 +95,13 @@ type MetadataBuilderData struct {
 	// UserData - any data provided by user and that will be
 	// written to destination metadata.
 	UserData interface{}
+
+	// Dependencies - Ids of the builders the build depends on.
+	Dependencies []string
+
+	// Executor (optional) - runs the commands writing the metadata.
+	// By default the commands run on the host the metadata is written to.
+	Executor utils.Executor
 }
 
 // DirBuilderData represents the common data
@@ -0,0 +1,214 @@
+package deployer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/utils"
+)
+
+// ArtifactCache keeps the images built by the image builders, so that
+// an image is copied from the cache instead of being rebuilt once
+// neither its configuration nor the inputs of the rootfs filler are changed.
+// The cache resides on the host the images are built on.
+// A nil ArtifactCache caches nothing.
+type ArtifactCache struct {
+	// Dir is the directory the images are cached in
+	Dir string
+
+	// MaxSize limits the disk space used by the cache (in bytes).
+	// The least recently used images are evicted once the limit is exceeded.
+	// Zero means no limit.
+	MaxSize int64
+
+	// MaxEntries limits the amount of cached images. Zero means no limit.
+	MaxEntries int
+}
+
+// Key returns the key of the image built from the disk configuration
+// by the rootfs filler. The key is a SHA256 digest of the configuration,
+// the bootloader type and the content of the inputs of the filler
+// (see InputRootfsFiller).
+// Returns empty key if the image cannot be cached: either the cache is nil
+// or the filler doesn't declare its inputs.
+func (c *ArtifactCache) Key(disk *image.Disk, filler RootfsFiller) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	var inputs []string
+	if filler != nil {
+		f, ok := filler.(InputRootfsFiller)
+		if !ok {
+			return "", nil
+		}
+		inputs = f.Inputs()
+	}
+
+	h := sha256.New()
+	// the path doesn't affect the content of the image
+	config := *disk
+	config.Path = ""
+	fb, err := json.Marshal(&config)
+	if err != nil {
+		return "", utils.FormatError(err)
+	}
+	fmt.Fprintf(h, "disk %s\nbootloader %s\nfiller %T\n", fb, disk.BootLoader, filler)
+	for i, input := range inputs {
+		fmt.Fprintf(h, "input %d\n", i)
+		if err := hashPath(h, input); err != nil {
+			return "", utils.FormatError(err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPath writes the content of the file (or of the files of the directory) to h.
+// A missing path is hashed as such.
+func hashPath(h hash.Hash, path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Fprintln(h, "missing")
+		return nil
+	}
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s %d\n", rel, fi.Mode(), fi.Size())
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(h, target)
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+}
+
+// entry returns path to the cached image
+func (c *ArtifactCache) entry(key string) string {
+	return filepath.Join(c.Dir, key)
+}
+
+// Lookup copies the cached image to dst (the copy is reflinked if the file system
+// supports that). Returns false if the image is not cached.
+func (c *ArtifactCache) Lookup(ctx context.Context, e utils.Executor, key, dst string) (bool, error) {
+	if c == nil || key == "" {
+		return false, nil
+	}
+	entry := c.entry(key)
+	if _, err := e.Execute(ctx, &utils.Command{Cmd: "test -f " + entry}); err != nil {
+		if _, ok := err.(*utils.ExitError); ok {
+			return false, nil
+		}
+		return false, utils.FormatError(err)
+	}
+	// touching the image marks it as recently used
+	if _, err := e.Execute(ctx, &utils.Command{Cmd: copyCmd(entry, dst) + " && touch " + entry}); err != nil {
+		return false, utils.FormatError(err)
+	}
+	return true, nil
+}
+
+// Store copies the image to the cache and evicts the least recently used
+// images exceeding the limits of the cache
+func (c *ArtifactCache) Store(ctx context.Context, e utils.Executor, key, src string) error {
+	if c == nil || key == "" {
+		return nil
+	}
+	// the image is copied under a temporary name, so that
+	// a partially copied image is never found by Lookup
+	entry := c.entry(key)
+	tmp := fmt.Sprintf("%s.tmp.%d", entry, time.Now().UnixNano())
+	cmd := fmt.Sprintf("mkdir -p %s && %s && mv -f %s %s", c.Dir, copyCmd(src, tmp), tmp, entry)
+	if _, err := e.Execute(ctx, &utils.Command{Cmd: cmd}); err != nil {
+		utils.Run(e, "rm -f "+tmp)
+		return utils.FormatError(err)
+	}
+	return c.Evict(ctx, e)
+}
+
+// cacheEntry describes a cached image
+type cacheEntry struct {
+	name  string
+	used  float64
+	usage int64
+}
+
+// Evict removes the least recently used images exceeding the limits of the cache
+func (c *ArtifactCache) Evict(ctx context.Context, e utils.Executor) error {
+	if c == nil || (c.MaxSize <= 0 && c.MaxEntries <= 0) {
+		return nil
+	}
+	// modification time and disk usage (in KiB) of the images
+	res, err := e.Execute(ctx, &utils.Command{Cmd: "find " + c.Dir + " -maxdepth 1 -type f -printf '%T@ %k %f\\n'"})
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	var entries []*cacheEntry
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || len(fields[2]) != sha256.Size*2 {
+			continue
+		}
+		used, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return utils.FormatError(fmt.Errorf("unexpected output of find: %q", line))
+		}
+		usage, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return utils.FormatError(fmt.Errorf("unexpected output of find: %q", line))
+		}
+		entries = append(entries, &cacheEntry{fields[2], used, usage * 1024})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].used > entries[j].used
+	})
+
+	var size int64
+	var evicted []string
+	for i, en := range entries {
+		size += en.usage
+		if (c.MaxSize > 0 && size > c.MaxSize) || (c.MaxEntries > 0 && i >= c.MaxEntries) {
+			evicted = append(evicted, c.entry(en.name))
+		}
+	}
+	if len(evicted) == 0 {
+		return nil
+	}
+	if _, err := e.Execute(ctx, &utils.Command{Cmd: "rm -f " + strings.Join(evicted, " ")}); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// copyCmd returns the command copying the image preserving its sparseness
+func copyCmd(src, dst string) string {
+	return fmt.Sprintf("cp --reflink=auto --sparse=always %s %s", src, dst)
+}
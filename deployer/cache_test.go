@@ -0,0 +1,115 @@
+package deployer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/utils"
+)
+
+type inputFiller struct {
+	inputs []string
+}
+
+func (f *inputFiller) CustomizeRootfs(string) error { return nil }
+func (f *inputFiller) InstallApp(string) error      { return nil }
+func (f *inputFiller) RunHooks(string) error        { return nil }
+func (f *inputFiller) Inputs() []string             { return f.inputs }
+
+// opaqueFiller doesn't declare its inputs
+type opaqueFiller struct{}
+
+func (f *opaqueFiller) CustomizeRootfs(string) error { return nil }
+func (f *opaqueFiller) InstallApp(string) error      { return nil }
+func (f *opaqueFiller) RunHooks(string) error        { return nil }
+
+func TestArtifactCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "appl.tgz")
+	config := filepath.Join(dir, "config")
+	if err := os.Mkdir(config, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(archive, []byte("application"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filler := &inputFiller{[]string{archive, config, filepath.Join(dir, "missing")}}
+	disk := &image.Disk{Path: "/var/lib/va.img", Type: image.StorageTypeRAW, SizeMb: 100, BootLoader: image.BootLoaderGrub2}
+	c := &ArtifactCache{Dir: filepath.Join(dir, "cache"), MaxEntries: 1}
+
+	key, err := c.Key(disk, filler)
+	if err != nil || len(key) != 64 {
+		t.Fatalf("unexpected key %q (%v)", key, err)
+	}
+	other := *disk
+	other.Path = "/tmp/va.img"
+	if k, _ := c.Key(&other, filler); k != key {
+		t.Fatal("the path is not supposed to affect the key")
+	}
+	other.BootLoader = image.BootLoaderExtlinux
+	if k, _ := c.Key(&other, filler); k == key {
+		t.Fatal("the bootloader is supposed to affect the key")
+	}
+	if err := ioutil.WriteFile(filepath.Join(config, "services.xml"), []byte("<services/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if k, _ := c.Key(disk, filler); k == key {
+		t.Fatal("the inputs are supposed to affect the key")
+	}
+	if key, _ = c.Key(disk, filler); key == "" {
+		t.Fatal("the key is empty")
+	}
+	if k, _ := c.Key(disk, &opaqueFiller{}); k != "" {
+		t.Fatal("the image of a filler not declaring its inputs is not supposed to be cached")
+	}
+	if k, _ := (*ArtifactCache)(nil).Key(disk, filler); k != "" {
+		t.Fatal("nil cache is not supposed to cache")
+	}
+
+	e := utils.NewExecutor(nil)
+	ctx := context.Background()
+	src := filepath.Join(dir, "va.img")
+	dst := filepath.Join(dir, "copy.img")
+	if err := ioutil.WriteFile(src, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := c.Lookup(ctx, e, key, dst); err != nil || cached {
+		t.Fatalf("the image is not supposed to be cached (%v)", err)
+	}
+	if err := c.Store(ctx, e, key, src); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := c.Lookup(ctx, e, key, dst); err != nil || !cached {
+		t.Fatalf("the image is supposed to be cached (%v)", err)
+	}
+	if fb, err := ioutil.ReadFile(dst); err != nil || string(fb) != "image" {
+		t.Fatalf("unexpected copy %q (%v)", fb, err)
+	}
+
+	// storing another image evicts the least recently used one
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(c.Dir, key), old, old); err != nil {
+		t.Fatal(err)
+	}
+	newer := strings.Repeat("a", 64)
+	if err := c.Store(ctx, e, newer, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, key)); !os.IsNotExist(err) {
+		t.Fatal("the image is supposed to be evicted")
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, newer)); err != nil {
+		t.Fatal(err)
+	}
+}
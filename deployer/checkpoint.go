@@ -0,0 +1,287 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/utils"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+// Stages of the deployment
+const (
+	StageConfig      = "config"
+	StageBuild       = "build"
+	StagePostProcess = "post-process"
+)
+
+// Checkpoint represents the persisted state of a deployment.
+// It is saved after each stage and after each builder completes,
+// so that a failed deployment can be resumed skipping the stages
+// whose outputs are still valid.
+type Checkpoint struct {
+	// Config is the resolved configuration of the deployment.
+	// Resuming replays it instead of asking the user.
+	Config *answers.Answers `json:"config,omitempty"`
+
+	// Stages contains the completed stages.
+	Stages []string `json:"stages"`
+
+	// Artifacts contains the artifacts created by the builders.
+	Artifacts []*CheckpointArtifact `json:"artifacts,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// CheckpointArtifact represents an artifact created by a builder
+type CheckpointArtifact struct {
+	// Builder is the Id of the builder that created the artifact
+	Builder string `json:"builder"`
+
+	// Index is the position of the builder in the list of builders
+	Index int `json:"index"`
+
+	Name string       `json:"name"`
+	Path string       `json:"path"`
+	Type ArtifactType `json:"type"`
+
+	// Remote indicates whether the artifact resides on the remote host
+	Remote bool `json:"remote"`
+
+	// Checksum is SHA256 of the artifact
+	Checksum string `json:"sha256"`
+}
+
+// NewCheckpoint creates an empty checkpoint persisted to the given file
+func NewCheckpoint(path string) *Checkpoint {
+	return &Checkpoint{path: path}
+}
+
+// LoadCheckpoint reads the checkpoint persisted to the given file
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := NewCheckpoint(path)
+	if err := json.Unmarshal(fb, cp); err != nil {
+		return nil, utils.FormatError(fmt.Errorf("checkpoint %s: %v", path, err))
+	}
+	return cp, nil
+}
+
+// Path returns path to the checkpoint file
+func (cp *Checkpoint) Path() string {
+	return cp.path
+}
+
+// Completed returns true if the stage is completed
+func (cp *Checkpoint) Completed(stage string) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for _, s := range cp.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete marks the stage as completed and saves the checkpoint
+func (cp *Checkpoint) Complete(stage string) error {
+	if cp.Completed(stage) {
+		return cp.Save()
+	}
+	cp.mu.Lock()
+	cp.Stages = append(cp.Stages, stage)
+	cp.mu.Unlock()
+	return cp.Save()
+}
+
+// Save writes the checkpoint to the file.
+// The file might contain SSH password and therefore is readable by owner only
+func (cp *Checkpoint) Save() error {
+	cp.mu.Lock()
+	fb, err := json.MarshalIndent(cp, "", "   ")
+	cp.mu.Unlock()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+
+	// the file is replaced atomically so that a crash never leaves it truncated
+	tmp, err := ioutil.TempFile(filepath.Dir(cp.path), filepath.Base(cp.path)+".")
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(fb, '\n')); err != nil {
+		tmp.Close()
+		return utils.FormatError(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return utils.FormatError(err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return utils.FormatError(err)
+	}
+	if err := os.Rename(tmp.Name(), cp.path); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// Remove removes the checkpoint file
+func (cp *Checkpoint) Remove() error {
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// Builders prepares the builders for running under the checkpoint.
+// Builders whose artifacts were recorded and are still valid (the artifact
+// exists and its checksum matches) are replaced by builders returning
+// the recorded artifacts; the rest record their artifacts once completed.
+func (cp *Checkpoint) Builders(builders []Builder) ([]Builder, error) {
+	var sshConfig *ssh.Config
+	if cp.Config != nil {
+		var err error
+		if sshConfig, err = cp.Config.SshConfig(); err != nil {
+			return nil, utils.FormatError(err)
+		}
+	}
+
+	cp.mu.Lock()
+	recorded := cp.Artifacts
+	cp.Artifacts = nil
+	cp.mu.Unlock()
+
+	list := make([]Builder, len(builders))
+	for i, b := range builders {
+		list[i] = &checkpointBuilder{b, i, cp}
+		for _, ca := range recorded {
+			if ca.Index != i || ca.Builder != b.Id() {
+				continue
+			}
+			a := &CommonArtifact{Name: ca.Name, Path: ca.Path, Type: ca.Type}
+			if ca.Remote {
+				a.SshConfig = sshConfig
+			}
+			if sum, err := checksum(a); err == nil && sum == ca.Checksum {
+				list[i] = &restoredBuilder{b, a}
+				cp.addArtifact(ca)
+			}
+			break
+		}
+	}
+	return list, nil
+}
+
+func (cp *Checkpoint) addArtifact(ca *CheckpointArtifact) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Artifacts = append(cp.Artifacts, ca)
+}
+
+// record calculates checksum of the artifact created by the builder
+// and saves the checkpoint
+func (cp *Checkpoint) record(b Builder, index int, a Artifact) error {
+	sum, err := checksum(a)
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	ca := &CheckpointArtifact{
+		Builder:  b.Id(),
+		Index:    index,
+		Name:     a.GetName(),
+		Path:     a.GetPath(),
+		Type:     a.GetType(),
+		Checksum: sum,
+	}
+	if c, ok := a.(*CommonArtifact); ok {
+		ca.Remote = c.SshConfig != nil
+	}
+	cp.addArtifact(ca)
+	return cp.Save()
+}
+
+// artifactExecutor returns executor running the commands on the host the artifact resides on
+func artifactExecutor(a Artifact) utils.Executor {
+	if c, ok := a.(*CommonArtifact); ok {
+		if c.Executor != nil {
+			return c.Executor
+		}
+		return utils.NewExecutor(c.SshConfig)
+	}
+	return utils.NewExecutor(nil)
+}
+
+// checksum calculates SHA256 of the artifact on the host the artifact resides on
+func checksum(a Artifact) (string, error) {
+	out, err := utils.Run(artifactExecutor(a), "sha256sum "+a.GetPath())
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("cannot calculate checksum of %s", a.GetPath())
+	}
+	return fields[0], nil
+}
+
+// checkpointBuilder records the artifact created by the builder
+type checkpointBuilder struct {
+	Builder
+	index int
+	cp    *Checkpoint
+}
+
+func (b *checkpointBuilder) Depends() []string {
+	return dependencies(b.Builder)
+}
+
+func (b *checkpointBuilder) Run() (Artifact, error) {
+	return b.RunContext(context.Background())
+}
+
+func (b *checkpointBuilder) RunContext(ctx context.Context) (Artifact, error) {
+	a, err := AdaptBuilder(b.Builder).RunContext(ctx)
+	if err != nil {
+		return a, err
+	}
+	if a != nil {
+		if err := b.cp.record(b.Builder, b.index, a); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// restoredBuilder returns the artifact created by a previous deployment
+type restoredBuilder struct {
+	Builder
+	artifact Artifact
+}
+
+func (b *restoredBuilder) Depends() []string {
+	return dependencies(b.Builder)
+}
+
+func (b *restoredBuilder) Run() (Artifact, error) {
+	return b.artifact, nil
+}
+
+func dependencies(b Builder) []string {
+	if db, ok := b.(DependentBuilder); ok {
+		return db.Depends()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package deployer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fileBuilder writes the artifact file and counts the builds
+type fileBuilder struct {
+	id     string
+	path   string
+	builds int
+}
+
+func (b *fileBuilder) Id() string {
+	return b.id
+}
+
+func (b *fileBuilder) Run() (Artifact, error) {
+	b.builds++
+	if err := ioutil.WriteFile(b.path, []byte(b.id), 0644); err != nil {
+		return nil, err
+	}
+	return &CommonArtifact{Name: b.id, Path: b.path, Type: ImageArtifact}, nil
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+	image := &fileBuilder{id: "ImageBuilder", path: filepath.Join(dir, "image")}
+	metadata := &fileBuilder{id: "MetadataBuilder", path: filepath.Join(dir, "metadata")}
+
+	cp := NewCheckpoint(path)
+	builders, err := cp.Builders([]Builder{image, metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildContext(context.Background(), builders); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Complete(StageBuild); err != nil {
+		t.Fatal(err)
+	}
+
+	// the metadata is modified, so only the image is valid
+	if err := ioutil.WriteFile(metadata.path, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Completed(StageBuild) || len(cp.Artifacts) != 2 {
+		t.Fatalf("unexpected checkpoint %+v", cp)
+	}
+	builders, err = cp.Builders([]Builder{image, metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := BuildContext(context.Background(), builders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.builds != 1 || metadata.builds != 2 {
+		t.Fatalf("unexpected builds: image %d, metadata %d", image.builds, metadata.builds)
+	}
+	if artifacts[0].GetPath() != image.path || artifacts[1].GetPath() != metadata.path {
+		t.Fatalf("unexpected artifacts %v", artifacts)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected permissions %v", fi.Mode())
+	}
+}
@@ -1,8 +1,17 @@
 package deployer
 
 import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"path/filepath"
+
 	"github.com/dorzheh/deployer/builder/image"
+	"github.com/dorzheh/deployer/config/answers"
+	"github.com/dorzheh/deployer/controller"
 	ui "github.com/dorzheh/deployer/ui/dialog_ui"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	ssh "github.com/dorzheh/infra/comm/common"
 )
 
@@ -26,6 +35,140 @@ type CommonData struct {
 
 	// Ui represents appropriate dialog based user interface.
 	Ui *ui.DialogUi
+
+	// Steps contains the configuration steps of the deployment.
+	// It is set by Deploy, so that the configurations of several hosts
+	// are created simultaneously. Nil refers to the global steps
+	// (see controller.RegisterSteps).
+	Steps *controller.Steps
+
+	// Answers represents pre-filled configuration.
+	// If set, the deployment is unattended and the UI is not used.
+	Answers *answers.Answers
+
+	// RecordFile is a path to the answers file the interactive
+	// session is recorded to. Empty means no recording.
+	RecordFile string
+
+	// Record collects the answers provided through the UI.
+	Record *answers.Answers
+
+	// KeepArtifacts indicates whether the artifacts should be kept
+	// when a failed deployment is rolled back.
+	KeepArtifacts bool
+
+	// BuildParallelism is the maximal amount of builders running
+	// simultaneously. Zero means the number of CPUs.
+	BuildParallelism int
+
+	// ProgressEvents receives progress events of the builders and
+	// post-processors in case the dialog based UI is not used.
+	ProgressEvents chan<- progress.Event
+
+	// Plan indicates whether the deployment should only be planned.
+	// The configuration is created as usual, but instead of building and
+	// post-processing the actions are written to PlanOutput (stdout if nil).
+	Plan bool
+
+	// PlanOutput receives the plan of the deployment.
+	PlanOutput io.Writer
+
+	// AuditLog is a path to the JSON-lines file every executed command
+	// is recorded to. Empty means no audit.
+	AuditLog string
+
+	// Checkpoint is a path to the file the state of the deployment
+	// is persisted to after each stage (see Resume).
+	// Empty means no checkpoint.
+	Checkpoint string
+
+	// Host is the name of the target host when the appliance
+	// is deployed to many hosts (see config/inventory).
+	Host string
+
+	// ReportFile is a path to the JSON report of the deployment.
+	// Empty means no report.
+	ReportFile string
+
+	// ReportHTMLFile is a path to the HTML report of the deployment.
+	// Empty means no HTML report.
+	ReportHTMLFile string
+
+	// ManifestFile is a path to the manifest of the built artifacts
+	// (see Manifest). Empty means the default path (see ManifestPath).
+	ManifestFile string
+
+	// SigningKey is a path to the ed25519 private key the manifest is signed with
+	// (see LoadPrivateKey). Empty means the manifest is not signed.
+	SigningKey string
+
+	// TrustedKeys is a path to the ed25519 public key (or to the directory of keys)
+	// trusted to sign the manifest (see LoadPublicKeys).
+	// Empty means the default path (see TrustedKeysPath).
+	TrustedKeys string
+
+	// RequireSignature indicates that the artifacts are not post-processed
+	// unless the manifest is signed by a trusted key, even if no keys are
+	// found (see TrustedPublicKeys).
+	RequireSignature bool
+
+	// Cache keeps the images built by the image builders (see ArtifactCache).
+	// Nil means the images are always built.
+	Cache *ArtifactCache
+
+	// Report collects the report of the deployment.
+	// It is set by Deploy if any report is requested.
+	Report *Report
+
+	// Transaction records side effects of the deployment.
+	// It is set by Deploy.
+	Transaction *Transaction
+}
+
+// HwinfoFile returns path to the file the hardware information
+// of the target host is stored to.
+func (c *CommonData) HwinfoFile() string {
+	if c.Host == "" {
+		return filepath.Join(c.RootDir, ".hwinfo.json")
+	}
+	return filepath.Join(c.RootDir, ".hwinfo."+c.Host+".json")
+}
+
+// ManifestPath returns path to the file the manifest of the artifacts
+// is written to.
+func (c *CommonData) ManifestPath() string {
+	switch {
+	case c.ManifestFile != "":
+		return c.ManifestFile
+	case c.Host == "":
+		return filepath.Join(c.RootDir, ".manifest.json")
+	}
+	return filepath.Join(c.RootDir, ".manifest."+c.Host+".json")
+}
+
+// TrustedKeysPath returns path to the public keys trusted to sign the manifest.
+// The keys are kept by the product kit in "trusted_keys" directory by default.
+// Once there are trusted keys, the artifacts are post-processed only if
+// the manifest is signed by one of them.
+func (c *CommonData) TrustedKeysPath() string {
+	if c.TrustedKeys != "" {
+		return c.TrustedKeys
+	}
+	return filepath.Join(c.RootDir, "trusted_keys")
+}
+
+// TrustedPublicKeys loads the keys trusted to sign the manifest.
+// Returns ErrNoTrustedKeys if RequireSignature is set and no keys are found.
+func (c *CommonData) TrustedPublicKeys() ([]ed25519.PublicKey, error) {
+	path := c.TrustedKeysPath()
+	keys, err := LoadPublicKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 && c.RequireSignature {
+		return nil, utils.FormatError(fmt.Errorf("%w (%s)", ErrNoTrustedKeys, path))
+	}
+	return keys, nil
 }
 
 // CommonConfig represents common configuration
@@ -1,6 +1,8 @@
 package deployer
 
 import (
+	"errors"
+
 	"github.com/dorzheh/deployer/utils/hwinfo/host"
 )
 
@@ -43,6 +45,49 @@ type EnvDriver interface {
 	AllCPUsPinned() (bool, error)
 }
 
+// ErrDomainNotFound is returned for the domains that are not deployed
+var ErrDomainNotFound = errors.New("domain not found")
+
+// DomainState represents state of a domain
+type DomainState string
+
+const (
+	DomainRunning DomainState = "running"
+	DomainPaused  DomainState = "paused"
+	DomainStopped DomainState = "stopped"
+	DomainUnknown DomainState = "unknown"
+)
+
+// Domain describes a deployed domain
+type Domain struct {
+	Name      string      `json:"name"`
+	State     DomainState `json:"state"`
+	Autostart bool        `json:"autostart"`
+}
+
+// DomainDriver is implemented by env drivers able to manage
+// the life cycle of the deployed domains by name.
+type DomainDriver interface {
+	EnvDriver
+
+	// Starts the deployed domain.
+	StartDeployedDomain(string) error
+
+	// Shuts the domain down gracefully.
+	// Returns once the shutdown is initiated.
+	ShutdownDomain(string) error
+
+	// Removes the domain definitions including autostart
+	// (doesn't remove appliance image).
+	RemoveDomain(string) error
+
+	// Returns the domain or ErrDomainNotFound.
+	Domain(string) (*Domain, error)
+
+	// Returns all the domains.
+	Domains() ([]*Domain, error)
+}
+
 // HostinfoDriver is the interface that has to be implemented in order to
 // gather appropriate HW information from either local or remote host
 type HostinfoDriver interface {
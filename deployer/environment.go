@@ -0,0 +1,93 @@
+package deployer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+// Environment represents a virtualization environment the appliance
+// can be deployed to. Environments register themselves (usually from
+// an init function of the package implementing the flow) so that
+// a generic command line (see package cli) can deploy to them by name.
+type Environment struct {
+	// Name identifies the environment on the command line ("libvirt-kvm").
+	Name string
+
+	// Title is shown by the UI and stored in the answers ("Libvirt(KVM)").
+	// The Name is used if empty.
+	Title string
+
+	// NewFlowCreator creates the flow deploying the appliance.
+	NewFlowCreator func() FlowCreator
+
+	// NewHostinfoDriver (optional) creates the driver collecting
+	// hardware information of the host (remote if conf is not nil).
+	NewHostinfoDriver func(c *CommonData, conf *ssh.Config) (HostinfoDriver, error)
+
+	// NewEnvDriver (optional) creates the driver managing the domains
+	// on the host (remote if conf is not nil).
+	NewEnvDriver func(conf *ssh.Config) EnvDriver
+}
+
+// String returns the title of the environment
+func (e *Environment) String() string {
+	if e.Title == "" {
+		return e.Name
+	}
+	return e.Title
+}
+
+var (
+	environmentsMu sync.Mutex
+	environments   = make(map[string]*Environment)
+)
+
+// RegisterEnvironment makes the environment available by its name.
+// Panics if the name is empty, the flow creator is not set or
+// an environment with the same name is registered already.
+func RegisterEnvironment(e *Environment) {
+	environmentsMu.Lock()
+	defer environmentsMu.Unlock()
+	if e.Name == "" || e.NewFlowCreator == nil {
+		panic("deployer: invalid environment " + e.String())
+	}
+	if _, ok := environments[e.Name]; ok {
+		panic("deployer: environment " + e.Name + " is registered twice")
+	}
+	environments[e.Name] = e
+}
+
+// LookupEnvironment returns the environment registered by the given name.
+// The title of the environment is accepted as well (case insensitive),
+// so that the environment stored in the answers can be looked up.
+func LookupEnvironment(name string) (*Environment, error) {
+	environmentsMu.Lock()
+	defer environmentsMu.Unlock()
+	if e, ok := environments[name]; ok {
+		return e, nil
+	}
+	for _, e := range environments {
+		if strings.EqualFold(e.String(), name) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown environment \"%s\"", name)
+}
+
+// Environments returns the registered environments sorted by name
+func Environments() []*Environment {
+	environmentsMu.Lock()
+	defer environmentsMu.Unlock()
+	list := make([]*Environment, 0, len(environments))
+	for _, e := range environments {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,42 @@
+package deployer
+
+import (
+	"testing"
+)
+
+func TestEnvironments(t *testing.T) {
+	e := &Environment{
+		Name:           "test-kvm",
+		Title:          "Test(KVM)",
+		NewFlowCreator: func() FlowCreator { return nil },
+	}
+	RegisterEnvironment(e)
+	defer func() {
+		environmentsMu.Lock()
+		delete(environments, e.Name)
+		environmentsMu.Unlock()
+	}()
+
+	for _, name := range []string{"test-kvm", "Test(KVM)", "test(kvm)"} {
+		found, err := LookupEnvironment(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != e {
+			t.Fatalf("unexpected environment %v", found)
+		}
+	}
+	if _, err := LookupEnvironment("test-xen"); err == nil {
+		t.Fatal("unknown environment is supposed to produce an error")
+	}
+	if envs := Environments(); len(envs) != 1 || envs[0] != e {
+		t.Fatalf("unexpected environments %v", envs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering the environment twice is supposed to panic")
+		}
+	}()
+	RegisterEnvironment(e)
+}
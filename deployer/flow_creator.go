@@ -12,3 +12,13 @@ type FlowCreator interface {
 	// Creates a post-processor.
 	CreatePostProcessor(*CommonData) (PostProcessor, error)
 }
+
+// PipelineFlowCreator is implemented by flow creators providing
+// an ordered list of post-processors rather than a single one.
+// CreatePostProcessor is not called in this case.
+type PipelineFlowCreator interface {
+	FlowCreator
+
+	// Creates post-processors in the order they should run.
+	CreatePostProcessors(*CommonData) ([]PostProcessor, error)
+}
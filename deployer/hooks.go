@@ -0,0 +1,154 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// HookPoint identifies the point of the deployment a hook is run at
+type HookPoint string
+
+const (
+	// BeforeConfig hooks run before the configuration is created
+	BeforeConfig HookPoint = "before-config"
+
+	// AfterConfig hooks run once the configuration is created
+	AfterConfig HookPoint = "after-config"
+
+	// BeforeBuilder hooks run before every builder is started
+	// (HookData.Builder is set)
+	BeforeBuilder HookPoint = "before-builder"
+
+	// AfterBuilder hooks run once every builder completes successfully
+	// (HookData.Builder and the artifact in HookData.Artifacts are set)
+	AfterBuilder HookPoint = "after-builder"
+
+	// BeforePostProcess hooks run before the artifacts are post-processed
+	BeforePostProcess HookPoint = "before-post-process"
+
+	// AfterPostProcess hooks run once the artifacts are post-processed
+	AfterPostProcess HookPoint = "after-post-process"
+
+	// OnFailure hooks run once the deployment fails, before the rollback
+	// (HookData.Err is set). Errors returned by the hooks are appended
+	// to the error of the deployment.
+	OnFailure HookPoint = "on-failure"
+)
+
+// HookData is passed to the hooks
+type HookData struct {
+	// Point the hook is run at
+	Point HookPoint
+
+	// Data is the common data of the deployment
+	Data *CommonData
+
+	// Builder is the builder the hook is run for (builder hooks only)
+	Builder Builder
+
+	// Artifacts contains the artifacts created so far
+	Artifacts []Artifact
+
+	// Err is the error the deployment failed with (OnFailure hooks only)
+	Err error
+}
+
+// Hook is a function run between the stages of the deployment.
+// A hook returning an error aborts the deployment.
+type Hook func(context.Context, *HookData) error
+
+// Hooks is a registry of the hooks.
+// The hooks registered at the same point are run in the order
+// of registration. The builder hooks might run simultaneously.
+// A nil Hooks is valid and runs nothing.
+type Hooks struct {
+	mu    sync.Mutex
+	hooks map[HookPoint][]Hook
+}
+
+// NewHooks creates an empty registry
+func NewHooks() *Hooks {
+	return &Hooks{hooks: make(map[HookPoint][]Hook)}
+}
+
+// Register adds the hooks run at the given point
+func (h *Hooks) Register(point HookPoint, hooks ...Hook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks[point] = append(h.hooks[point], hooks...)
+}
+
+// Reset removes all the registered hooks
+func (h *Hooks) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = make(map[HookPoint][]Hook)
+}
+
+// Run runs the hooks registered at d.Point.
+// Returns error of the first failed hook; the rest are not run.
+func (h *Hooks) Run(ctx context.Context, d *HookData) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	hooks := h.hooks[d.Point]
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, d); err != nil {
+			return fmt.Errorf("%s hook: %w", d.Point, err)
+		}
+	}
+	return nil
+}
+
+// Builders wraps the builders so that the builder hooks
+// are run around every build.
+func (h *Hooks) Builders(c *CommonData, builders []Builder) []Builder {
+	if h == nil {
+		return builders
+	}
+	list := make([]Builder, len(builders))
+	for i, b := range builders {
+		list[i] = &hookBuilder{b, h, c}
+	}
+	return list
+}
+
+// hookBuilder runs the builder hooks around the builder
+type hookBuilder struct {
+	Builder
+	hooks *Hooks
+	c     *CommonData
+}
+
+func (b *hookBuilder) Depends() []string {
+	return dependencies(b.Builder)
+}
+
+func (b *hookBuilder) Run() (Artifact, error) {
+	return b.RunContext(context.Background())
+}
+
+func (b *hookBuilder) RunContext(ctx context.Context) (Artifact, error) {
+	if err := b.hooks.Run(ctx, &HookData{Point: BeforeBuilder, Data: b.c, Builder: b.Builder}); err != nil {
+		return nil, err
+	}
+	a, err := AdaptBuilder(b.Builder).RunContext(ctx)
+	if err != nil {
+		return a, err
+	}
+	d := &HookData{Point: AfterBuilder, Data: b.c, Builder: b.Builder}
+	if a != nil {
+		d.Artifacts = []Artifact{a}
+	}
+	if err := b.hooks.Run(ctx, d); err != nil {
+		// the scheduler records artifacts of successful builders only
+		if a != nil {
+			TransactionFromContext(ctx).RecordArtifact("destroy artifact "+a.GetPath(), a.Destroy)
+		}
+		return nil, err
+	}
+	return a, nil
+}
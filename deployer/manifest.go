@@ -0,0 +1,288 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dorzheh/deployer/utils"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+// Manifest describes the artifacts created by the deployment.
+// It is written once the artifacts are built and allows re-checking
+// the artifacts before they are post-processed (see Verify).
+type Manifest struct {
+	Product   string              `json:"product"`
+	Host      string              `json:"host,omitempty"`
+	Created   time.Time           `json:"created"`
+	Artifacts []*ManifestArtifact `json:"artifacts"`
+
+	// Signature (optional) proves the manifest is created by the owner
+	// of a trusted key (see Sign and VerifySignature)
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// ManifestArtifact describes an artifact
+type ManifestArtifact struct {
+	Name   string       `json:"name"`
+	Path   string       `json:"path"`
+	Type   ArtifactType `json:"type"`
+	Format string       `json:"format"`
+
+	// VirtualSize is the size of the disk the image represents
+	// (unknown unless qemu-img is installed on the host the image resides on)
+	VirtualSize int64 `json:"virtual_size,omitempty"`
+
+	// Size is the disk usage of the artifact
+	Size     int64     `json:"size"`
+	Checksum string    `json:"sha256"`
+	Created  time.Time `json:"created"`
+	Builder  string    `json:"builder,omitempty"`
+
+	// Remote indicates whether the artifact resides on the remote host
+	Remote bool `json:"remote"`
+}
+
+// NewManifest creates manifest of the artifacts.
+// The artifacts not inspected yet (see CommonArtifact.Inspect) are inspected.
+func NewManifest(product string, artifacts []Artifact) (*Manifest, error) {
+	m := &Manifest{Product: product, Created: time.Now()}
+	if err := m.Add(artifacts); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add appends the artifacts to the manifest (the artifacts created
+// by the post-processors and so forth).
+// The artifacts not inspected yet (see CommonArtifact.Inspect) are inspected.
+// The signature (if any) doesn't cover the added artifacts until the manifest is signed again.
+func (m *Manifest) Add(artifacts []Artifact) error {
+	for _, a := range artifacts {
+		c, ok := a.(*CommonArtifact)
+		if !ok {
+			ma, err := inspect(a)
+			if err != nil {
+				return utils.FormatError(err)
+			}
+			m.Artifacts = append(m.Artifacts, ma)
+			continue
+		}
+		if c.Checksum == "" {
+			if err := c.Inspect(); err != nil {
+				return err
+			}
+		}
+		m.Artifacts = append(m.Artifacts, &ManifestArtifact{
+			Name:        c.Name,
+			Path:        c.Path,
+			Type:        c.Type,
+			Format:      c.Format,
+			VirtualSize: c.VirtualSize,
+			Size:        c.Size,
+			Checksum:    c.Checksum,
+			Created:     c.Created,
+			Builder:     c.Builder,
+			Remote:      c.SshConfig != nil,
+		})
+	}
+	return nil
+}
+
+// Move refers the entry of the artifact residing at the given path
+// to the new location of the artifact (uploaded to the remote host and so forth).
+// The signature (if any) doesn't cover the change until the manifest is signed again.
+func (m *Manifest) Move(path string, a Artifact) error {
+	ma := m.Artifact(path)
+	if ma == nil {
+		return utils.FormatError(fmt.Errorf("manifest: %s is not found", path))
+	}
+	ma.Name = a.GetName()
+	ma.Path = a.GetPath()
+	ma.Remote = isRemote(a)
+	return nil
+}
+
+// isRemote returns true if the artifact resides on the remote host
+func isRemote(a Artifact) bool {
+	c, ok := a.(*CommonArtifact)
+	return ok && c.SshConfig != nil
+}
+
+// Artifact returns the manifest entry of the artifact residing at the path or nil
+func (m *Manifest) Artifact(path string) *ManifestArtifact {
+	if m == nil {
+		return nil
+	}
+	for _, ma := range m.Artifacts {
+		if ma.Path == path {
+			return ma
+		}
+	}
+	return nil
+}
+
+// LoadManifest reads the manifest from the given file
+func LoadManifest(path string) (*Manifest, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(fb, m); err != nil {
+		return nil, utils.FormatError(fmt.Errorf("manifest %s: %v", path, err))
+	}
+	return m, nil
+}
+
+// WriteFile writes the manifest as JSON
+func (m *Manifest) WriteFile(path string) error {
+	fb, err := json.MarshalIndent(m, "", "   ")
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	if err := ioutil.WriteFile(path, append(fb, '\n'), 0644); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+type manifestKey struct{}
+
+// WithManifest returns a copy of the context carrying the manifest
+// the post-processors may check the artifacts against
+func WithManifest(ctx context.Context, m *Manifest) context.Context {
+	return context.WithValue(ctx, manifestKey{}, m)
+}
+
+// ManifestFromContext returns the manifest carried by the context or nil
+func ManifestFromContext(ctx context.Context) *Manifest {
+	m, _ := ctx.Value(manifestKey{}).(*Manifest)
+	return m
+}
+
+// VerifyError lists the artifacts not matching the manifest
+type VerifyError struct {
+	Errors []error
+}
+
+func (e *VerifyError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap allows errors.Is and errors.As to inspect every error.
+func (e *VerifyError) Unwrap() []error {
+	return e.Errors
+}
+
+// Verify re-checks existence and checksum of the artifacts.
+// The disk usage is not compared, since it may change while the content
+// remains intact (e.g. the filesystem releases preallocated blocks).
+// The remote artifacts are checked on the host described by the SSH config.
+// Returns VerifyError if any artifact doesn't match the manifest.
+func (m *Manifest) Verify(conf *ssh.Config) error {
+	var remote utils.Executor
+	if conf != nil {
+		remote = utils.NewExecutor(conf)
+	}
+	return m.VerifyExecutor(remote)
+}
+
+// VerifyExecutor is like Verify but the remote artifacts are checked
+// by the given executor.
+func (m *Manifest) VerifyExecutor(remote utils.Executor) error {
+	var errs []error
+	for _, ma := range m.Artifacts {
+		a := &CommonArtifact{Name: ma.Name, Path: ma.Path, Type: ma.Type, Executor: utils.NewExecutor(nil)}
+		if ma.Remote {
+			if remote == nil {
+				errs = append(errs, fmt.Errorf("%s: remote host is not set", ma.Path))
+				continue
+			}
+			a.Executor = remote
+		}
+		actual, err := inspect(a)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %v", ma.Path, err))
+		case actual.Checksum != ma.Checksum:
+			errs = append(errs, fmt.Errorf("%s: checksum %s doesn't match the manifest (%s)", ma.Path, actual.Checksum, ma.Checksum))
+		}
+	}
+	if len(errs) > 0 {
+		return utils.FormatError(&VerifyError{errs})
+	}
+	return nil
+}
+
+// inspect examines the artifact on the host it resides on
+func inspect(a Artifact) (*ManifestArtifact, error) {
+	e := artifactExecutor(a)
+	// the disk usage of sparse and qcow2 images differs from their apparent size
+	out, err := utils.Run(e, "stat -L -c '%b %B %Y' "+a.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected output of stat: %q", out)
+	}
+	var values [3]int64
+	for i, f := range fields {
+		if values[i], err = strconv.ParseInt(f, 10, 64); err != nil {
+			return nil, fmt.Errorf("unexpected output of stat: %q", out)
+		}
+	}
+	sum, err := checksum(a)
+	if err != nil {
+		return nil, err
+	}
+
+	ma := &ManifestArtifact{
+		Name:     a.GetName(),
+		Path:     a.GetPath(),
+		Type:     a.GetType(),
+		Format:   extensionFormat(a),
+		Size:     values[0] * values[1],
+		Checksum: sum,
+		Created:  time.Unix(values[2], 0),
+	}
+	if c, ok := a.(*CommonArtifact); ok {
+		ma.Builder = c.Builder
+		ma.Remote = c.SshConfig != nil
+	}
+	if a.GetType() == ImageArtifact {
+		// qemu-img is not necessarily installed, the format is guessed then
+		// and the virtual size is unknown
+		if out, err := utils.Run(e, "qemu-img info --output=json "+a.GetPath()); err == nil {
+			info := new(struct {
+				Format      string `json:"format"`
+				VirtualSize int64  `json:"virtual-size"`
+			})
+			if err := json.Unmarshal([]byte(out), info); err == nil && info.Format != "" {
+				ma.Format = info.Format
+				ma.VirtualSize = info.VirtualSize
+			}
+		}
+	}
+	return ma, nil
+}
+
+// extensionFormat guesses format of the artifact by its extension
+func extensionFormat(a Artifact) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(a.GetPath()), "."))
+	if a.GetType() == ImageArtifact && (ext == "" || ext == "img") {
+		return "raw"
+	}
+	return ext
+}
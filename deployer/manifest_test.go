@@ -0,0 +1,106 @@
+package deployer
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dorzheh/deployer/utils"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "va.img")
+	metadata := filepath.Join(dir, "va.xml")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(metadata, []byte("<domain/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// remote artifact is examined through the executor
+	remote := &utils.RecordingExecutor{Respond: func(c *utils.Command) (*utils.Result, error) {
+		switch {
+		case strings.HasPrefix(c.Cmd, "stat "):
+			return &utils.Result{Stdout: "2 512 1500000000"}, nil
+		case strings.HasPrefix(c.Cmd, "sha256sum "):
+			return &utils.Result{Stdout: "abcd  /var/lib/va.qcow2"}, nil
+		case strings.HasPrefix(c.Cmd, "qemu-img "):
+			return &utils.Result{Stdout: `{"format": "qcow2", "virtual-size": 10737418240}`}, nil
+		}
+		return nil, nil
+	}}
+	artifacts := []Artifact{
+		&CommonArtifact{Name: "va.img", Path: image, Type: ImageArtifact, Builder: "ImageBuilder"},
+		&CommonArtifact{Name: "va.xml", Path: metadata, Type: MetadataArtifact},
+	}
+	m, err := NewManifest("va", artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, meta := m.Artifacts[0], m.Artifacts[1]
+	if img.Size%512 != 0 || img.Builder != "ImageBuilder" || len(img.Checksum) != 64 || img.Created.IsZero() || img.Remote {
+		t.Fatalf("unexpected image %+v", img)
+	}
+	if meta.Format != "xml" || meta.VirtualSize != 0 {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	if c := artifacts[0].(*CommonArtifact); c.Checksum != img.Checksum {
+		t.Fatal("artifact is supposed to be inspected")
+	}
+
+	qcow2 := &CommonArtifact{Name: "va.qcow2", Path: "/var/lib/va.qcow2", Type: ImageArtifact, Executor: remote}
+	if err := qcow2.Inspect(); err != nil {
+		t.Fatal(err)
+	}
+	if qcow2.Format != "qcow2" || qcow2.VirtualSize != 10737418240 || qcow2.Size != 1024 || qcow2.Checksum != "abcd" {
+		t.Fatalf("unexpected remote artifact %+v", qcow2)
+	}
+	// the virtual size is unknown without qemu-img
+	noQemu := &utils.RecordingExecutor{Respond: func(c *utils.Command) (*utils.Result, error) {
+		if strings.HasPrefix(c.Cmd, "qemu-img ") {
+			return nil, &utils.ExitError{Cmd: c.Cmd, ExitCode: 127}
+		}
+		return remote.Respond(c)
+	}}
+	sparse := &CommonArtifact{Name: "va.img", Path: "/var/lib/va.img", Type: ImageArtifact, Executor: noQemu}
+	if err := sparse.Inspect(); err != nil {
+		t.Fatal(err)
+	}
+	if sparse.Format != "raw" || sparse.VirtualSize != 0 || sparse.Size != 1024 {
+		t.Fatalf("unexpected remote artifact %+v", sparse)
+	}
+	m.Artifacts = append(m.Artifacts, &ManifestArtifact{Path: qcow2.Path, Size: 1024, Checksum: "abcd", Remote: true})
+
+	path := filepath.Join(dir, "manifest.json")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = LoadManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifyExecutor(remote); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(nil); err == nil {
+		t.Fatal("remote artifact is not supposed to be verified without SSH config")
+	}
+
+	if err := ioutil.WriteFile(image, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(metadata)
+	err = m.VerifyExecutor(remote)
+	var verr *VerifyError
+	if !errors.As(err, &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dorzheh/deployer/utils/progress"
+)
+
+// ArtifactPostProcessor is implemented by post-processors producing
+// new artifacts (exported images, reports and so forth).
+type ArtifactPostProcessor interface {
+	// Processes given artifacts unless the context is done.
+	// Returns the artifacts created by the post-processor.
+	PostProcessArtifacts(context.Context, []Artifact) ([]Artifact, error)
+}
+
+// Pipeline is an ordered list of post-processors.
+// Every post-processor receives the artifacts created by the builders
+// and by the post-processors preceding it in the pipeline.
+type Pipeline []PostProcessor
+
+// PipelineError reports the post-processor that failed.
+type PipelineError struct {
+	// Step is the index of the post-processor in the pipeline
+	Step int
+
+	// Id of the post-processor
+	Id string
+
+	Err error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("post-processor %s (step %d): %v", e.Id, e.Step+1, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// PostProcess runs the pipeline
+func (p Pipeline) PostProcess(artifacts []Artifact) error {
+	return p.PostProcessContext(context.Background(), artifacts)
+}
+
+// PostProcessContext runs the pipeline unless the context is done
+func (p Pipeline) PostProcessContext(ctx context.Context, artifacts []Artifact) error {
+	_, err := p.PostProcessArtifacts(ctx, artifacts)
+	return err
+}
+
+// PostProcessArtifacts runs the pipeline and returns the artifacts
+// created by the post-processors.
+// The created artifacts are recorded by the transaction carried by the context (if any).
+func (p Pipeline) PostProcessArtifacts(ctx context.Context, artifacts []Artifact) ([]Artifact, error) {
+	var created []Artifact
+	all := append([]Artifact(nil), artifacts...)
+	r := progress.FromContext(ctx)
+	for i, pp := range p {
+		id := PostProcessorId(pp)
+		r.WithSource("Pipeline").Stage(fmt.Sprintf("step %d/%d", i+1, len(p)), id)
+		stepCtx := progress.NewContext(ctx, r.WithSource(id))
+
+		var err error
+		var out []Artifact
+		if ap, ok := pp.(ArtifactPostProcessor); ok {
+			out, err = ap.PostProcessArtifacts(stepCtx, all)
+		} else {
+			err = PostProcessContext(stepCtx, pp, all)
+		}
+		if err != nil {
+			return created, &PipelineError{i, id, err}
+		}
+		for _, a := range out {
+			TransactionFromContext(ctx).RecordArtifact("destroy artifact "+a.GetPath(), a.Destroy)
+		}
+		created = append(created, out...)
+		all = append(all, out...)
+	}
+	return created, nil
+}
+
+// PostProcessorId returns the Id of the post-processor.
+// Post-processors may implement Id() string; otherwise the type name is used
+func PostProcessorId(p PostProcessor) string {
+	if i, ok := p.(interface {
+		Id() string
+	}); ok {
+		return i.Id()
+	}
+	return fmt.Sprintf("%T", p)
+}
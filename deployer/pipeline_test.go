@@ -0,0 +1,77 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type exportPostProcessor struct {
+	seen []string
+}
+
+func (p *exportPostProcessor) Id() string {
+	return "export"
+}
+
+func (p *exportPostProcessor) PostProcess(artifacts []Artifact) error {
+	return errors.New("not supposed to be called")
+}
+
+func (p *exportPostProcessor) PostProcessArtifacts(ctx context.Context, artifacts []Artifact) ([]Artifact, error) {
+	for _, a := range artifacts {
+		p.seen = append(p.seen, a.GetName())
+	}
+	return []Artifact{&CommonArtifact{Name: "exported", Path: "/tmp/exported"}}, nil
+}
+
+type checkPostProcessor struct {
+	seen []string
+	err  error
+}
+
+func (p *checkPostProcessor) PostProcess(artifacts []Artifact) error {
+	for _, a := range artifacts {
+		p.seen = append(p.seen, a.GetName())
+	}
+	return p.err
+}
+
+func TestPipeline(t *testing.T) {
+	export := new(exportPostProcessor)
+	check := new(checkPostProcessor)
+	tr := NewTransaction(true)
+	ctx := WithTransaction(context.Background(), tr)
+
+	created, err := Pipeline{export, check}.PostProcessArtifacts(ctx, []Artifact{&CommonArtifact{Name: "image"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].GetName() != "exported" {
+		t.Fatalf("unexpected artifacts %v", created)
+	}
+	if len(export.seen) != 1 || export.seen[0] != "image" {
+		t.Fatalf("export received %v", export.seen)
+	}
+	if len(check.seen) != 2 || check.seen[1] != "exported" {
+		t.Fatalf("check received %v", check.seen)
+	}
+	if len(tr.entries) != 1 || !tr.entries[0].artifact {
+		t.Fatal("created artifact is not recorded")
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	failure := errors.New("check failed")
+	err := Pipeline{new(exportPostProcessor), &checkPostProcessor{err: failure}}.PostProcess(nil)
+	var perr *PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if perr.Step != 1 || perr.Id != "*deployer.checkPostProcessor" {
+		t.Fatalf("unexpected step %d (%s)", perr.Step, perr.Id)
+	}
+	if !errors.Is(err, failure) {
+		t.Fatal("original error is lost")
+	}
+}
@@ -0,0 +1,106 @@
+package deployer
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dorzheh/deployer/utils"
+)
+
+// BuilderPlanner is implemented by builders able to describe
+// the build without performing it.
+type BuilderPlanner interface {
+	// Writes the actions the build consists of.
+	// Returns the artifact the build would create.
+	Plan(io.Writer) (Artifact, error)
+}
+
+// PostProcessorPlanner is implemented by post-processors able to describe
+// the post-processing without performing it.
+type PostProcessorPlanner interface {
+	// Writes the actions post-processing given artifacts.
+	Plan(io.Writer, []Artifact) error
+}
+
+// PlanRootfsFiller is implemented by fillers able to describe
+// the rootfs customization without performing it.
+type PlanRootfsFiller interface {
+	RootfsFiller
+
+	// Writes the actions populating the rootfs and installing the application.
+	// Receives rootfs mount point.
+	PlanRootfs(io.Writer, string) error
+}
+
+// PlannedArtifact represents an artifact a build would create.
+type PlannedArtifact struct {
+	CommonArtifact
+
+	// Content of the artifact if it is known in advance (metadata)
+	Content string
+}
+
+// Destroy does nothing since planned artifacts are never created
+func (a *PlannedArtifact) Destroy() error {
+	return nil
+}
+
+// Plan writes the actions the builders and the post-processor would perform to w.
+// The builders are described in the order they could be run sequentially.
+// Nothing is executed, so no special privileges are needed.
+func Plan(w io.Writer, builders []Builder, post PostProcessor) error {
+	_, _, order, err := buildGraph(builders)
+	if err != nil {
+		return utils.FormatError(err)
+	}
+
+	var artifacts []Artifact
+	for _, i := range order {
+		b := builders[i]
+		fmt.Fprintf(w, "### %s\n", b.Id())
+		p, ok := b.(BuilderPlanner)
+		if !ok {
+			fmt.Fprintln(w, "# the builder cannot be planned")
+			continue
+		}
+		a, err := p.Plan(w)
+		if err != nil {
+			return utils.FormatError(fmt.Errorf("%s: %v", b.Id(), err))
+		}
+		if a != nil {
+			artifacts = append(artifacts, a)
+		}
+	}
+	if post == nil {
+		return nil
+	}
+
+	id := PostProcessorId(post)
+	fmt.Fprintf(w, "### %s\n", id)
+	p, ok := post.(PostProcessorPlanner)
+	if !ok {
+		_, err := fmt.Fprintln(w, "# the post-processor cannot be planned")
+		return err
+	}
+	if err := p.Plan(w, artifacts); err != nil {
+		return utils.FormatError(fmt.Errorf("%s: %v", id, err))
+	}
+	return nil
+}
+
+// Plan describes every post-processor of the pipeline.
+func (p Pipeline) Plan(w io.Writer, artifacts []Artifact) error {
+	for i, pp := range p {
+		id := PostProcessorId(pp)
+		fmt.Fprintf(w, "## step %d/%d: %s\n", i+1, len(p), id)
+		planner, ok := pp.(PostProcessorPlanner)
+		if !ok {
+			fmt.Fprintln(w, "# the post-processor cannot be planned")
+			continue
+		}
+		if err := planner.Plan(w, artifacts); err != nil {
+			return &PipelineError{i, id, err}
+		}
+	}
+	return nil
+}
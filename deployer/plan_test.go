@@ -0,0 +1,62 @@
+package deployer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type planningBuilder struct {
+	recordingBuilder
+}
+
+func (b *planningBuilder) Run() (Artifact, error) {
+	return nil, fmt.Errorf("%s is not supposed to run", b.id)
+}
+
+func (b *planningBuilder) Plan(w io.Writer) (Artifact, error) {
+	fmt.Fprintf(w, "build %s\n", b.id)
+	return &PlannedArtifact{CommonArtifact: CommonArtifact{Name: b.id}}, nil
+}
+
+type planningPostProcessor struct{}
+
+func (p *planningPostProcessor) PostProcess(artifacts []Artifact) error {
+	return fmt.Errorf("post-processor is not supposed to run")
+}
+
+func (p *planningPostProcessor) Plan(w io.Writer, artifacts []Artifact) error {
+	for _, a := range artifacts {
+		fmt.Fprintf(w, "process %s\n", a.GetName())
+	}
+	return nil
+}
+
+func TestPlan(t *testing.T) {
+	builders := []Builder{
+		&planningBuilder{recordingBuilder{id: "MetadataBuilder", depends: []string{"ImageBuilder"}}},
+		&planningBuilder{recordingBuilder{id: "ImageBuilder"}},
+		&failingBuilder{},
+	}
+	buf := new(bytes.Buffer)
+	if err := Plan(buf, builders, Pipeline{new(planningPostProcessor)}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"### ImageBuilder",
+		"build ImageBuilder",
+		"### FailingBuilder",
+		"# the builder cannot be planned",
+		"### MetadataBuilder",
+		"build MetadataBuilder",
+		"### deployer.Pipeline",
+		"## step 1/1: *deployer.planningPostProcessor",
+		"process ImageBuilder",
+		"process MetadataBuilder",
+	}
+	if out := strings.TrimSpace(buf.String()); out != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected plan:\n%s", out)
+	}
+}
@@ -1,26 +1,71 @@
 package deployer
 
 import (
+	"context"
+
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 )
 
 // PostProcessProgress is responsible for representing a progress
 // during post-processing of appropriate artifact.
+// The progress bar is driven by the progress events reported by the post-processor.
+// If the UI is not used, the events are sent to c.ProgressEvents (if set).
 func PostProcessProgress(c *CommonData, p PostProcessor, artifacts []Artifact) error {
+	_, err := PostProcessProgressContext(context.Background(), c, p, artifacts)
+	return err
+}
+
+// PostProcessProgressContext is like PostProcessProgress but the post-processing
+// is cancelled once the context is done.
+// Returns the given artifacts followed by the artifacts created
+// by the post-processor (see ArtifactPostProcessor).
+func PostProcessProgressContext(ctx context.Context, c *CommonData, p PostProcessor, artifacts []Artifact) ([]Artifact, error) {
 	if c.Ui == nil {
-		return p.PostProcess(artifacts)
+		if c.ProgressEvents != nil {
+			ctx = progress.NewContext(ctx, progress.NewReporter(c.ProgressEvents, ctx.Done()))
+		}
+		return postProcessArtifacts(ctx, p, artifacts)
 	}
 
 	errChan := make(chan error)
 	defer close(errChan)
+
+	events := make(chan progress.Event)
+	ctx = progress.NewContext(ctx, progress.NewReporter(events, ctx.Done()))
+	var all []Artifact
 	go func() {
-		errChan <- p.PostProcess(artifacts)
+		var err error
+		all, err = postProcessArtifacts(ctx, p, artifacts)
+		errChan <- err
 	}()
 
 	progressBarTitle := "Post-processing"
 	progressBarMsg := "\n" + c.VaName + " installation in progress.Please wait..."
-	if err := c.Ui.Progress(progressBarTitle, progressBarMsg, c.Ui.Pb.Sleep(), c.Ui.Pb.Step(), errChan); err != nil {
-		return utils.FormatError(err)
+	if err := c.Ui.ProgressEvents(progressBarTitle, progressBarMsg, events, errChan); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return all, nil
+}
+
+// postProcessArtifacts runs the post-processor and returns the given artifacts
+// followed by the artifacts created by the post-processor.
+// The created artifacts are recorded by the transaction carried by the context (if any).
+func postProcessArtifacts(ctx context.Context, p PostProcessor, artifacts []Artifact) ([]Artifact, error) {
+	all := append([]Artifact(nil), artifacts...)
+	ap, ok := p.(ArtifactPostProcessor)
+	if !ok {
+		return all, PostProcessContext(ctx, p, artifacts)
+	}
+	created, err := ap.PostProcessArtifacts(ctx, artifacts)
+	if _, ok := p.(Pipeline); !ok {
+		// the pipeline records the artifacts by itself
+		for _, a := range created {
+			TransactionFromContext(ctx).RecordArtifact("destroy artifact "+a.GetPath(), a.Destroy)
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return append(all, created...), nil
 }
@@ -1,8 +1,34 @@
 package deployer
 
+import (
+	"context"
+
+	"github.com/dorzheh/deployer/utils/progress"
+)
+
 // PostProcessor is the interface that has to be
 // implemented in order to post-process appropriate artifact.
 type PostProcessor interface {
 	// Processes given artifacts
 	PostProcess([]Artifact) error
 }
+
+// ContextPostProcessor is implemented by post-processors supporting cancellation.
+type ContextPostProcessor interface {
+	// Processes given artifacts unless the context is done
+	PostProcessContext(context.Context, []Artifact) error
+}
+
+// PostProcessContext runs the post-processor with the given context.
+// Post-processors not implementing ContextPostProcessor are not started
+// if the context is already done.
+func PostProcessContext(ctx context.Context, p PostProcessor, artifacts []Artifact) error {
+	if cp, ok := p.(ContextPostProcessor); ok {
+		return cp.PostProcessContext(ctx, artifacts)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	progress.FromContext(ctx).Stage("post-processing", "")
+	return p.PostProcess(artifacts)
+}
@@ -0,0 +1,434 @@
+package deployer
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+	"github.com/dorzheh/deployer/utils/hwinfo/host"
+)
+
+// Report describes what was done by the deployment.
+// It is written as JSON (and optionally as HTML) so that
+// it can be attached to support tickets.
+// A nil Report is valid and records nothing.
+type Report struct {
+	Product   string    `json:"product"`
+	Host      string    `json:"host,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Succeeded bool      `json:"succeeded"`
+	Error     string    `json:"error,omitempty"`
+
+	// Failure describes the failure (stage, host, command and so forth)
+	Failure *utils.ErrorDetails `json:"failure,omitempty"`
+
+	// AuditLog is the path to the log of the executed commands (if any)
+	AuditLog string `json:"audit_log,omitempty"`
+
+	// Hardware of the target host
+	Hardware *ReportHardware `json:"hardware,omitempty"`
+
+	// Bundle is the selected bundle configuration (if any)
+	Bundle map[string]interface{} `json:"bundle,omitempty"`
+
+	// Guest is the final guest configuration
+	Guest *guest.Config `json:"guest,omitempty"`
+
+	// Networks maps the guest networks to the host NICs
+	Networks []*ReportNetwork `json:"networks,omitempty"`
+
+	// Metadata is the rendered metadata (domain XML and so forth)
+	Metadata string `json:"metadata,omitempty"`
+
+	Artifacts []*ReportArtifact `json:"artifacts,omitempty"`
+	Stages    []*ReportStage    `json:"stages,omitempty"`
+
+	// Drivers maps the environment drivers to their versions
+	Drivers map[string]string `json:"drivers,omitempty"`
+
+	mu sync.Mutex
+}
+
+// ReportHardware represents hardware of the target host
+type ReportHardware struct {
+	RamMb int            `json:"ram_mb"`
+	CPUs  int            `json:"cpus"`
+	CPU   *host.CPU      `json:"cpu,omitempty"`
+	NUMA  host.NUMANodes `json:"numa,omitempty"`
+	NICs  host.NICList   `json:"nics,omitempty"`
+}
+
+// ReportNetwork represents the host NICs a guest network is connected to
+type ReportNetwork struct {
+	Name string   `json:"name"`
+	NICs []string `json:"nics"`
+}
+
+// ReportArtifact represents an artifact created by the deployment
+type ReportArtifact struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Type     ArtifactType `json:"type"`
+	Size     int64        `json:"size"`
+	Checksum string       `json:"sha256"`
+
+	// Remote indicates whether the artifact resides on the remote host
+	Remote bool `json:"remote"`
+}
+
+// ReportStage represents a stage of the deployment
+type ReportStage struct {
+	Name       string    `json:"name"`
+	Started    time.Time `json:"started"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewReport creates a report of the deployment of the given product
+func NewReport(product string) *Report {
+	return &Report{Product: product, Started: time.Now()}
+}
+
+// SetHardware records hardware of the target host
+func (r *Report) SetHardware(hw HostinfoDriver) error {
+	if r == nil {
+		return nil
+	}
+	h, err := CollectHardware(hw)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Hardware = h
+	return nil
+}
+
+// CollectHardware returns the hardware of the host described by the driver
+func CollectHardware(hw HostinfoDriver) (*ReportHardware, error) {
+	h := new(ReportHardware)
+	var err error
+	if h.RamMb, err = hw.RAMSize(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if h.CPUs, err = hw.CPUs(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if h.CPU, err = hw.CPUInfo(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if h.NUMA, err = hw.NUMAInfo(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if h.NICs, err = hw.NICs(); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return h, nil
+}
+
+// SetGuest records the selected bundle and the final guest configuration
+func (r *Report) SetGuest(bundle map[string]interface{}, gconf *guest.Config) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Bundle = bundle
+	r.Guest = gconf
+	r.Networks = nil
+	for i, net := range gconf.Networks {
+		rnet := &ReportNetwork{Name: net.Name}
+		if i < len(gconf.NICLists) {
+			for _, gnic := range gconf.NICLists[i] {
+				name := gnic.HostNIC.Name
+				if gnic.HostNIC.PCIAddr != "" && gnic.HostNIC.PCIAddr != "N/A" {
+					name += " (" + gnic.HostNIC.PCIAddr + ")"
+				}
+				rnet.NICs = append(rnet.NICs, name)
+			}
+		}
+		r.Networks = append(r.Networks, rnet)
+	}
+}
+
+// SetDriver records version of the environment driver
+func (r *Report) SetDriver(d EnvDriver) error {
+	if r == nil {
+		return nil
+	}
+	version, err := d.Version()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Drivers == nil {
+		r.Drivers = make(map[string]string)
+	}
+	r.Drivers[d.Id()] = version
+	return nil
+}
+
+// AddArtifacts records sizes and checksums of the artifacts.
+// The content of the metadata artifacts is recorded as the rendered metadata.
+func (r *Report) AddArtifacts(artifacts []Artifact) error {
+	if r == nil {
+		return nil
+	}
+	for _, a := range artifacts {
+		var size int64
+		var sum string
+		// the inspected artifacts are not examined again
+		if c, ok := a.(*CommonArtifact); ok && c.Checksum != "" {
+			size, sum = c.Size, c.Checksum
+		} else {
+			ma, err := inspect(a)
+			if err != nil {
+				return utils.FormatError(err)
+			}
+			size, sum = ma.Size, ma.Checksum
+		}
+		var metadata string
+		if a.GetType() == MetadataArtifact {
+			out, err := utils.Run(artifactExecutor(a), "cat "+a.GetPath())
+			if err != nil {
+				return utils.FormatError(err)
+			}
+			metadata = out
+		}
+
+		r.mu.Lock()
+		r.Artifacts = append(r.Artifacts, &ReportArtifact{
+			Name:     a.GetName(),
+			Path:     a.GetPath(),
+			Type:     a.GetType(),
+			Size:     size,
+			Checksum: sum,
+			Remote:   isRemote(a),
+		})
+		if metadata != "" {
+			r.Metadata += metadata + "\n"
+		}
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// MoveArtifact refers the artifact residing at the given path
+// to the new location of the artifact (uploaded to the remote host and so forth)
+func (r *Report) MoveArtifact(path string, a Artifact) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ra := range r.Artifacts {
+		if ra.Path == path {
+			ra.Name = a.GetName()
+			ra.Path = a.GetPath()
+			ra.Remote = isRemote(a)
+			return
+		}
+	}
+}
+
+// Stage records a stage of the deployment started at the given time
+func (r *Report) Stage(name string, started time.Time, err error) {
+	if r == nil {
+		return
+	}
+	s := &ReportStage{
+		Name:       name,
+		Started:    started,
+		DurationMs: int64(time.Since(started) / time.Millisecond),
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Stages = append(r.Stages, s)
+}
+
+// Finish records the result of the deployment
+func (r *Report) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Finished = time.Now()
+	r.Succeeded = err == nil
+	r.Error = ""
+	r.Failure = utils.Details(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// WriteFile writes the report as JSON
+func (r *Report) WriteFile(path string) error {
+	r.mu.Lock()
+	fb, err := json.MarshalIndent(r, "", "   ")
+	r.mu.Unlock()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	if err := ioutil.WriteFile(path, append(fb, '\n'), 0644); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// WriteHTMLFile writes the report as a standalone HTML page
+func (r *Report) WriteHTMLFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	defer f.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := reportTemplate.Execute(f, r); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		fb, err := json.MarshalIndent(v, "", "  ")
+		return string(fb), err
+	},
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Product}} deployment report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+.failed { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{.Product}} deployment report</h1>
+<table>
+<tr><th>Host</th><td>{{if .Host}}{{.Host}}{{else}}-{{end}}</td></tr>
+<tr><th>Started</th><td>{{.Started}}</td></tr>
+<tr><th>Finished</th><td>{{.Finished}}</td></tr>
+<tr><th>Result</th><td>{{if .Succeeded}}succeeded{{else}}<span class="failed">failed</span>{{end}}</td></tr>
+{{- if .AuditLog}}
+<tr><th>Audit log</th><td>{{.AuditLog}}</td></tr>
+{{- end}}
+{{- if .Error}}
+<tr><th>Error</th><td><pre>{{.Error}}</pre></td></tr>
+{{- end}}
+{{- with .Failure}}
+{{- if .Stage}}
+<tr><th>Failed stage</th><td>{{.Stage}}</td></tr>
+{{- end}}
+{{- if .Command}}
+<tr><th>Failed command</th><td><pre>{{.Command}} (exit status {{.ExitCode}})</pre></td></tr>
+{{- end}}
+{{- end}}
+</table>
+
+<h2>Stages</h2>
+<table>
+<tr><th>Stage</th><th>Started</th><th>Duration</th><th>Error</th></tr>
+{{- range .Stages}}
+<tr><td>{{.Name}}</td><td>{{.Started}}</td><td>{{.DurationMs}} ms</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+
+{{- if .Drivers}}
+<h2>Drivers</h2>
+<table>
+{{- range $id, $version := .Drivers}}
+<tr><th>{{$id}}</th><td>{{$version}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- with .Hardware}}
+<h2>Host hardware</h2>
+<table>
+<tr><th>RAM</th><td>{{.RamMb}} MB</td></tr>
+<tr><th>CPUs</th><td>{{.CPUs}}</td></tr>
+{{- with .CPU}}
+<tr><th>CPU</th><td>{{.Type}}</td></tr>
+{{- end}}
+</table>
+<h3>NUMA</h3>
+<table>
+<tr><th>Cell</th><th>CPUs</th><th>Total RAM</th><th>Free RAM</th></tr>
+{{- range .NUMA}}
+<tr><td>{{.CellID}}</td><td>{{.CPUs}}</td><td>{{.TotalRAM}}</td><td>{{.FreeRAM}}</td></tr>
+{{- end}}
+</table>
+<h3>NICs</h3>
+<table>
+<tr><th>Name</th><th>PCI</th><th>Type</th><th>Driver</th><th>NUMA</th><th>Description</th></tr>
+{{- range .NICs}}
+<tr><td>{{.Name}}</td><td>{{.PCIAddr}}</td><td>{{.Type}}</td><td>{{.Driver}}</td><td>{{.NUMANode}}</td><td>{{.Desc}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- if .Bundle}}
+<h2>Bundle</h2>
+<pre>{{json .Bundle}}</pre>
+{{- end}}
+
+{{- if .Networks}}
+<h2>Networks</h2>
+<table>
+<tr><th>Network</th><th>Host NICs</th></tr>
+{{- range .Networks}}
+<tr><td>{{.Name}}</td><td>{{join .NICs ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+{{- with .Guest}}
+<h2>Guest configuration</h2>
+<table>
+<tr><th>vCPUs</th><td>{{.CPUs}}</td></tr>
+<tr><th>RAM</th><td>{{.RamMb}} MB</td></tr>
+</table>
+<h3>vCPU pinning</h3>
+<table>
+<tr><th>Virtual NUMA</th><th>Memory</th><th>vCPU &rarr; host CPUs</th></tr>
+{{- range .NUMAs}}
+<tr><td>{{.CellID}}</td><td>{{.MemoryMb}} MB</td><td>{{range $vcpu, $cpus := .CPUPin}}{{$vcpu}} &rarr; {{$cpus}}<br>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Artifacts</h2>
+<table>
+<tr><th>Name</th><th>Path</th><th>Size</th><th>SHA256</th></tr>
+{{- range .Artifacts}}
+<tr><td>{{.Name}}</td><td>{{.Path}}{{if .Remote}} (remote host){{end}}</td><td>{{.Size}}</td><td>{{.Checksum}}</td></tr>
+{{- end}}
+</table>
+
+{{- if .Metadata}}
+<h2>Metadata</h2>
+<pre>{{.Metadata}}</pre>
+{{- end}}
+</body>
+</html>
+`))
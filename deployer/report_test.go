@@ -0,0 +1,118 @@
+package deployer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/config/xmlinput"
+	"github.com/dorzheh/deployer/utils/hwinfo/guest"
+	"github.com/dorzheh/deployer/utils/hwinfo/host"
+)
+
+type reportHostinfo struct{}
+
+func (reportHostinfo) Init() error                 { return nil }
+func (reportHostinfo) RAMSize() (int, error)       { return 16384, nil }
+func (reportHostinfo) CPUs() (int, error)          { return 8, nil }
+func (reportHostinfo) CPUInfo() (*host.CPU, error) { return &host.CPU{Type: "x86_64"}, nil }
+func (reportHostinfo) NUMAInfo() (host.NUMANodes, error) {
+	return host.NUMANodes{{CellID: 0, CPUs: []int{0, 1}}}, nil
+}
+func (reportHostinfo) NICs() (host.NICList, error) {
+	return host.NICList{{Name: "eth0", PCIAddr: "0000:03:00.0"}}, nil
+}
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.qcow2")
+	metadata := filepath.Join(dir, "domain.xml")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(metadata, []byte("<domain/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gconf := guest.NewConfig()
+	gconf.CPUs = 2
+	gconf.NUMAs = []*guest.NUMA{{CellID: 0, CPUPin: map[int][]int{0: {0}, 1: {1}}}}
+	gconf.Networks = []*xmlinput.Network{{Name: "Management"}}
+	nic := guest.NewNIC()
+	nic.HostNIC = &host.NIC{Name: "eth0", PCIAddr: "0000:03:00.0"}
+	gconf.NICLists = []guest.NICList{{nic}}
+
+	r := NewReport("myproduct")
+	r.AuditLog = filepath.Join(dir, "audit.log")
+	if err := r.SetHardware(reportHostinfo{}); err != nil {
+		t.Fatal(err)
+	}
+	r.SetGuest(map[string]interface{}{"name": "Test2", "cpus": 2}, gconf)
+	r.Stage(StageBuild, time.Now(), nil)
+	err = r.AddArtifacts([]Artifact{
+		&CommonArtifact{Name: "image", Path: image, Type: ImageArtifact},
+		&CommonArtifact{Name: "metadata", Path: metadata, Type: MetadataArtifact},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Finish(nil)
+
+	jsonFile := filepath.Join(dir, "report.json")
+	htmlFile := filepath.Join(dir, "report.html")
+	if err := r.WriteFile(jsonFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteHTMLFile(htmlFile); err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := ioutil.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Report
+	if err := json.Unmarshal(fb, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Succeeded || parsed.Hardware.RamMb != 16384 || parsed.Metadata != "<domain/>\n" || parsed.AuditLog != r.AuditLog {
+		t.Fatalf("unexpected report %s", fb)
+	}
+	if len(parsed.Artifacts) != 2 || parsed.Artifacts[0].Size%512 != 0 || len(parsed.Artifacts[0].Checksum) != 64 {
+		t.Fatalf("unexpected artifacts %s", fb)
+	}
+	if len(parsed.Networks) != 1 || parsed.Networks[0].NICs[0] != "eth0 (0000:03:00.0)" {
+		t.Fatalf("unexpected networks %s", fb)
+	}
+	if parsed.Guest.NUMAs[0].CPUPin[1][0] != 1 {
+		t.Fatalf("unexpected guest configuration %s", fb)
+	}
+
+	html, err := ioutil.ReadFile(htmlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"myproduct deployment report", image, "&lt;domain/&gt;", "eth0 (0000:03:00.0)", r.AuditLog} {
+		if !strings.Contains(string(html), s) {
+			t.Fatalf("%q is missing in the HTML report", s)
+		}
+	}
+}
+
+func TestNilReport(t *testing.T) {
+	var r *Report
+	r.Stage(StageConfig, time.Now(), nil)
+	r.Finish(nil)
+	if err := r.AddArtifacts([]Artifact{&CommonArtifact{Path: "/nonexistent"}}); err != nil {
+		t.Fatal(err)
+	}
+}
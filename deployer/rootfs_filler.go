@@ -1,5 +1,9 @@
 package deployer
 
+import (
+	"github.com/dorzheh/deployer/utils/progress"
+)
+
 // Implementers of Rootfs are responsible for populating rootfs
 // and installing stuff belonging to application.
 type RootfsFiller interface {
@@ -16,3 +20,22 @@ type RootfsFiller interface {
 	// when rootfs postprocessing is required
 	RunHooks(string) error
 }
+
+// ProgressRootfsFiller is implemented by fillers reporting
+// progress of their stages (extraction, installation and so forth).
+type ProgressRootfsFiller interface {
+	RootfsFiller
+
+	// Receives the reporter the progress events should be sent to.
+	SetProgressReporter(*progress.Reporter)
+}
+
+// InputRootfsFiller is implemented by fillers declaring the files
+// the rootfs is populated from (archives, configuration directories and so forth).
+// The images populated by such fillers are cached (see ArtifactCache).
+type InputRootfsFiller interface {
+	RootfsFiller
+
+	// Returns paths to the files and directories read by the filler.
+	Inputs() []string
+}
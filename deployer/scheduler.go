@@ -0,0 +1,180 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
+)
+
+// Scheduler runs builders as a directed acyclic graph.
+// A builder implementing DependentBuilder is started once all the builders
+// it depends on completed successfully; independent builders run in parallel.
+type Scheduler struct {
+	// Parallelism is the maximal amount of builders running simultaneously.
+	// Zero means the number of CPUs.
+	Parallelism int
+}
+
+// buildResult contains result of a build.
+type buildResult struct {
+	index    int
+	artifact Artifact
+	err      error
+}
+
+// Build runs the builders and returns the artifacts in the order of the builders.
+// Once a builder fails, the running builders are cancelled and the pending
+// ones are not started.
+func (s *Scheduler) Build(ctx context.Context, builders []Builder) ([]Artifact, error) {
+	dependents, pending, _, err := buildGraph(builders)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+
+	parallelism := s.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ready []int
+	for i := range builders {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	results := make([]Artifact, len(builders))
+	ch := make(chan *buildResult, len(builders))
+	var failed, cancelled []error
+	running := 0
+	for {
+		for ctx.Err() == nil && running < parallelism && len(ready) > 0 {
+			i := ready[0]
+			ready = ready[1:]
+			running++
+			go func(i int, b ContextBuilder) {
+				r := progress.FromContext(ctx).WithSource(b.Id())
+				artifact, err := b.RunContext(progress.NewContext(ctx, r))
+				if err == nil {
+					r.Report(progress.Event{Stage: "done", Percent: 100})
+				}
+				// Forwards created artifact to the channel.
+				ch <- &buildResult{i, artifact, err}
+			}(i, AdaptBuilder(builders[i]))
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-ch
+		running--
+		id := builders[result.index].Id()
+		switch {
+		case result.err == nil:
+			if result.artifact != nil {
+				a := result.artifact
+				TransactionFromContext(ctx).RecordArtifact("destroy artifact "+a.GetPath(), a.Destroy)
+				if c, ok := a.(*CommonArtifact); ok && c.Builder == "" {
+					c.Builder = id
+				}
+			}
+			results[result.index] = result.artifact
+			for _, j := range dependents[result.index] {
+				if pending[j]--; pending[j] == 0 {
+					ready = append(ready, j)
+				}
+			}
+		case ctx.Err() != nil && (errors.Is(result.err, context.Canceled) || errors.Is(result.err, context.DeadlineExceeded)):
+			cancelled = append(cancelled, utils.SourceError(id, result.err))
+		default:
+			failed = append(failed, utils.SourceError(id, result.err))
+			// stop sibling builders
+			cancel()
+		}
+	}
+
+	if len(failed) == 0 {
+		failed = cancelled
+	}
+	if len(failed) == 0 && ctx.Err() != nil {
+		// cancelled before all the builders were started
+		failed = append(failed, ctx.Err())
+	}
+	if len(failed) > 0 {
+		return nil, &BuildError{failed}
+	}
+
+	var artifacts []Artifact
+	for _, a := range results {
+		if a != nil {
+			artifacts = append(artifacts, a)
+		}
+	}
+	return artifacts, nil
+}
+
+// buildGraph resolves the dependencies of the builders.
+// Returns the indexes of the dependent builders for every builder,
+// the amount of dependencies every builder waits for
+// and the indexes of the builders in the order they can be run sequentially
+func buildGraph(builders []Builder) ([][]int, []int, []int, error) {
+	byId := make(map[string][]int)
+	for i, b := range builders {
+		byId[b.Id()] = append(byId[b.Id()], i)
+	}
+
+	dependents := make([][]int, len(builders))
+	pending := make([]int, len(builders))
+	for i, b := range builders {
+		db, ok := b.(DependentBuilder)
+		if !ok {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, id := range db.Depends() {
+			deps, ok := byId[id]
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("builder %s depends on unknown builder %s", b.Id(), id)
+			}
+			for _, j := range deps {
+				if j == i || seen[j] {
+					continue
+				}
+				seen[j] = true
+				dependents[j] = append(dependents[j], i)
+				pending[i]++
+			}
+		}
+	}
+
+	// make sure the graph has no cycles
+	left := append([]int(nil), pending...)
+	var queue []int
+	for i := range builders {
+		if left[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	var order []int
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		order = append(order, i)
+		for _, j := range dependents[i] {
+			if left[j]--; left[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if len(order) != len(builders) {
+		return nil, nil, nil, errors.New("circular dependency between builders")
+	}
+	return dependents, pending, order, nil
+}
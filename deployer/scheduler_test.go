@@ -0,0 +1,100 @@
+package deployer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingBuilder struct {
+	id      string
+	depends []string
+	log     *buildLog
+}
+
+type buildLog struct {
+	sync.Mutex
+	finished []string
+	running  int
+	maxRun   int
+}
+
+func (b *recordingBuilder) Id() string {
+	return b.id
+}
+
+func (b *recordingBuilder) Depends() []string {
+	return b.depends
+}
+
+func (b *recordingBuilder) Run() (Artifact, error) {
+	b.log.Lock()
+	b.log.running++
+	if b.log.running > b.log.maxRun {
+		b.log.maxRun = b.log.running
+	}
+	b.log.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	b.log.Lock()
+	b.log.running--
+	b.log.finished = append(b.log.finished, b.id)
+	b.log.Unlock()
+	return &CommonArtifact{Name: b.id}, nil
+}
+
+func TestSchedulerDependencies(t *testing.T) {
+	log := new(buildLog)
+	builders := []Builder{
+		&recordingBuilder{"MetadataBuilder", []string{"ImageBuilder"}, log},
+		&recordingBuilder{"ImageBuilder", []string{"RootDiskBuilder"}, log},
+		&recordingBuilder{"ImageBuilder", nil, log},
+		&recordingBuilder{"RootDiskBuilder", nil, log},
+	}
+	artifacts, err := (&Scheduler{Parallelism: 4}).Build(context.Background(), builders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 4 || artifacts[0].GetName() != "MetadataBuilder" {
+		t.Fatalf("unexpected artifacts %v", artifacts)
+	}
+	if log.finished[3] != "MetadataBuilder" {
+		t.Fatalf("unexpected build order %v", log.finished)
+	}
+	for i, id := range log.finished {
+		if id == "RootDiskBuilder" && i > 1 {
+			t.Fatalf("unexpected build order %v", log.finished)
+		}
+	}
+}
+
+func TestSchedulerParallelism(t *testing.T) {
+	log := new(buildLog)
+	var builders []Builder
+	for i := 0; i < 6; i++ {
+		builders = append(builders, &recordingBuilder{"ImageBuilder", nil, log})
+	}
+	if _, err := (&Scheduler{Parallelism: 2}).Build(context.Background(), builders); err != nil {
+		t.Fatal(err)
+	}
+	if log.maxRun > 2 {
+		t.Fatalf("%d builders were running simultaneously", log.maxRun)
+	}
+}
+
+func TestSchedulerBadGraph(t *testing.T) {
+	log := new(buildLog)
+	for _, builders := range [][]Builder{
+		{&recordingBuilder{"A", []string{"B"}, log}, &recordingBuilder{"B", []string{"A"}, log}},
+		{&recordingBuilder{"A", []string{"C"}, log}},
+	} {
+		if _, err := new(Scheduler).Build(context.Background(), builders); err == nil {
+			t.Fatal("supposed to produce an error")
+		}
+	}
+	if len(log.finished) != 0 {
+		t.Fatal("builders supposed not to run")
+	}
+}
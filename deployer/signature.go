@@ -0,0 +1,150 @@
+package deployer
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dorzheh/deployer/utils"
+)
+
+// ErrUnsigned is returned by VerifySignature if the manifest is not signed
+var ErrUnsigned = errors.New("the manifest is not signed")
+
+// ErrNoTrustedKeys is returned by CommonData.TrustedPublicKeys
+// if the signature is required but no keys are trusted
+var ErrNoTrustedKeys = errors.New("the manifest signature is required but no keys are trusted")
+
+// Signature is the ed25519 signature of the manifest
+type Signature struct {
+	// KeyId identifies the public key verifying the signature (see KeyId)
+	KeyId string `json:"key_id"`
+
+	Value []byte `json:"value"`
+}
+
+// KeyId returns the identifier of the public key: the first 8 bytes
+// of its SHA256 digest in hex
+func KeyId(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signed returns the content of the manifest covered by the signature
+func (m *Manifest) signed() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs the manifest with the key
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	data, err := m.signed()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	m.Signature = &Signature{
+		KeyId: KeyId(key.Public().(ed25519.PublicKey)),
+		Value: ed25519.Sign(key, data),
+	}
+	return nil
+}
+
+// VerifySignature checks that the manifest is signed by one of the trusted keys.
+// Returns ErrUnsigned if the manifest is not signed.
+func (m *Manifest) VerifySignature(trusted []ed25519.PublicKey) error {
+	if m.Signature == nil {
+		return utils.FormatError(ErrUnsigned)
+	}
+	data, err := m.signed()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	for _, key := range trusted {
+		if KeyId(key) != m.Signature.KeyId {
+			continue
+		}
+		if !ed25519.Verify(key, data, m.Signature.Value) {
+			return utils.FormatError(fmt.Errorf("the manifest signature doesn't match the content (key %s)", m.Signature.KeyId))
+		}
+		return nil
+	}
+	return utils.FormatError(fmt.Errorf("the manifest is signed by untrusted key %s", m.Signature.KeyId))
+}
+
+// LoadPrivateKey reads PEM encoded (PKCS #8) ed25519 private key,
+// as generated by "openssl genpkey -algorithm ed25519"
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, utils.FormatError(fmt.Errorf("%s: %v", path, err))
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, utils.FormatError(fmt.Errorf("%s: not an ed25519 private key", path))
+	}
+	return ed, nil
+}
+
+// LoadPublicKeys reads PEM encoded (PKIX) ed25519 public keys, as extracted
+// by "openssl pkey -pubout". The path is either a key file or a directory
+// of *.pem files. Returns no keys if the path doesn't exist.
+func LoadPublicKeys(path string) ([]ed25519.PublicKey, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	files := []string{path}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.pem")); err != nil {
+			return nil, utils.FormatError(err)
+		}
+		sort.Strings(files)
+	}
+	var keys []ed25519.PublicKey
+	for _, f := range files {
+		der, err := readPEM(f, "PUBLIC KEY")
+		if err != nil {
+			return nil, utils.FormatError(err)
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, utils.FormatError(fmt.Errorf("%s: %v", f, err))
+		}
+		ed, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, utils.FormatError(fmt.Errorf("%s: not an ed25519 public key", f))
+		}
+		keys = append(keys, ed)
+	}
+	return keys, nil
+}
+
+// readPEM returns the content of the PEM block of the given type
+func readPEM(path, blockType string) ([]byte, error) {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(fb)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: PEM encoded %s is expected", path, blockType)
+	}
+	return block.Bytes, nil
+}
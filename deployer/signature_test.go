@@ -0,0 +1,96 @@
+package deployer
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeys generates ed25519 key pair and writes PEM encoded keys to the files
+func writeKeys(t *testing.T, private, public string) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(private, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(public, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trusted := filepath.Join(dir, "trusted_keys")
+	if err := os.Mkdir(trusted, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeKeys(t, filepath.Join(dir, "build.key"), filepath.Join(trusted, "build.pem"))
+	writeKeys(t, filepath.Join(dir, "other.key"), filepath.Join(dir, "other.pem"))
+
+	if keys, err := LoadPublicKeys(filepath.Join(dir, "missing")); err != nil || keys != nil {
+		t.Fatalf("no keys are expected (%v)", err)
+	}
+	keys, err := LoadPublicKeys(trusted)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("unexpected keys %v (%v)", keys, err)
+	}
+	if _, err := LoadPrivateKey(filepath.Join(trusted, "build.pem")); err == nil {
+		t.Fatal("public key is not supposed to be loaded as private")
+	}
+	key, err := LoadPrivateKey(filepath.Join(dir, "build.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{Product: "va", Created: time.Now(), Artifacts: []*ManifestArtifact{
+		{Name: "va.img", Path: "/var/lib/va.img", Size: 5, Checksum: "abcd"},
+	}}
+	if err := m.VerifySignature(keys); !errors.Is(err, ErrUnsigned) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := m.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = LoadManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySignature(keys); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := LoadPublicKeys(filepath.Join(dir, "other.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySignature(other); err == nil {
+		t.Fatal("untrusted signature is supposed to produce an error")
+	}
+	m.Artifacts[0].Checksum = "dcba"
+	if err := m.VerifySignature(keys); err == nil {
+		t.Fatal("tampered manifest is supposed to produce an error")
+	}
+}
@@ -0,0 +1,114 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Transaction records side effects of a deployment (created artifacts,
+// defined domains, copied configuration files and so forth)
+// so that they can be undone in case the deployment fails.
+// A nil Transaction is valid and records nothing.
+type Transaction struct {
+	// KeepArtifacts indicates whether the artifacts should be left
+	// intact on rollback (useful for debugging).
+	KeepArtifacts bool
+
+	mu      sync.Mutex
+	entries []*undoEntry
+}
+
+type undoEntry struct {
+	desc      string
+	artifact  bool
+	temporary bool
+	undo      func() error
+}
+
+// NewTransaction creates an empty transaction
+func NewTransaction(keepArtifacts bool) *Transaction {
+	return &Transaction{KeepArtifacts: keepArtifacts}
+}
+
+// Record registers a function undoing a side effect
+func (t *Transaction) Record(desc string, undo func() error) {
+	t.record(&undoEntry{desc: desc, undo: undo})
+}
+
+// RecordArtifact registers a function removing an artifact.
+// The function is not called on rollback if KeepArtifacts is set
+func (t *Transaction) RecordArtifact(desc string, undo func() error) {
+	t.record(&undoEntry{desc: desc, artifact: true, undo: undo})
+}
+
+// RecordTemporary registers a function removing a temporary file.
+// The function is called on rollback as well as on commit
+func (t *Transaction) RecordTemporary(desc string, remove func() error) {
+	t.record(&undoEntry{desc: desc, temporary: true, undo: remove})
+}
+
+func (t *Transaction) record(e *undoEntry) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, e)
+}
+
+// Rollback undoes the recorded side effects in reverse order.
+// Rollback doesn't stop on failure; errors of all failed entries are returned
+func (t *Transaction) Rollback() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	entries := t.entries
+	t.entries = nil
+	t.mu.Unlock()
+
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.artifact && t.KeepArtifacts {
+			continue
+		}
+		if err := e.undo(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.desc, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Commit discards the recorded side effects and removes the temporary files.
+// Failing to remove a temporary file doesn't fail the commit
+func (t *Transaction) Commit() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	entries := t.entries
+	t.entries = nil
+	t.mu.Unlock()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].temporary {
+			entries[i].undo()
+		}
+	}
+}
+
+type transactionKey struct{}
+
+// WithTransaction returns a copy of the context carrying the transaction
+func WithTransaction(ctx context.Context, t *Transaction) context.Context {
+	return context.WithValue(ctx, transactionKey{}, t)
+}
+
+// TransactionFromContext returns the transaction carried by the context or nil
+func TransactionFromContext(ctx context.Context) *Transaction {
+	t, _ := ctx.Value(transactionKey{}).(*Transaction)
+	return t
+}
@@ -0,0 +1,85 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	var undone []string
+	undo := func(name string) func() error {
+		return func() error {
+			undone = append(undone, name)
+			return nil
+		}
+	}
+
+	tr := NewTransaction(false)
+	tr.RecordArtifact("image", undo("image"))
+	tr.Record("define", undo("define"))
+	tr.Record("autostart", func() error {
+		undone = append(undone, "autostart")
+		return errors.New("autostart failed")
+	})
+	if err := tr.Rollback(); err == nil {
+		t.Fatal("supposed to produce an error")
+	}
+	if !reflect.DeepEqual(undone, []string{"autostart", "define", "image"}) {
+		t.Fatalf("unexpected rollback order %v", undone)
+	}
+
+	// rollback is not repeated
+	undone = nil
+	if err := tr.Rollback(); err != nil || len(undone) != 0 {
+		t.Fatal("transaction supposed to be empty")
+	}
+}
+
+func TestTransactionTemporary(t *testing.T) {
+	var removed []string
+	remove := func(name string) func() error {
+		return func() error {
+			removed = append(removed, name)
+			return nil
+		}
+	}
+	for _, commit := range []bool{true, false} {
+		removed = nil
+		tr := NewTransaction(true)
+		tr.RecordTemporary("metadata", remove("metadata"))
+		tr.RecordArtifact("image", remove("image"))
+		if commit {
+			tr.Commit()
+		} else if err := tr.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(removed, []string{"metadata"}) {
+			t.Fatalf("unexpected removal %v (commit %v)", removed, commit)
+		}
+	}
+}
+
+func TestTransactionKeepArtifacts(t *testing.T) {
+	var undone []string
+	tr := NewTransaction(true)
+	ctx := WithTransaction(context.Background(), tr)
+	TransactionFromContext(ctx).RecordArtifact("image", func() error {
+		undone = append(undone, "image")
+		return nil
+	})
+	TransactionFromContext(ctx).Record("define", func() error {
+		undone = append(undone, "define")
+		return nil
+	})
+	if err := tr.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(undone, []string{"define"}) {
+		t.Fatalf("unexpected rollback %v", undone)
+	}
+
+	// nil transaction records nothing
+	TransactionFromContext(context.Background()).Record("nothing", nil)
+}
@@ -1,24 +1,36 @@
 package libvirt_kvm
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 
 	"github.com/clbanning/mxj"
+	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/utils"
 	ssh "github.com/dorzheh/infra/comm/common"
 )
 
 type Driver struct {
 	sync.Mutex
-	Run func(string) (string, error)
+
+	// Executor runs the commands on the host managed by the driver
+	Executor utils.Executor
 }
 
 func NewDriver(config *ssh.Config) *Driver {
-	d := new(Driver)
-	d.Run = utils.RunFunc(config)
-	return d
+	return NewDriverWithExecutor(utils.NewExecutor(config))
+}
+
+// NewDriverWithExecutor creates a driver running the commands by means of the executor
+func NewDriverWithExecutor(e utils.Executor) *Driver {
+	return &Driver{Executor: e}
+}
+
+// Run runs the command on the host managed by the driver
+func (d *Driver) Run(command string) (string, error) {
+	return utils.Run(d.Executor, command)
 }
 
 func (d *Driver) Id() string {
@@ -155,3 +167,89 @@ func (d *Driver) AllCPUsPinned() (bool, error) {
 	}
 	return false, nil
 }
+
+// StartDeployedDomain starts the domain defined by name
+func (d *Driver) StartDeployedDomain(name string) error {
+	return d.StartDomain(name)
+}
+
+func (d *Driver) ShutdownDomain(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.Run("virsh shutdown " + name); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// RemoveDomain undefines the domain (libvirt removes the autostart link as well)
+func (d *Driver) RemoveDomain(name string) error {
+	return d.UndefineDomain(name)
+}
+
+// Domain returns the domain parsing "virsh dominfo" output
+func (d *Driver) Domain(name string) (*deployer.Domain, error) {
+	d.Lock()
+	defer d.Unlock()
+	return d.domain(name)
+}
+
+func (d *Driver) domain(name string) (*deployer.Domain, error) {
+	out, err := d.Run("virsh dominfo " + name)
+	if err != nil {
+		var exitErr *utils.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, utils.FormatError(fmt.Errorf("%s: %w", name, deployer.ErrDomainNotFound))
+		}
+		return nil, utils.FormatError(err)
+	}
+	dom := &deployer.Domain{Name: name, State: deployer.DomainUnknown}
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "State":
+			dom.State = domainState(value)
+		case "Autostart":
+			dom.Autostart = value == "enable"
+		}
+	}
+	return dom, nil
+}
+
+// Domains returns all the domains defined by libvirt
+func (d *Driver) Domains() ([]*deployer.Domain, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	out, err := d.Run("virsh list --all --name")
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	var domains []*deployer.Domain
+	for _, name := range strings.Fields(out) {
+		dom, err := d.domain(name)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, dom)
+	}
+	return domains, nil
+}
+
+// domainState converts libvirt domain state
+func domainState(state string) deployer.DomainState {
+	switch state {
+	case "running", "idle", "in shutdown":
+		return deployer.DomainRunning
+	case "paused", "pmsuspended":
+		return deployer.DomainPaused
+	case "shut off", "crashed":
+		return deployer.DomainStopped
+	}
+	return deployer.DomainUnknown
+}
@@ -1,8 +1,13 @@
 package libvirt_kvm
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
 )
 
 func TestEmulator(t *testing.T) {
@@ -37,3 +42,52 @@ func TestAllCPUsPinned(t *testing.T) {
 	}
 	fmt.Printf("AllCPUsPinned result : %v\n", pinned)
 }
+
+func TestDomainCommands(t *testing.T) {
+	e := new(utils.RecordingExecutor)
+	d := NewDriverWithExecutor(e)
+	if err := d.DefineDomain("/tmp/domain.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetAutostart("va"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StartDomain("va"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"virsh define /tmp/domain.xml", "virsh autostart va", "virsh start va"}
+	if !reflect.DeepEqual(e.Commands(), expected) {
+		t.Fatalf("unexpected commands %v", e.Commands())
+	}
+}
+
+func TestDomains(t *testing.T) {
+	e := &utils.RecordingExecutor{
+		Respond: func(c *utils.Command) (*utils.Result, error) {
+			switch c.Cmd {
+			case "virsh list --all --name":
+				return &utils.Result{Stdout: "va\nvb\n"}, nil
+			case "virsh dominfo va":
+				return &utils.Result{Stdout: "Id:             1\nName:           va\nState:          running\nAutostart:      enable\n"}, nil
+			case "virsh dominfo vb":
+				return &utils.Result{Stdout: "Id:             -\nName:           vb\nState:          shut off\nAutostart:      disable\n"}, nil
+			}
+			return nil, &utils.ExitError{Cmd: c.Cmd, ExitCode: 1}
+		},
+	}
+	d := NewDriverWithExecutor(e)
+	domains, err := d.Domains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*deployer.Domain{
+		{Name: "va", State: deployer.DomainRunning, Autostart: true},
+		{Name: "vb", State: deployer.DomainStopped},
+	}
+	if !reflect.DeepEqual(domains, expected) {
+		t.Fatalf("unexpected domains %v", domains)
+	}
+	if _, err := d.Domain("vc"); !errors.Is(err, deployer.ErrDomainNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
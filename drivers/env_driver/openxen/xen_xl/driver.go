@@ -2,9 +2,11 @@ package xen_xl
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/utils"
 	ssh "github.com/dorzheh/infra/comm/common"
 )
@@ -12,13 +14,22 @@ import (
 type Driver struct {
 	sync.Mutex
 
-	Run func(string) (string, error)
+	// Executor runs the commands on the host managed by the driver
+	Executor utils.Executor
 }
 
 func NewDriver(config *ssh.Config) *Driver {
-	d := new(Driver)
-	d.Run = utils.RunFunc(config)
-	return d
+	return NewDriverWithExecutor(utils.NewExecutor(config))
+}
+
+// NewDriverWithExecutor creates a driver running the commands by means of the executor
+func NewDriverWithExecutor(e utils.Executor) *Driver {
+	return &Driver{Executor: e}
+}
+
+// Run runs the command on the host managed by the driver
+func (d *Driver) Run(command string) (string, error) {
+	return utils.Run(d.Executor, command)
 }
 
 func (d *Driver) Id() string {
@@ -96,3 +107,106 @@ func (d *Driver) MaxVCPUsPerGuest() int {
 func (d *Driver) AllCPUsPinned() (bool, error) {
 	return true, nil
 }
+
+// configDir contains configuration files of the deployed domains
+const configDir = "/etc/xen"
+
+// StartDeployedDomain creates the domain from its configuration file
+func (d *Driver) StartDeployedDomain(name string) error {
+	return d.StartDomain(fmt.Sprintf("%s/%s.cfg", configDir, name))
+}
+
+func (d *Driver) ShutdownDomain(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.Run("xl shutdown " + name); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// RemoveDomain removes the configuration file of the domain and its autostart link
+func (d *Driver) RemoveDomain(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.Run(fmt.Sprintf("rm -f %s/auto/%s.cfg %s/%s.cfg", configDir, name, configDir, name)); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// Domain returns the domain that is either configured or running
+func (d *Driver) Domain(name string) (*deployer.Domain, error) {
+	domains, err := d.Domains()
+	if err != nil {
+		return nil, err
+	}
+	for _, dom := range domains {
+		if dom.Name == name {
+			return dom, nil
+		}
+	}
+	return nil, utils.FormatError(fmt.Errorf("%s: %w", name, deployer.ErrDomainNotFound))
+}
+
+// Domains returns the domains having configuration file in /etc/xen
+// and the running ones (except Domain-0)
+func (d *Driver) Domains() ([]*deployer.Domain, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	out, err := d.Run(fmt.Sprintf("ls %s/*.cfg 2>/dev/null;echo ---;ls %s/auto/*.cfg 2>/dev/null;echo ---;xl list",
+		configDir, configDir))
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	sections := strings.SplitN(out, "---", 3)
+	if len(sections) != 3 {
+		return nil, utils.FormatError(fmt.Errorf("unexpected output %q", out))
+	}
+
+	var domains []*deployer.Domain
+	byName := make(map[string]*deployer.Domain)
+	add := func(name string) *deployer.Domain {
+		dom, ok := byName[name]
+		if !ok {
+			dom = &deployer.Domain{Name: name, State: deployer.DomainStopped}
+			byName[name] = dom
+			domains = append(domains, dom)
+		}
+		return dom
+	}
+	for _, file := range strings.Fields(sections[0]) {
+		add(strings.TrimSuffix(filepath.Base(file), ".cfg"))
+	}
+	// xl list: Name ID Mem VCPUs State Time(s)
+	for _, line := range strings.Split(sections[2], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] == "Name" || fields[0] == "Domain-0" {
+			continue
+		}
+		dom := add(fields[0])
+		dom.State = domainState(fields[4])
+	}
+	for _, file := range strings.Fields(sections[1]) {
+		if dom, ok := byName[strings.TrimSuffix(filepath.Base(file), ".cfg")]; ok {
+			dom.Autostart = true
+		}
+	}
+	return domains, nil
+}
+
+// domainState converts state flags reported by xl ("r-----", "-b----" and so forth)
+func domainState(flags string) deployer.DomainState {
+	switch {
+	case strings.Contains(flags, "p"):
+		return deployer.DomainPaused
+	case strings.ContainsAny(flags, "scd"):
+		return deployer.DomainStopped
+	case strings.ContainsAny(flags, "rb"):
+		return deployer.DomainRunning
+	}
+	return deployer.DomainUnknown
+}
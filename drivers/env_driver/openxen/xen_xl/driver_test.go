@@ -1,8 +1,13 @@
 package xen_xl
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
 )
 
 func TestVersion(t *testing.T) {
@@ -13,3 +18,42 @@ func TestVersion(t *testing.T) {
 	}
 	fmt.Printf("DEBUG: driver version => %s\n", v)
 }
+
+func TestDomains(t *testing.T) {
+	e := &utils.RecordingExecutor{
+		Respond: func(c *utils.Command) (*utils.Result, error) {
+			return &utils.Result{Stdout: `/etc/xen/va.cfg
+/etc/xen/vb.cfg
+---
+/etc/xen/auto/va.cfg
+---
+Name                                        ID   Mem VCPUs	State	Time(s)
+Domain-0                                     0  1024     4     r-----     123.4
+va                                           1   512     1     -b----       1.2
+vc                                           2   512     1     --p---       0.1
+`}, nil
+		},
+	}
+	d := NewDriverWithExecutor(e)
+	domains, err := d.Domains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*deployer.Domain{
+		{Name: "va", State: deployer.DomainRunning, Autostart: true},
+		{Name: "vb", State: deployer.DomainStopped},
+		{Name: "vc", State: deployer.DomainPaused},
+	}
+	if !reflect.DeepEqual(domains, expected) {
+		t.Fatalf("unexpected domains %v", domains)
+	}
+	if _, err := d.Domain("vd"); !errors.Is(err, deployer.ErrDomainNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := d.StartDeployedDomain("vb"); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := e.Commands(); cmds[len(cmds)-1] != "xl create /etc/xen/vb.cfg" {
+		t.Fatalf("unexpected commands %v", cmds)
+	}
+}
@@ -6,6 +6,7 @@ package common
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -15,6 +16,7 @@ import (
 	"github.com/dorzheh/deployer/builder/content"
 	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	archutils "github.com/dorzheh/infra/utils/archutils"
 )
 
@@ -31,6 +33,12 @@ type rootfsFiller struct {
 	pathToApplArchive          string
 	pathToConfigDir            string
 	extractApplImage           bool
+	progress                   *progress.Reporter
+}
+
+// SetProgressReporter implements deployer.ProgressRootfsFiller
+func (f *rootfsFiller) SetProgressReporter(r *progress.Reporter) {
+	f.progress = r
 }
 
 func (f *rootfsFiller) CustomizeRootfs(pathToRootfsMp string) error {
@@ -40,7 +48,9 @@ func (f *rootfsFiller) CustomizeRootfs(pathToRootfsMp string) error {
 	}
 
 	path := filepath.Join(pathToRootfsMp, "rootfs")
-	exec.Command(unsquashfs, "-dest", path, f.pathToRootfsSquashfs).Run()
+	cmd := exec.Command(unsquashfs, "-percentage", "-dest", path, f.pathToRootfsSquashfs)
+	cmd.Stdout = f.progress.Writer("extract rootfs", strings.Join(cmd.Args, " "))
+	cmd.Run()
 	dir, err := ioutil.ReadDir(path)
 	if err != nil {
 		return utils.FormatError(err)
@@ -52,6 +62,7 @@ func (f *rootfsFiller) CustomizeRootfs(pathToRootfsMp string) error {
 		return utils.FormatError(err)
 	}
 	if f.pathToKernelModulesArchive != "" && f.pathToKernelArchive != "" {
+		f.progress.Stage("extract kernel", f.pathToKernelArchive+" "+f.pathToKernelModulesArchive)
 		errCh := make(chan error, 2)
 		defer close(errCh)
 
@@ -101,6 +112,7 @@ func (f *rootfsFiller) CustomizeRootfs(pathToRootfsMp string) error {
 
 // InstallApp is responsible for application installation
 func (f *rootfsFiller) InstallApp(pathToRootfsMp string) error {
+	f.progress.Stage("extract application", f.pathToApplArchive)
 	if err := archutils.Extract(f.pathToApplArchive, filepath.Join(pathToRootfsMp, "mnt/cf")); err != nil {
 		return utils.FormatError(err)
 	}
@@ -115,6 +127,49 @@ func (f *rootfsFiller) RunHooks(pathToRootfsMp string) error {
 	return nil
 }
 
+// Inputs implements deployer.InputRootfsFiller
+func (f *rootfsFiller) Inputs() []string {
+	return []string{
+		f.pathToRootfsSquashfs,
+		f.pathToKernelArchive,
+		f.pathToKernelModulesArchive,
+		f.pathToApplArchive,
+		filepath.Join(f.pathToKitDir, "comp/env/common/config"),
+		f.pathToConfigDir,
+	}
+}
+
+// PlanRootfs implements deployer.PlanRootfsFiller
+func (f *rootfsFiller) PlanRootfs(w io.Writer, pathToRootfsMp string) error {
+	path := filepath.Join(pathToRootfsMp, "rootfs")
+	fmt.Fprintf(w, "unsquashfs -percentage -dest %s %s\n", path, f.pathToRootfsSquashfs)
+	fmt.Fprintf(w, "cp -a %s/* %s\n", path, pathToRootfsMp)
+	fmt.Fprintf(w, "rm -rf %s\n", path)
+	if f.pathToKernelModulesArchive != "" && f.pathToKernelArchive != "" {
+		fmt.Fprintf(w, "tar -xf %s -C %s\n", f.pathToKernelArchive, filepath.Join(pathToRootfsMp, "boot"))
+		fmt.Fprintf(w, "tar -xf %s -C %s\n", f.pathToKernelModulesArchive, filepath.Join(pathToRootfsMp, "lib/modules"))
+		fmt.Fprintf(w, "ln -s /boot/vmlinuz-<kernel_version> %s\n", filepath.Join(pathToRootfsMp, "vmlinuz"))
+		fmt.Fprintf(w, "ln -s /boot/initrd.img-<kernel_version> %s\n", filepath.Join(pathToRootfsMp, "initrd.img"))
+	}
+	pathToCommonDir := filepath.Join(f.pathToKitDir, "comp/env/common/config")
+	fd, err := os.Stat(pathToCommonDir)
+	if err == nil && fd.IsDir() {
+		if err := content.Plan(w, pathToRootfsMp, pathToCommonDir); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	if f.pathToConfigDir != "" {
+		if err := content.Plan(w, pathToRootfsMp, f.pathToConfigDir); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	fmt.Fprintf(w, "tar -xf %s -C %s\n", f.pathToApplArchive, filepath.Join(pathToRootfsMp, "mnt/cf"))
+	if f.extractApplImage {
+		fmt.Fprintf(w, "cd %s && ./myapp*\n", filepath.Join(pathToRootfsMp, "mnt/cf"))
+	}
+	return nil
+}
+
 // extractAppImage is responsible for extracting application image in a chroot environment
 func extractApplImage(pathRootMp string) error {
 	if err := os.Chdir(filepath.Join(pathRootMp, "mnt/cf")); err != nil {
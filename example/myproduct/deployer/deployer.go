@@ -6,11 +6,10 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/dorzheh/deployer/deployer"
-	libvirt_kvm "github.com/dorzheh/deployer/example/myproduct/env/libvirt/kvm"
-	"github.com/dorzheh/deployer/example/myproduct/env/openxen"
-	gui "github.com/dorzheh/deployer/ui"
-	"github.com/dorzheh/deployer/ui/dialog_ui"
+	"github.com/dorzheh/deployer/cli"
+	// the environments register themselves
+	_ "github.com/dorzheh/deployer/example/myproduct/env/libvirt/kvm"
+	_ "github.com/dorzheh/deployer/example/myproduct/env/openxen"
 	"github.com/dorzheh/infra/utils/archutils"
 	//"fmt"
 )
@@ -44,26 +43,13 @@ func init() {
 }
 
 func main() {
-	ui := dialog_ui.NewDialogUi()
-	ui.Shadow(false)
-	ui.SetCancelLabel("Exit")
-	gui.UiValidateUser(ui, 0)
-	gui.UiWelcomeMsg(ui, defaultProductName)
-	gui.UiEulaMsg(ui, filepath.Join(rootDir, ".EULA"))
-	data := &deployer.CommonData{
-		RootDir:          rootDir,
-		RootfsMp:         filepath.Join(rootDir, "rootfs_mnt"),
-		DefaultExportDir: rootDir,
-		VaName:           defaultProductName,
-		Arch:             arch,
-		Ui:               ui,
-	}
-
-	if err := archutils.Extract(filepath.Join(rootDir, "comp/env.tgz"), filepath.Join(rootDir, "comp")); err != nil {
-		ui.Output(dialog_ui.Error, err.Error())
-	}
-
-	gui.UiDeploymentResult(ui, data.VaName+" installation completed successfully",
-		gui.UiSelectEnv(data, []string{"Libvirt(KVM)", "OpenXen"},
-			[]deployer.FlowCreator{new(libvirt_kvm.FlowCreator), new(openxen.FlowCreator)}))
+	cli.Main(&cli.Product{
+		Name:    defaultProductName,
+		RootDir: rootDir,
+		Arch:    arch,
+		Eula:    filepath.Join(rootDir, ".EULA"),
+		Prepare: func() error {
+			return archutils.Extract(filepath.Join(rootDir, "comp/env.tgz"), filepath.Join(rootDir, "comp"))
+		},
+	})
 }
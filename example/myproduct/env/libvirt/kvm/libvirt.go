@@ -11,10 +11,12 @@ import (
 	"github.com/dorzheh/deployer/builder/image"
 	"github.com/dorzheh/deployer/config/metadata"
 	libvirtconf "github.com/dorzheh/deployer/config/metadata/libvirt/libvirt_kvm"
-	"github.com/dorzheh/deployer/controller"
 	"github.com/dorzheh/deployer/deployer"
+	envdriver "github.com/dorzheh/deployer/drivers/env_driver/libvirt/libvirt_kvm"
+	hwinfodriver "github.com/dorzheh/deployer/drivers/hwinfo_driver/libvirt"
 	"github.com/dorzheh/deployer/example/myproduct/common"
 	libvirtpost "github.com/dorzheh/deployer/post_processor/libvirt/libvirt_kvm"
+	ssh "github.com/dorzheh/infra/comm/common"
 	"github.com/dorzheh/infra/comm/sshfs"
 )
 
@@ -26,6 +28,26 @@ var mainConfig = map[string]string{
 	"input_data_config_file": "comp/env/libvirt/kvm/config/input_data_config.xml",
 }
 
+func init() {
+	deployer.RegisterEnvironment(&deployer.Environment{
+		Name:  "libvirt-kvm",
+		Title: "Libvirt(KVM)",
+		NewFlowCreator: func() deployer.FlowCreator {
+			return new(FlowCreator)
+		},
+		NewHostinfoDriver: func(d *deployer.CommonData, conf *ssh.Config) (deployer.HostinfoDriver, error) {
+			hi, err := hwinfodriver.NewHostinfoDriver(conf, filepath.Join(d.RootDir, "install", d.Arch, "bin/lshw"), d.HwinfoFile())
+			if err != nil {
+				return nil, err
+			}
+			return hi, nil
+		},
+		NewEnvDriver: func(conf *ssh.Config) deployer.EnvDriver {
+			return envdriver.NewDriver(conf)
+		},
+	})
+}
+
 type FlowCreator struct {
 	config *metadata.Config
 }
@@ -43,32 +65,21 @@ func (c *FlowCreator) CreateConfig(d *deployer.CommonData) error {
 		return err
 	}
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			fmt.Println("My step 1")
 			return nil
 		}
 	}())
 
-	controller.RegisterSteps(func() func() error {
+	d.Steps.Register(func() func() error {
 		return func() error {
 			fmt.Println("My step 2")
 			return nil
 		}
 	}())
 
-	if err := controller.RunSteps(); err != nil {
-		return err
-	}
-
-	d.Ui.Pb.SetSleep("10s")
-	d.Ui.Pb.SetStep(10)
-
-	if c.config.RemoteMode {
-		d.Ui.Pb.IncreaseSleep("5s")
-		d.Ui.Pb.DecreaseStep(4)
-	}
-	return nil
+	return d.Steps.Run()
 }
 
 func (c *FlowCreator) CreateBuilders(d *deployer.CommonData) (b []deployer.Builder, err error) {
@@ -84,19 +95,30 @@ func (c *FlowCreator) CreateBuilders(d *deployer.CommonData) (b []deployer.Build
 	util := &image.Utils{
 		Kpartx: filepath.Join(d.RootDir, "install", d.Arch, "bin/kpartx"),
 	}
-	for _, disk := range c.config.StorageConfig.Configs[0].Disks {
+	var imageBuilderIds []string
+	for i, disk := range c.config.StorageConfig.Configs[0].Disks {
+		// the images are built in parallel, so each one needs its own mount point
+		rootfsMp := d.RootfsMp
+		if i > 0 {
+			rootfsMp = fmt.Sprintf("%s_%d", d.RootfsMp, i)
+		}
 		imageData := &deployer.ImageBuilderData{
 			ImageConfig: disk,
-			RootfsMp:    d.RootfsMp,
+			RootfsMp:    rootfsMp,
 			Filler:      common.ImageFiller(d, mainConfig["config_dir"]),
+			Cache:       d.Cache,
 		}
-		b = append(b, &builder.ImageBuilder{imageData, sshfsConf, util})
+		ib := &builder.ImageBuilder{imageData, sshfsConf, util}
+		imageBuilderIds = append(imageBuilderIds, ib.Id())
+		b = append(b, ib)
 	}
 
+	// metadata refers to the final image paths
 	metaData := &deployer.MetadataBuilderData{
-		Source:   filepath.Join(d.RootDir, mainConfig["metadata_file"]),
-		Dest:     c.config.DestMetadataFile,
-		UserData: c.config.Metadata,
+		Source:       filepath.Join(d.RootDir, mainConfig["metadata_file"]),
+		Dest:         c.config.DestMetadataFile,
+		UserData:     c.config.Metadata,
+		Dependencies: imageBuilderIds,
 	}
 
 	b = append(b, &builder.MetadataBuilder{metaData, c.config.SshConfig})
@@ -104,8 +126,6 @@ func (c *FlowCreator) CreateBuilders(d *deployer.CommonData) (b []deployer.Build
 }
 
 func (c *FlowCreator) CreatePostProcessor(d *deployer.CommonData) (p deployer.PostProcessor, err error) {
-	d.Ui.Pb.SetSleep("1s")
-	d.Ui.Pb.SetStep(50)
 	p = libvirtpost.NewPostProcessor(c.config.SshConfig, false)
 	return
 }
@@ -0,0 +1,72 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+)
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ResetHooks()
+
+	var mu sync.Mutex
+	var points []deployer.HookPoint
+	var failure error
+	record := func(ctx context.Context, d *deployer.HookData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		points = append(points, d.Point)
+		if d.Point == deployer.OnFailure {
+			failure = d.Err
+		}
+		return nil
+	}
+	for _, p := range []deployer.HookPoint{deployer.BeforeConfig, deployer.AfterConfig, deployer.BeforeBuilder,
+		deployer.AfterBuilder, deployer.BeforePostProcess, deployer.AfterPostProcess, deployer.OnFailure} {
+		RegisterHooks(p, record)
+	}
+
+	c := &deployer.CommonData{RootDir: dir, Host: "kvm1"}
+	if err := DeployContext(context.Background(), c, &hostFlow{dir}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []deployer.HookPoint{deployer.BeforeConfig, deployer.AfterConfig, deployer.BeforeBuilder,
+		deployer.AfterBuilder, deployer.BeforePostProcess, deployer.AfterPostProcess}
+	if !reflect.DeepEqual(points, expected) {
+		t.Fatalf("unexpected hooks %v", points)
+	}
+
+	// a failing hook aborts the deployment and the artifact is rolled back
+	license := errors.New("license expired")
+	RegisterHooks(deployer.AfterBuilder, func(ctx context.Context, d *deployer.HookData) error {
+		return license
+	})
+	points = nil
+	err = DeployContext(context.Background(), c, &hostFlow{dir})
+	if !errors.Is(err, license) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected = []deployer.HookPoint{deployer.BeforeConfig, deployer.AfterConfig, deployer.BeforeBuilder,
+		deployer.AfterBuilder, deployer.OnFailure}
+	if !reflect.DeepEqual(points, expected) {
+		t.Fatalf("unexpected hooks %v", points)
+	}
+	if !errors.Is(failure, license) {
+		t.Fatalf("unexpected failure %v", failure)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kvm1.img")); !os.IsNotExist(err) {
+		t.Fatalf("artifact is supposed to be removed: %v", err)
+	}
+}
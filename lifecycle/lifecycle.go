@@ -0,0 +1,133 @@
+// Manages the life cycle of the deployed appliances the same way
+// regardless of the environment (libvirt, xl) by means of the env drivers.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+)
+
+// DefaultTimeout is the default time a graceful shutdown takes
+const DefaultTimeout = 2 * time.Minute
+
+// Manager starts, stops and removes the deployed domains
+type Manager struct {
+	// Driver manages the domains on the host
+	Driver deployer.DomainDriver
+
+	// Timeout is the maximal time a graceful shutdown takes.
+	// Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// PollInterval is the interval the state of the domain is checked at
+	// while waiting for the shutdown. Zero means one second.
+	PollInterval time.Duration
+}
+
+// NewManager creates a manager of the domains managed by the driver
+func NewManager(d deployer.EnvDriver) (*Manager, error) {
+	dd, ok := d.(deployer.DomainDriver)
+	if !ok {
+		return nil, utils.FormatError(fmt.Errorf("driver %s doesn't support domain life cycle", d.Id()))
+	}
+	return &Manager{Driver: dd}, nil
+}
+
+// Start starts the domain unless it is running
+func (m *Manager) Start(name string) error {
+	dom, err := m.Driver.Domain(name)
+	if err != nil {
+		return err
+	}
+	if dom.State == deployer.DomainRunning {
+		return nil
+	}
+	return m.Driver.StartDeployedDomain(name)
+}
+
+// Stop shuts the domain down and waits for the shutdown to complete.
+// If force is set, the domain is destroyed immediately.
+// A graceful shutdown taking more than the timeout fails.
+func (m *Manager) Stop(name string, force bool) error {
+	dom, err := m.Driver.Domain(name)
+	if err != nil {
+		return err
+	}
+	if dom.State == deployer.DomainStopped {
+		return nil
+	}
+	if force {
+		return m.Driver.DestroyDomain(name)
+	}
+	if err := m.Driver.ShutdownDomain(name); err != nil {
+		return err
+	}
+	return m.wait(name)
+}
+
+// wait waits for the domain to stop
+func (m *Manager) wait(name string) error {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		dom, err := m.Driver.Domain(name)
+		if errors.Is(err, deployer.ErrDomainNotFound) {
+			// transient domains disappear once stopped
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if dom.State == deployer.DomainStopped {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return utils.FormatError(fmt.Errorf("domain %s is not stopped within %v", name, timeout))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Restart stops the domain (see Stop) and starts it again
+func (m *Manager) Restart(name string, force bool) error {
+	if err := m.Stop(name, force); err != nil {
+		return err
+	}
+	return m.Driver.StartDeployedDomain(name)
+}
+
+// Status returns the domain
+func (m *Manager) Status(name string) (*deployer.Domain, error) {
+	return m.Driver.Domain(name)
+}
+
+// Undeploy destroys the domain if it is running and removes its definitions.
+// The appliance images are not removed.
+func (m *Manager) Undeploy(name string) error {
+	dom, err := m.Driver.Domain(name)
+	if err != nil {
+		return err
+	}
+	if dom.State != deployer.DomainStopped {
+		if err := m.Driver.DestroyDomain(name); err != nil {
+			return err
+		}
+	}
+	return m.Driver.RemoveDomain(name)
+}
+
+// List returns all the domains
+func (m *Manager) List() ([]*deployer.Domain, error) {
+	return m.Driver.Domains()
+}
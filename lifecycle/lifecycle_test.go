@@ -0,0 +1,109 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/drivers/env_driver/libvirt/libvirt_kvm"
+	"github.com/dorzheh/deployer/utils"
+)
+
+// domainHost emulates virsh on a host having a single domain "va"
+type domainHost struct {
+	state     string
+	defined   bool
+	dominfo   int
+	stopAfter int
+}
+
+func (h *domainHost) respond(c *utils.Command) (*utils.Result, error) {
+	switch c.Cmd {
+	case "virsh dominfo va":
+		if !h.defined {
+			return nil, &utils.ExitError{Cmd: c.Cmd, ExitCode: 1}
+		}
+		h.dominfo++
+		if h.state == "in shutdown" && h.dominfo > h.stopAfter {
+			h.state = "shut off"
+		}
+		return &utils.Result{Stdout: fmt.Sprintf("Name: va\nState: %s\nAutostart: enable\n", h.state)}, nil
+	case "virsh start va":
+		h.state = "running"
+	case "virsh shutdown va":
+		h.state = "in shutdown"
+	case "virsh destroy va":
+		h.state = "shut off"
+	case "virsh undefine va":
+		h.defined = false
+	}
+	return nil, nil
+}
+
+func newManager(h *domainHost) (*Manager, *utils.RecordingExecutor) {
+	e := &utils.RecordingExecutor{Respond: h.respond}
+	m, err := NewManager(libvirt_kvm.NewDriverWithExecutor(e))
+	if err != nil {
+		panic(err)
+	}
+	m.PollInterval = time.Millisecond
+	return m, e
+}
+
+func TestLifecycle(t *testing.T) {
+	h := &domainHost{state: "shut off", defined: true, stopAfter: 3}
+	m, e := newManager(h)
+
+	if err := m.Start("va"); err != nil {
+		t.Fatal(err)
+	}
+	// the domain is running already
+	if err := m.Start("va"); err != nil {
+		t.Fatal(err)
+	}
+	dom, err := m.Status("va")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dom.State != deployer.DomainRunning || !dom.Autostart {
+		t.Fatalf("unexpected status %+v", dom)
+	}
+	if err := m.Stop("va", false); err != nil {
+		t.Fatal(err)
+	}
+	if h.state != "shut off" {
+		t.Fatalf("unexpected state %s", h.state)
+	}
+	if err := m.Restart("va", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Undeploy("va"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Status("va"); !errors.Is(err, deployer.ErrDomainNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var cmds []string
+	for _, c := range e.Commands() {
+		if c != "virsh dominfo va" {
+			cmds = append(cmds, c)
+		}
+	}
+	expected := []string{"virsh start va", "virsh shutdown va", "virsh start va", "virsh destroy va", "virsh undefine va"}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Fatalf("unexpected commands %v", cmds)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	h := &domainHost{state: "running", defined: true, stopAfter: 1 << 30}
+	m, _ := newManager(h)
+	m.Timeout = 10 * time.Millisecond
+	if err := m.Stop("va", false); err == nil {
+		t.Fatal("timeout is supposed to produce an error")
+	}
+}
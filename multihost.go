@@ -0,0 +1,246 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dorzheh/deployer/config/inventory"
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
+)
+
+// MultiHost deploys the same appliance to many hosts simultaneously.
+// Every host is deployed remotely with the answers amended by the
+// inventory overrides, so the configuration (including the hardware
+// detection) is created per host.
+type MultiHost struct {
+	// Inventory contains the target hosts.
+	Inventory *inventory.Inventory
+
+	// Groups selects the hosts belonging to the given groups.
+	// Empty means all the hosts.
+	Groups []string
+
+	// Parallelism is the maximal amount of hosts deployed simultaneously.
+	// Zero means no limit.
+	Parallelism int
+
+	// LogDir is the directory the per-host logs (<host>.log) are written to.
+	// Empty means no logs.
+	LogDir string
+
+	// NewFlowCreator creates the flow creator for a host.
+	NewFlowCreator func() deployer.FlowCreator
+}
+
+// HostResult represents the result of the deployment to a host
+type HostResult struct {
+	Host     *inventory.Host
+	Err      error
+	Duration time.Duration
+
+	// LogFile is path to the log of the deployment (empty if not logged)
+	LogFile string
+}
+
+// Deploy deploys the appliance to the hosts.
+// c provides the common data of the deployments; c.Answers (if set)
+// are amended per host, the UI is not used. The reports, the manifest
+// and the checkpoint (if set) are written per host.
+// Returns results of all the hosts and an error if any of them failed.
+// The deployment is cancelled on SIGHUP, SIGINT or SIGTERM.
+func (m *MultiHost) Deploy(c *deployer.CommonData) ([]*HostResult, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return m.DeployContext(ctx, c)
+}
+
+// DeployContext is like Deploy but the deployments are cancelled
+// once the given context is done.
+func (m *MultiHost) DeployContext(ctx context.Context, c *deployer.CommonData) (results []*HostResult, err error) {
+	if c.Plan {
+		return nil, utils.FormatError(errors.New("multi-host deployment cannot be planned"))
+	}
+	hosts := m.Inventory.Select(m.Groups...)
+	if len(hosts) == 0 {
+		return nil, utils.FormatError(errors.New("no hosts selected"))
+	}
+	if m.LogDir != "" {
+		if err := os.MkdirAll(m.LogDir, 0755); err != nil {
+			return nil, utils.FormatError(err)
+		}
+	}
+
+	parallelism := m.Parallelism
+	if parallelism <= 0 {
+		parallelism = len(hosts)
+	}
+
+	err = withSession(c, func() error {
+		results = make([]*HostResult, len(hosts))
+		slots := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for i, h := range hosts {
+			wg.Add(1)
+			go func(i int, h *inventory.Host) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				results[i] = m.deployHost(ctx, c, h)
+			}(i, h)
+		}
+		wg.Wait()
+
+		var failed int
+		for _, r := range results {
+			if r.Err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("deployment failed on %d of %d hosts", failed, len(results))
+		}
+		return nil
+	})
+	return
+}
+
+// deployHost deploys the appliance to the host
+func (m *MultiHost) deployHost(ctx context.Context, c *deployer.CommonData, h *inventory.Host) (r *HostResult) {
+	r = &HostResult{Host: h}
+	start := time.Now()
+	defer func() {
+		r.Duration = time.Since(start)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return
+	}
+	a, err := m.Inventory.Answers(c.Answers, h)
+	if err != nil {
+		r.Err = err
+		return
+	}
+
+	hc := *c
+	hc.Host = h.Name
+	hc.Answers = a
+	hc.Ui = nil
+	hc.Record = nil
+	hc.RecordFile = ""
+	// the images of different hosts are customized simultaneously
+	hc.RootfsMp = c.RootfsMp + "_" + h.Name
+	hc.ProgressEvents = nil
+	if c.ReportFile != "" {
+		hc.ReportFile = hostFile(c.ReportFile, h.Name)
+	}
+	if c.ReportHTMLFile != "" {
+		hc.ReportHTMLFile = hostFile(c.ReportHTMLFile, h.Name)
+	}
+	if c.ManifestFile != "" {
+		hc.ManifestFile = hostFile(c.ManifestFile, h.Name)
+	}
+	var cp *deployer.Checkpoint
+	if c.Checkpoint != "" {
+		hc.Checkpoint = c.Checkpoint + "." + h.Name
+		cp = deployer.NewCheckpoint(hc.Checkpoint)
+	}
+
+	if m.LogDir == "" {
+		r.Err = utils.HostError(h.Name, deploy(ctx, &hc, m.NewFlowCreator(), cp))
+		return
+	}
+
+	r.LogFile = filepath.Join(m.LogDir, h.Name+".log")
+	w, err := os.Create(r.LogFile)
+	if err != nil {
+		r.Err = utils.FormatError(err)
+		return
+	}
+	defer w.Close()
+	fmt.Fprintf(w, "%s deploying to %s (%s)\n", timestamp(), h.Name, a.Ssh.Host)
+
+	events := make(chan progress.Event)
+	logged := make(chan struct{})
+	go func() {
+		logEvents(w, events)
+		close(logged)
+	}()
+	hc.ProgressEvents = events
+	r.Err = utils.HostError(h.Name, deploy(ctx, &hc, m.NewFlowCreator(), cp))
+	close(events)
+	<-logged
+
+	if r.Err != nil {
+		fmt.Fprintf(w, "%s deployment failed: %v\n", timestamp(), r.Err)
+	} else {
+		fmt.Fprintf(w, "%s deployment completed in %v\n", timestamp(), time.Since(start))
+	}
+	return
+}
+
+// logEvents writes the beginning and the end of every stage to the log
+func logEvents(w io.Writer, events <-chan progress.Event) {
+	stages := make(map[string]string)
+	for e := range events {
+		if stages[e.Source] == e.Stage && e.Percent != 100 {
+			continue
+		}
+		stages[e.Source] = e.Stage
+		line := fmt.Sprintf("%s %s: %s", timestamp(), e.Source, e.Stage)
+		if e.Percent != progress.Unknown {
+			line += fmt.Sprintf(" %d%%", e.Percent)
+		}
+		if e.Command != "" {
+			line += " (" + e.Command + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// hostFile returns path to the file of the host derived from the given path
+// (report.json becomes report.<host>.json)
+func hostFile(path, host string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + host + ext
+}
+
+func timestamp() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+// WriteResults writes the success/failure matrix of the hosts
+func WriteResults(w io.Writer, results []*HostResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tGROUPS\tRESULT\tDURATION\tLOG\tERROR")
+	for _, r := range results {
+		status, msg := "ok", ""
+		if r.Err != nil {
+			status = "FAILED"
+			msg = strings.SplitN(strings.TrimSpace(r.Err.Error()), "\n", 2)[0]
+		}
+		groups := strings.Join(r.Host.Groups, ",")
+		if groups == "" {
+			groups = "-"
+		}
+		log := r.LogFile
+		if log == "" {
+			log = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%s\t%s\n", r.Host.Name, groups, status,
+			r.Duration.Truncate(time.Second), log, msg)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,159 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/config/inventory"
+	"github.com/dorzheh/deployer/deployer"
+)
+
+// hostFlow creates a single artifact and fails the deployment to kvm2
+type hostFlow struct {
+	dir string
+}
+
+func (f *hostFlow) CreateConfig(c *deployer.CommonData) error {
+	if c.Host == "kvm2" {
+		return errors.New("host is not reachable")
+	}
+	return nil
+}
+
+func (f *hostFlow) CreateBuilders(c *deployer.CommonData) ([]deployer.Builder, error) {
+	return []deployer.Builder{&hostBuilder{filepath.Join(f.dir, c.Host+".img")}}, nil
+}
+
+func (f *hostFlow) CreatePostProcessor(c *deployer.CommonData) (deployer.PostProcessor, error) {
+	return nil, nil
+}
+
+type hostBuilder struct {
+	path string
+}
+
+func (b *hostBuilder) Id() string {
+	return "ImageBuilder"
+}
+
+func (b *hostBuilder) Run() (deployer.Artifact, error) {
+	if err := ioutil.WriteFile(b.path, nil, 0644); err != nil {
+		return nil, err
+	}
+	return &deployer.CommonArtifact{Name: "image", Path: b.path}, nil
+}
+
+func TestMultiHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multihost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inv, err := inventory.Parse([]byte(`{"hosts": [
+		{"name": "kvm1", "ssh": {"host": "192.168.1.10"}},
+		{"name": "kvm2", "ssh": {"host": "192.168.1.11"}},
+		{"name": "kvm3", "ssh": {"host": "192.168.1.12"}}
+	]}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MultiHost{
+		Inventory:      inv,
+		Parallelism:    2,
+		LogDir:         filepath.Join(dir, "logs"),
+		NewFlowCreator: func() deployer.FlowCreator { return &hostFlow{dir} },
+	}
+	c := &deployer.CommonData{RootDir: dir, ManifestFile: filepath.Join(dir, "manifest.json")}
+	results, err := m.DeployContext(context.Background(), c)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("unexpected results %v", results)
+	}
+	for _, name := range []string{"kvm1", "kvm3"} {
+		if _, err := os.Stat(filepath.Join(dir, name+".img")); err != nil {
+			t.Fatal(err)
+		}
+		// every host has its own manifest
+		m, err := deployer.LoadManifest(filepath.Join(dir, "manifest."+name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Host != name {
+			t.Fatalf("unexpected manifest host %s", m.Host)
+		}
+	}
+
+	log, err := ioutil.ReadFile(results[1].LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "host is not reachable") {
+		t.Fatalf("unexpected log:\n%s", log)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[2], "FAILED") || !strings.Contains(lines[3], "ok") {
+		t.Fatalf("unexpected results:\n%s", buf.String())
+	}
+}
+
+// configFlow registers a step waiting until the configurations
+// of all the hosts are being created
+type configFlow struct {
+	hostFlow
+	started chan struct{}
+	hosts   int
+}
+
+func (f *configFlow) CreateConfig(c *deployer.CommonData) error {
+	c.Steps.Register(func() error {
+		f.started <- struct{}{}
+		return nil
+	}, func() error {
+		for len(f.started) < f.hosts {
+			select {
+			case <-time.After(5 * time.Second):
+				return errors.New("the configurations are not created simultaneously")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		return nil
+	})
+	return c.Steps.Run()
+}
+
+func TestMultiHostConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multihost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inv, err := inventory.Parse([]byte(`{"hosts": [{"name": "kvm1"}, {"name": "kvm3"}]}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &configFlow{hostFlow: hostFlow{dir}, started: make(chan struct{}, 2), hosts: 2}
+	m := &MultiHost{
+		Inventory:      inv,
+		Parallelism:    2,
+		NewFlowCreator: func() deployer.FlowCreator { return f },
+	}
+	if _, err := m.DeployContext(context.Background(), &deployer.CommonData{RootDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+}
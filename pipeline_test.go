@@ -0,0 +1,133 @@
+package deployer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+)
+
+// exportFlow exports the artifact of hostFlow by means of a pipeline
+type exportFlow struct {
+	hostFlow
+}
+
+func (f *exportFlow) CreatePostProcessors(c *deployer.CommonData) ([]deployer.PostProcessor, error) {
+	return []deployer.PostProcessor{&exportPostProcessor{f.dir}}, nil
+}
+
+type exportPostProcessor struct {
+	dir string
+}
+
+func (p *exportPostProcessor) PostProcess(artifacts []deployer.Artifact) error {
+	_, err := p.PostProcessArtifacts(context.Background(), artifacts)
+	return err
+}
+
+func (p *exportPostProcessor) PostProcessArtifacts(ctx context.Context, artifacts []deployer.Artifact) ([]deployer.Artifact, error) {
+	path := filepath.Join(p.dir, "export.ova")
+	if err := ioutil.WriteFile(path, []byte("ova"), 0644); err != nil {
+		return nil, err
+	}
+	return []deployer.Artifact{&deployer.CommonArtifact{Name: "export.ova", Path: path, Type: deployer.PackageArtifact}}, nil
+}
+
+func TestPipelineArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ResetHooks()
+
+	var seen []deployer.Artifact
+	RegisterHooks(deployer.AfterPostProcess, func(ctx context.Context, d *deployer.HookData) error {
+		seen = d.Artifacts
+		return nil
+	})
+	c := &deployer.CommonData{
+		RootDir:    dir,
+		Host:       "kvm1",
+		ReportFile: filepath.Join(dir, "report.json"),
+		AuditLog:   filepath.Join(dir, "audit.log"),
+	}
+	if err := DeployContext(context.Background(), c, &exportFlow{hostFlow{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[1].GetName() != "export.ova" {
+		t.Fatalf("unexpected artifacts %v", seen)
+	}
+	if len(c.Report.Artifacts) != 2 || c.Report.AuditLog != c.AuditLog {
+		t.Fatalf("unexpected report artifacts %v", c.Report.Artifacts)
+	}
+	m, err := deployer.LoadManifest(c.ManifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Artifacts) != 2 || m.Artifacts[1].Checksum == "" {
+		t.Fatalf("unexpected manifest artifacts %v", m.Artifacts)
+	}
+}
+
+// moveFlow moves the artifact of hostFlow to the export directory
+// (like uploading it to the remote host)
+type moveFlow struct {
+	hostFlow
+}
+
+func (f *moveFlow) CreatePostProcessor(c *deployer.CommonData) (deployer.PostProcessor, error) {
+	return f, nil
+}
+
+func (f *moveFlow) PostProcess(artifacts []deployer.Artifact) error {
+	a := artifacts[0].(*deployer.CommonArtifact)
+	dst := filepath.Join(f.dir, "export", filepath.Base(a.Path))
+	if err := os.Rename(a.Path, dst); err != nil {
+		return err
+	}
+	a.Path = dst
+	return nil
+}
+
+func TestMovedArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "export"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	key := trustKey(t, dir)
+
+	c := &deployer.CommonData{RootDir: dir, Host: "kvm1", SigningKey: key, ReportFile: filepath.Join(dir, "report.json")}
+	if err := DeployContext(context.Background(), c, &moveFlow{hostFlow{dir}}); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "export", "kvm1.img")
+	if len(c.Report.Artifacts) != 1 || c.Report.Artifacts[0].Path != dst {
+		t.Fatalf("unexpected report artifacts %v", c.Report.Artifacts)
+	}
+	// the manifest refers to the moved artifact and remains signed
+	m, err := deployer.LoadManifest(c.ManifestPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Artifacts) != 1 || m.Artifacts[0].Path != dst {
+		t.Fatalf("unexpected manifest artifacts %v", m.Artifacts)
+	}
+	keys, err := c.TrustedPublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifySignature(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,31 +1,60 @@
 package libvirt_kvm
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"regexp"
 
 	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/drivers/env_driver/libvirt/libvirt_kvm"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	ssh "github.com/dorzheh/infra/comm/common"
 )
 
+// domainNameRegexp extracts the domain name from the domain XML
+var domainNameRegexp = regexp.MustCompile(`<name>\s*(\S+)\s*</name>`)
+
 type PostProcessor struct {
 	driver      *libvirt_kvm.Driver
 	startDomain bool
 }
 
 func NewPostProcessor(sshconf *ssh.Config, startDomain bool) *PostProcessor {
+	return NewPostProcessorWithExecutor(utils.NewExecutor(sshconf), startDomain)
+}
+
+// NewPostProcessorWithExecutor creates a post-processor running the commands by means of the executor
+func NewPostProcessorWithExecutor(e utils.Executor, startDomain bool) *PostProcessor {
 	p := new(PostProcessor)
-	p.driver = libvirt_kvm.NewDriver(sshconf)
+	p.driver = libvirt_kvm.NewDriverWithExecutor(e)
 	p.startDomain = startDomain
 	return p
 }
 
+func (p *PostProcessor) Id() string {
+	return "LibvirtPostProcessor"
+}
+
 func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
+	return p.PostProcessContext(context.Background(), artifacts)
+}
+
+// PostProcessContext defines the domains unless the context is done.
+// The context is checked before processing each artifact and before starting the domain.
+// Defined and started domains are recorded by the transaction carried by the context (if any)
+func (p *PostProcessor) PostProcessContext(ctx context.Context, artifacts []deployer.Artifact) error {
+	t := deployer.TransactionFromContext(ctx)
+	pr := progress.FromContext(ctx).WithSource(p.Id())
 	for _, a := range artifacts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		switch a.(type) {
 		case *deployer.CommonArtifact:
 			if a.GetType() == deployer.MetadataArtifact {
+				pr.Stage("define", "virsh define "+a.GetPath())
 				if err := p.driver.DefineDomain(a.GetPath()); err != nil {
 					return utils.FormatError(err)
 				}
@@ -35,19 +64,31 @@ func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
 					return utils.FormatError(err)
 				}
 
-				r, err := regexp.Compile(`<name>\s*(\S+)\s*</name>`)
-				if err != nil {
-					return utils.FormatError(err)
-				}
-
-				domain := r.FindStringSubmatch(out)[1]
+				domain := domainNameRegexp.FindStringSubmatch(out)[1]
+				t.Record("undefine domain "+domain, func() error {
+					return p.driver.UndefineDomain(domain)
+				})
+				pr.Stage("autostart", "virsh autostart "+domain)
 				if err := p.driver.SetAutostart(domain); err != nil {
 					return utils.FormatError(err)
 				}
+				t.Record("disable autostart of domain "+domain, func() error {
+					if _, err := p.driver.Run("virsh autostart --disable " + domain); err != nil {
+						return utils.FormatError(err)
+					}
+					return nil
+				})
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				if p.startDomain {
+					pr.Stage("start", "virsh start "+domain)
 					if err := p.driver.StartDomain(domain); err != nil {
 						return utils.FormatError(err)
 					}
+					t.Record("destroy domain "+domain, func() error {
+						return p.driver.DestroyDomain(domain)
+					})
 				}
 				if err := a.Destroy(); err != nil {
 					return utils.FormatError(err)
@@ -57,3 +98,27 @@ func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
 	}
 	return nil
 }
+
+// Plan writes the commands defining the domains to w
+func (p *PostProcessor) Plan(w io.Writer, artifacts []deployer.Artifact) error {
+	for _, a := range artifacts {
+		if a.GetType() != deployer.MetadataArtifact {
+			continue
+		}
+		domain := "<domain>"
+		if pa, ok := a.(*deployer.PlannedArtifact); ok {
+			if m := domainNameRegexp.FindStringSubmatch(pa.Content); m != nil {
+				domain = m[1]
+			}
+		}
+		fmt.Fprintf(w, "virsh define %s\n", a.GetPath())
+		fmt.Fprintf(w, "virsh autostart %s\n", domain)
+		if p.startDomain {
+			fmt.Fprintf(w, "virsh start %s\n", domain)
+		}
+		if _, err := fmt.Fprintf(w, "rm -f %s\n", a.GetPath()); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	return nil
+}
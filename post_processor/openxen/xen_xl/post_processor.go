@@ -1,28 +1,57 @@
 package xen_xl
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"regexp"
 
 	"github.com/dorzheh/deployer/deployer"
 	"github.com/dorzheh/deployer/drivers/env_driver/openxen/xen_xl"
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	ssh "github.com/dorzheh/infra/comm/common"
 )
 
+// domainNameRegexp extracts the domain name from the xl configuration
+var domainNameRegexp = regexp.MustCompile(`\s*name\s*=\s*(\S+)`)
+
 type PostProcessor struct {
 	driver      *xen_xl.Driver
 	startDomain bool
 }
 
 func NewPostProcessor(sshconf *ssh.Config, startDomain bool) *PostProcessor {
+	return NewPostProcessorWithExecutor(utils.NewExecutor(sshconf), startDomain)
+}
+
+// NewPostProcessorWithExecutor creates a post-processor running the commands by means of the executor
+func NewPostProcessorWithExecutor(e utils.Executor, startDomain bool) *PostProcessor {
 	p := new(PostProcessor)
-	p.driver = xen_xl.NewDriver(sshconf)
+	p.driver = xen_xl.NewDriverWithExecutor(e)
 	p.startDomain = startDomain
 	return p
 }
 
+func (p *PostProcessor) Id() string {
+	return "XenPostProcessor"
+}
+
 func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
+	return p.PostProcessContext(context.Background(), artifacts)
+}
+
+// PostProcessContext defines the domains unless the context is done.
+// The context is checked before processing each artifact and before starting the domain.
+// Copied configuration files and started domains are recorded by the transaction
+// carried by the context (if any)
+func (p *PostProcessor) PostProcessContext(ctx context.Context, artifacts []deployer.Artifact) error {
+	t := deployer.TransactionFromContext(ctx)
+	pr := progress.FromContext(ctx).WithSource(p.Id())
 	for _, a := range artifacts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		switch a.(type) {
 		case *deployer.CommonArtifact:
 			if a.GetType() == deployer.MetadataArtifact {
@@ -31,23 +60,39 @@ func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
 					return utils.FormatError(err)
 				}
 
-				r, err := regexp.Compile(`\s*name\s*=\s*(\S+)`)
-				if err != nil {
-					return utils.FormatError(err)
-				}
-
-				domain := r.FindStringSubmatch(out)[1]
+				domain := domainNameRegexp.FindStringSubmatch(out)[1]
 				configFile := "/etc/xen/" + domain + ".cfg"
+				pr.Stage("define", "cp "+a.GetPath()+" "+configFile)
 				if _, err := p.driver.Run("mkdir -p /etc/xen/auto;cp " + a.GetPath() + " " + configFile); err != nil {
 					return utils.FormatError(err)
 				}
+				t.Record("remove "+configFile, func() error {
+					if _, err := p.driver.Run("rm -f " + configFile); err != nil {
+						return utils.FormatError(err)
+					}
+					return nil
+				})
+				pr.Stage("autostart", "ln -fs "+configFile+" /etc/xen/auto/")
 				if err := p.driver.SetAutostart(domain); err != nil {
 					return utils.FormatError(err)
 				}
+				t.Record("remove autostart link of domain "+domain, func() error {
+					if _, err := p.driver.Run("rm -f /etc/xen/auto/" + domain + ".cfg"); err != nil {
+						return utils.FormatError(err)
+					}
+					return nil
+				})
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				if p.startDomain {
+					pr.Stage("start", "xl create "+configFile)
 					if err := p.driver.StartDomain(configFile); err != nil {
 						return utils.FormatError(err)
 					}
+					t.Record("destroy domain "+domain, func() error {
+						return p.driver.DestroyDomain(domain)
+					})
 				}
 				if err := a.Destroy(); err != nil {
 					return utils.FormatError(err)
@@ -57,3 +102,28 @@ func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
 	}
 	return nil
 }
+
+// Plan writes the commands defining the domains to w
+func (p *PostProcessor) Plan(w io.Writer, artifacts []deployer.Artifact) error {
+	for _, a := range artifacts {
+		if a.GetType() != deployer.MetadataArtifact {
+			continue
+		}
+		domain := "<domain>"
+		if pa, ok := a.(*deployer.PlannedArtifact); ok {
+			if m := domainNameRegexp.FindStringSubmatch(pa.Content); m != nil {
+				domain = m[1]
+			}
+		}
+		configFile := "/etc/xen/" + domain + ".cfg"
+		fmt.Fprintf(w, "mkdir -p /etc/xen/auto;cp %s %s\n", a.GetPath(), configFile)
+		fmt.Fprintf(w, "ln -fs %s /etc/xen/auto/%s.cfg\n", configFile, domain)
+		if p.startDomain {
+			fmt.Fprintf(w, "xl create %s\n", configFile)
+		}
+		if _, err := fmt.Fprintf(w, "rm -f %s\n", a.GetPath()); err != nil {
+			return utils.FormatError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package ova
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"text/template"
+)
+
+// disk describes a virtual disk of the package
+type disk struct {
+	// Index of the disk (starting from 1)
+	Index int
+
+	// File is the name of the VMDK file within the package
+	File string
+
+	// Size of the VMDK file
+	Size int64
+
+	// Capacity is the virtual size of the disk in bytes
+	Capacity int64
+}
+
+// Unit returns the address of the disk on the controller
+func (d *disk) Unit() int {
+	return d.Index - 1
+}
+
+// descriptor is the data the OVF descriptor is rendered from
+type descriptor struct {
+	Name     string
+	CPUs     int
+	RamMb    int
+	Disks    []*disk
+	Networks []string
+	NICs     []string
+}
+
+// descriptorTemplate renders OVF 1.0 descriptor.
+// The RASD elements of the items are sorted as required by the schema.
+var descriptorTemplate = template.Must(template.New("ovf").Funcs(template.FuncMap{
+	"xml": escape,
+	"add": func(a, b int) int { return a + b },
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <References>
+{{- range .Disks}}
+    <File ovf:href="{{xml .File}}" ovf:id="file{{.Index}}" ovf:size="{{.Size}}"/>
+{{- end}}
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+{{- range .Disks}}
+    <Disk ovf:capacity="{{.Capacity}}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk{{.Index}}" ovf:fileRef="file{{.Index}}" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+{{- end}}
+  </DiskSection>
+{{- if .Networks}}
+  <NetworkSection>
+    <Info>The list of logical networks</Info>
+{{- range .Networks}}
+    <Network ovf:name="{{xml .}}">
+      <Description>The {{xml .}} network</Description>
+    </Network>
+{{- end}}
+  </NetworkSection>
+{{- end}}
+  <VirtualSystem ovf:id="{{xml .Name}}">
+    <Info>A virtual machine</Info>
+    <Name>{{xml .Name}}</Name>
+    <OperatingSystemSection ovf:id="1">
+      <Info>The kind of installed guest operating system</Info>
+    </OperatingSystemSection>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{xml .Name}}</vssd:VirtualSystemIdentifier>
+        <vssd:VirtualSystemType>vmx-07</vssd:VirtualSystemType>
+      </System>
+      <Item>
+        <rasd:AllocationUnits>hertz * 10^6</rasd:AllocationUnits>
+        <rasd:Description>Number of Virtual CPUs</rasd:Description>
+        <rasd:ElementName>{{.CPUs}} virtual CPU(s)</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.CPUs}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^20</rasd:AllocationUnits>
+        <rasd:Description>Memory Size</rasd:Description>
+        <rasd:ElementName>{{.RamMb}}MB of memory</rasd:ElementName>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>{{.RamMb}}</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:Address>0</rasd:Address>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>SCSI Controller 0</rasd:ElementName>
+        <rasd:InstanceID>3</rasd:InstanceID>
+        <rasd:ResourceSubType>lsilogic</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+{{- range .Disks}}
+      <Item>
+        <rasd:AddressOnParent>{{.Unit}}</rasd:AddressOnParent>
+        <rasd:ElementName>Hard Disk {{.Index}}</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk{{.Index}}</rasd:HostResource>
+        <rasd:InstanceID>{{add .Index 3}}</rasd:InstanceID>
+        <rasd:Parent>3</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+{{- end}}
+{{- $first := add (len .Disks) 4}}
+{{- range $i, $network := .NICs}}
+      <Item>
+        <rasd:AddressOnParent>{{add $i 7}}</rasd:AddressOnParent>
+        <rasd:AutomaticAllocation>true</rasd:AutomaticAllocation>
+        <rasd:Connection>{{xml $network}}</rasd:Connection>
+        <rasd:Description>E1000 ethernet adapter on "{{xml $network}}"</rasd:Description>
+        <rasd:ElementName>Network adapter {{add $i 1}}</rasd:ElementName>
+        <rasd:InstanceID>{{add $i $first}}</rasd:InstanceID>
+        <rasd:ResourceSubType>E1000</rasd:ResourceSubType>
+        <rasd:ResourceType>10</rasd:ResourceType>
+      </Item>
+{{- end}}
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`))
+
+// render returns the OVF descriptor
+func (d *descriptor) render() (string, error) {
+	buf := new(bytes.Buffer)
+	if err := descriptorTemplate.Execute(buf, d); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// escape escapes the text placed within XML element or attribute
+func escape(s string) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := xml.EscapeText(buf, []byte(s)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var (
+	// interfaceRegexp matches network interfaces of libvirt domain XML
+	interfaceRegexp = regexp.MustCompile(`(?s)<(?:interface|hostdev)\b.*?</(?:interface|hostdev)>`)
+
+	// sourceRegexp extracts the network (or the bridge, or the device) of the interface
+	sourceRegexp = regexp.MustCompile(`<source\s[^>]*\b(?:network|bridge|dev)\s*=\s*['"]([^'"]+)['"]`)
+
+	// vifBridgeRegexp extracts the bridges of xl configuration ("vif = ['bridge=xenbr0,...']")
+	vifBridgeRegexp = regexp.MustCompile(`bridge=([^,'"\]\s]+)`)
+)
+
+// networks returns the networks the NICs described by the rendered network
+// metadata (see metadata.Metadata) are connected to, a network per NIC.
+// Passthrough interfaces are connected to the "passthrough" network.
+func networks(data string) []string {
+	var names []string
+	if ifaces := interfaceRegexp.FindAllString(data, -1); ifaces != nil {
+		for _, iface := range ifaces {
+			name := "passthrough"
+			if m := sourceRegexp.FindStringSubmatch(iface); m != nil {
+				name = m[1]
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	for _, m := range vifBridgeRegexp.FindAllStringSubmatch(data, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// unique returns the names without duplicates, preserving the order
+func unique(names []string) []string {
+	var u []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			u = append(u, n)
+		}
+	}
+	return u
+}
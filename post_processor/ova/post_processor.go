@@ -0,0 +1,291 @@
+// Package ova exports the appliance as OVA package.
+//
+// The image artifacts are converted to streamOptimized VMDK disks and
+// described, along with CPUs, RAM and networks of the appliance, by an
+// OVF descriptor. The descriptor, the disks and the manifest containing
+// their SHA256 checksums are packed into <name>.ova (ustar archive).
+package ova
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dorzheh/deployer/config/metadata"
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
+	ssh "github.com/dorzheh/infra/comm/common"
+)
+
+// Artifact is the OVA package created by the post-processor
+type Artifact struct {
+	deployer.CommonArtifact
+
+	// Descriptor is the OVF descriptor of the package
+	Descriptor string
+
+	// Disks are the names of the VMDK files within the package
+	Disks []string
+}
+
+type PostProcessor struct {
+	// Name of the appliance (the package is named <Name>.ova)
+	Name string
+
+	CPUs  int
+	RamMb int
+
+	// Networks the NICs of the appliance are connected to, a network per NIC
+	Networks []string
+
+	// ExportDir is the directory the package is created in.
+	// Defaults to the directory of the first image.
+	ExportDir string
+
+	executor utils.Executor
+}
+
+// NewPostProcessor creates a post-processor exporting the appliance
+// described by the metadata
+func NewPostProcessor(m *metadata.Metadata, exportDir string, sshconf *ssh.Config) *PostProcessor {
+	return NewPostProcessorWithExecutor(m, exportDir, utils.NewExecutor(sshconf))
+}
+
+// NewPostProcessorWithExecutor creates a post-processor running the commands by means of the executor
+func NewPostProcessorWithExecutor(m *metadata.Metadata, exportDir string, e utils.Executor) *PostProcessor {
+	p := new(PostProcessor)
+	p.Name = m.DomainName
+	p.CPUs = m.CPUs
+	// the metadata keeps RAM in KiB
+	p.RamMb = m.RAM / 1024
+	p.Networks = networks(m.Networks)
+	p.ExportDir = exportDir
+	p.executor = e
+	return p
+}
+
+func (p *PostProcessor) Id() string {
+	return "OVAPostProcessor"
+}
+
+func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
+	return p.PostProcessContext(context.Background(), artifacts)
+}
+
+func (p *PostProcessor) PostProcessContext(ctx context.Context, artifacts []deployer.Artifact) error {
+	_, err := p.PostProcessArtifacts(ctx, artifacts)
+	return err
+}
+
+// PostProcessArtifacts creates the package of the image artifacts unless the context is done.
+// The intermediate files (the disks, the descriptor and the manifest) are removed
+// once the package is created.
+// Returns the package (*Artifact).
+func (p *PostProcessor) PostProcessArtifacts(ctx context.Context, artifacts []deployer.Artifact) ([]deployer.Artifact, error) {
+	images := p.images(artifacts)
+	if len(images) == 0 {
+		return nil, utils.FormatError(fmt.Errorf("%s: no image artifacts", p.Id()))
+	}
+	pr := progress.FromContext(ctx).WithSource(p.Id())
+	dir := p.dir(images)
+	d := p.descriptor()
+
+	files := []string{p.Name + ".ovf", p.Name + ".mf"}
+	defer p.run(context.Background(), p.cleanup(dir, images))
+
+	for i, img := range images {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vd := &disk{Index: i + 1, File: diskFile(p.Name, i)}
+		path := filepath.Join(dir, vd.File)
+		pr.Stage("convert", img.GetPath()+" -> "+path)
+		if _, err := p.run(ctx, convertCommand(img.GetPath(), path)); err != nil {
+			return nil, utils.FormatError(err)
+		}
+		capacity, err := p.capacity(ctx, img)
+		if err != nil {
+			return nil, utils.FormatError(err)
+		}
+		out, err := p.run(ctx, "stat -L -c %s "+path)
+		if err != nil {
+			return nil, utils.FormatError(err)
+		}
+		if vd.Size, err = strconv.ParseInt(out, 10, 64); err != nil {
+			return nil, utils.FormatError(fmt.Errorf("unexpected output of stat: %q", out))
+		}
+		vd.Capacity = capacity
+		d.Disks = append(d.Disks, vd)
+		files = append(files, vd.File)
+	}
+
+	pr.Stage("descriptor", filepath.Join(dir, files[0]))
+	ovf, err := d.render()
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if err := p.write(ctx, filepath.Join(dir, files[0]), ovf); err != nil {
+		return nil, utils.FormatError(err)
+	}
+
+	// the manifest lists the descriptor and the disks
+	out, err := p.run(ctx, "cd "+dir+" && sha256sum "+files[0]+" "+strings.Join(files[2:], " "))
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	mf, err := manifest(out)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	if err := p.write(ctx, filepath.Join(dir, files[1]), mf); err != nil {
+		return nil, utils.FormatError(err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a := p.artifact(dir, ovf, files[2:])
+	pr.Stage("package", a.Path)
+	if _, err := p.run(ctx, tarCommand(dir, a.Path, files)); err != nil {
+		return nil, utils.FormatError(err)
+	}
+	return []deployer.Artifact{a}, nil
+}
+
+// Plan writes the commands creating the package to w
+func (p *PostProcessor) Plan(w io.Writer, artifacts []deployer.Artifact) error {
+	images := p.images(artifacts)
+	if len(images) == 0 {
+		return utils.FormatError(fmt.Errorf("%s: no image artifacts", p.Id()))
+	}
+	dir := p.dir(images)
+	files := []string{p.Name + ".ovf", p.Name + ".mf"}
+	for i, img := range images {
+		files = append(files, diskFile(p.Name, i))
+		fmt.Fprintln(w, convertCommand(img.GetPath(), filepath.Join(dir, files[len(files)-1])))
+	}
+	fmt.Fprintf(w, "cat > %s <<EOF\n<OVF descriptor: %d CPUs, %dMB RAM, networks %s>\nEOF\n",
+		filepath.Join(dir, files[0]), p.CPUs, p.RamMb, strings.Join(p.Networks, ", "))
+	fmt.Fprintf(w, "cd %s && sha256sum %s %s > %s\n", dir, files[0], strings.Join(files[2:], " "), files[1])
+	fmt.Fprintln(w, tarCommand(dir, filepath.Join(dir, p.Name+".ova"), files))
+	if _, err := fmt.Fprintln(w, p.cleanup(dir, images)); err != nil {
+		return utils.FormatError(err)
+	}
+	return nil
+}
+
+// images returns the image artifacts to be packed
+func (p *PostProcessor) images(artifacts []deployer.Artifact) []deployer.Artifact {
+	var images []deployer.Artifact
+	for _, a := range artifacts {
+		if a.GetType() == deployer.ImageArtifact {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
+// dir returns the directory the package is created in
+func (p *PostProcessor) dir(images []deployer.Artifact) string {
+	if p.ExportDir != "" {
+		return p.ExportDir
+	}
+	return filepath.Dir(images[0].GetPath())
+}
+
+// descriptor returns the descriptor of the appliance without the disks
+func (p *PostProcessor) descriptor() *descriptor {
+	return &descriptor{
+		Name:     p.Name,
+		CPUs:     p.CPUs,
+		RamMb:    p.RamMb,
+		Networks: unique(p.Networks),
+		NICs:     p.Networks,
+	}
+}
+
+// artifact returns the package artifact
+func (p *PostProcessor) artifact(dir, ovf string, disks []string) *Artifact {
+	a := &Artifact{Descriptor: ovf, Disks: disks}
+	a.Name = p.Name + ".ova"
+	a.Path = filepath.Join(dir, a.Name)
+	a.Type = deployer.PackageArtifact
+	a.Executor = p.executor
+	return a
+}
+
+// capacity returns the virtual size of the image
+func (p *PostProcessor) capacity(ctx context.Context, img deployer.Artifact) (int64, error) {
+	if c, ok := img.(*deployer.CommonArtifact); ok && c.VirtualSize > 0 {
+		return c.VirtualSize, nil
+	}
+	out, err := p.run(ctx, "qemu-img info --output=json "+img.GetPath())
+	if err != nil {
+		return 0, err
+	}
+	info := new(struct {
+		VirtualSize int64 `json:"virtual-size"`
+	})
+	if err := json.Unmarshal([]byte(out), info); err != nil {
+		return 0, fmt.Errorf("unexpected output of qemu-img: %v", err)
+	}
+	return info.VirtualSize, nil
+}
+
+// run runs the command unless the context is done
+func (p *PostProcessor) run(ctx context.Context, cmd string) (string, error) {
+	res, err := p.executor.Execute(ctx, &utils.Command{Cmd: cmd})
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// write writes the content to the file
+func (p *PostProcessor) write(ctx context.Context, path, content string) error {
+	_, err := p.executor.Execute(ctx, &utils.Command{Cmd: "cat > " + path, Stdin: strings.NewReader(content)})
+	return err
+}
+
+// cleanup returns the command removing the intermediate files
+func (p *PostProcessor) cleanup(dir string, images []deployer.Artifact) string {
+	files := []string{filepath.Join(dir, p.Name+".ovf"), filepath.Join(dir, p.Name+".mf")}
+	for i := range images {
+		files = append(files, filepath.Join(dir, diskFile(p.Name, i)))
+	}
+	return "rm -f " + strings.Join(files, " ")
+}
+
+// diskFile returns name of the VMDK file of the i-th image
+func diskFile(name string, i int) string {
+	return fmt.Sprintf("%s-disk%d.vmdk", name, i+1)
+}
+
+// convertCommand returns the command converting the image to streamOptimized VMDK
+func convertCommand(src, dst string) string {
+	return "qemu-img convert -O vmdk -o subformat=streamOptimized " + src + " " + dst
+}
+
+// tarCommand returns the command packing the files.
+// The descriptor must be the first file of the package.
+func tarCommand(dir, path string, files []string) string {
+	return "tar --format=ustar -C " + dir + " -cf " + path + " " + strings.Join(files, " ")
+}
+
+// manifest converts the output of sha256sum to OVF manifest
+func manifest(sums string) (string, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return "", fmt.Errorf("unexpected output of sha256sum: %q", line)
+		}
+		lines = append(lines, fmt.Sprintf("SHA256(%s)= %s", strings.TrimPrefix(fields[1], "*"), fields[0]))
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
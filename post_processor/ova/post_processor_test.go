@@ -0,0 +1,136 @@
+package ova
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dorzheh/deployer/config/metadata"
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+)
+
+var libvirtNetworks = `
+<interface type='network'>
+  <source network='default'/>
+  <model type='virtio'/>
+</interface>
+<interface type='bridge'>
+  <source bridge='br0'/>
+</interface>
+<interface type='network'>
+  <source network='default'/>
+</interface>
+<hostdev mode='subsystem' type='pci' managed='yes'>
+  <source><address domain='0x0000' bus='0x03' slot='0x00' function='0x1'/></source>
+</hostdev>`
+
+func TestNetworks(t *testing.T) {
+	if n := networks(libvirtNetworks); !reflect.DeepEqual(n, []string{"default", "br0", "default", "passthrough"}) {
+		t.Fatalf("unexpected networks %v", n)
+	}
+	if n := networks("vif = ['bridge=xenbr0,model=e1000', 'mac=00:16:3e:00:00:01,bridge=xenbr1']"); !reflect.DeepEqual(n, []string{"xenbr0", "xenbr1"}) {
+		t.Fatalf("unexpected networks %v", n)
+	}
+}
+
+func TestPostProcessArtifacts(t *testing.T) {
+	written := make(map[string]string)
+	e := &utils.RecordingExecutor{Respond: func(c *utils.Command) (*utils.Result, error) {
+		switch {
+		case strings.HasPrefix(c.Cmd, "cat > "):
+			b, _ := ioutil.ReadAll(c.Stdin)
+			written[strings.TrimPrefix(c.Cmd, "cat > ")] = string(b)
+		case strings.HasPrefix(c.Cmd, "stat "):
+			return &utils.Result{Stdout: "1024"}, nil
+		case strings.HasPrefix(c.Cmd, "qemu-img info "):
+			return &utils.Result{Stdout: `{"virtual-size": 2147483648}`}, nil
+		case strings.Contains(c.Cmd, "sha256sum "):
+			return &utils.Result{Stdout: "aaaa  va.ovf\nbbbb  va-disk1.vmdk\ncccc  va-disk2.vmdk"}, nil
+		}
+		return new(utils.Result), nil
+	}}
+	m := &metadata.Metadata{DomainName: "va", CPUs: 2, RAM: 2048 * 1024, Networks: libvirtNetworks}
+	p := NewPostProcessorWithExecutor(m, "", e)
+	artifacts := []deployer.Artifact{
+		&deployer.CommonArtifact{Name: "va.img", Path: "/var/lib/va.img", Type: deployer.ImageArtifact, VirtualSize: 10737418240},
+		&deployer.CommonArtifact{Name: "va.xml", Path: "/var/lib/va.xml", Type: deployer.MetadataArtifact},
+		&deployer.CommonArtifact{Name: "data.qcow2", Path: "/var/lib/data.qcow2", Type: deployer.ImageArtifact},
+	}
+	created, err := p.PostProcessArtifacts(context.Background(), artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 {
+		t.Fatalf("unexpected artifacts %v", created)
+	}
+	a, ok := created[0].(*Artifact)
+	if !ok || a.GetPath() != "/var/lib/va.ova" || a.GetType() != deployer.PackageArtifact || len(a.Disks) != 2 {
+		t.Fatalf("unexpected artifact %+v", created[0])
+	}
+
+	commands := e.Commands()
+	for i, expected := range []string{
+		"qemu-img convert -O vmdk -o subformat=streamOptimized /var/lib/va.img /var/lib/va-disk1.vmdk",
+		"stat -L -c %s /var/lib/va-disk1.vmdk",
+		"qemu-img convert -O vmdk -o subformat=streamOptimized /var/lib/data.qcow2 /var/lib/va-disk2.vmdk",
+		"qemu-img info --output=json /var/lib/data.qcow2",
+	} {
+		if commands[i] != expected {
+			t.Fatalf("unexpected command %q, expected %q", commands[i], expected)
+		}
+	}
+	last := commands[len(commands)-2:]
+	if last[0] != "tar --format=ustar -C /var/lib -cf /var/lib/va.ova va.ovf va.mf va-disk1.vmdk va-disk2.vmdk" ||
+		last[1] != "rm -f /var/lib/va.ovf /var/lib/va.mf /var/lib/va-disk1.vmdk /var/lib/va-disk2.vmdk" {
+		t.Fatalf("unexpected commands %v", last)
+	}
+	if mf := written["/var/lib/va.mf"]; mf != "SHA256(va.ovf)= aaaa\nSHA256(va-disk1.vmdk)= bbbb\nSHA256(va-disk2.vmdk)= cccc\n" {
+		t.Fatalf("unexpected manifest %q", mf)
+	}
+
+	ovf := written["/var/lib/va.ovf"]
+	if ovf != a.Descriptor {
+		t.Fatal("the descriptor is supposed to be kept by the artifact")
+	}
+	envelope := new(struct {
+		Disks []struct {
+			Capacity int64 `xml:"capacity,attr"`
+		} `xml:"DiskSection>Disk"`
+		Networks []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"NetworkSection>Network"`
+		Items []struct {
+			ResourceType    int    `xml:"ResourceType"`
+			VirtualQuantity int    `xml:"VirtualQuantity"`
+			Connection      string `xml:"Connection"`
+		} `xml:"VirtualSystem>VirtualHardwareSection>Item"`
+	})
+	if err := xml.Unmarshal([]byte(ovf), envelope); err != nil {
+		t.Fatalf("%v\n%s", err, ovf)
+	}
+	if len(envelope.Disks) != 2 || envelope.Disks[0].Capacity != 10737418240 || envelope.Disks[1].Capacity != 2147483648 {
+		t.Fatalf("unexpected disks %+v", envelope.Disks)
+	}
+	if len(envelope.Networks) != 3 || envelope.Networks[1].Name != "br0" {
+		t.Fatalf("unexpected networks %+v", envelope.Networks)
+	}
+	resources := make(map[int]int)
+	for _, item := range envelope.Items {
+		resources[item.ResourceType]++
+	}
+	if envelope.Items[0].VirtualQuantity != 2 || envelope.Items[1].VirtualQuantity != 2048 ||
+		!reflect.DeepEqual(resources, map[int]int{3: 1, 4: 1, 6: 1, 17: 2, 10: 4}) {
+		t.Fatalf("unexpected hardware %+v", envelope.Items)
+	}
+}
+
+func TestPostProcessArtifactsNoImages(t *testing.T) {
+	p := NewPostProcessorWithExecutor(&metadata.Metadata{DomainName: "va"}, "/tmp", new(utils.RecordingExecutor))
+	if _, err := p.PostProcessArtifacts(context.Background(), nil); err == nil {
+		t.Fatal("supposed to fail without image artifacts")
+	}
+}
@@ -0,0 +1,392 @@
+// Package transfer ships the locally built images to the remote host.
+//
+// The images are uploaded over SFTP (see github.com/pkg/sftp) to <name>.part
+// in the remote export directory and renamed once their checksums are verified
+// against the manifest of the deployment. An interrupted
+// upload is resumed from the last complete chunk, the zero blocks of the
+// images are not sent (the remote images remain sparse) and the upload
+// rate may be limited.
+// The artifacts refer to the remote images once uploaded, so the
+// post-processors following the transfer get the remote paths
+// and the manifest and the report of the deployment refer to them as well.
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
+	ssh "github.com/dorzheh/infra/comm/common"
+	"github.com/pkg/sftp"
+)
+
+// DefaultChunkSize is the default granularity of resuming the upload
+const DefaultChunkSize = 64 << 20
+
+// blockSize is the size of the blocks checked for zeros
+const blockSize = 64 << 10
+
+type PostProcessor struct {
+	// ExportDir is the remote directory the images are uploaded to
+	ExportDir string
+
+	// ChunkSize is the granularity of resuming the upload (DefaultChunkSize if zero)
+	ChunkSize int64
+
+	// BandwidthLimit limits the upload rate (in bytes per second).
+	// Zero means no limit.
+	BandwidthLimit int64
+
+	// Manifest (optional) provides the checksums the uploaded images are verified against.
+	// If not set, the manifest carried by the context (see deployer.WithManifest) is used.
+	// The checksums of the images missing in the manifest are taken
+	// from the artifacts (see deployer.CommonArtifact.Inspect).
+	Manifest *deployer.Manifest
+
+	// RemoveLocal removes the local images once they are uploaded
+	RemoveLocal bool
+
+	sshconf  *ssh.Config
+	executor utils.Executor
+	dial     func() (*sftp.Client, error)
+}
+
+// NewPostProcessor creates a post-processor uploading the images to the export
+// directory of the host described by the SSH config
+func NewPostProcessor(sshconf *ssh.Config, exportDir string) *PostProcessor {
+	p := NewPostProcessorWithClient(utils.NewExecutor(sshconf), func() (*sftp.Client, error) {
+		return newClient(sshconf)
+	}, exportDir)
+	p.sshconf = sshconf
+	return p
+}
+
+// NewPostProcessorWithClient creates a post-processor uploading the images by means
+// of the clients returned by dial and running the remote commands by means of the executor
+func NewPostProcessorWithClient(e utils.Executor, dial func() (*sftp.Client, error), exportDir string) *PostProcessor {
+	p := new(PostProcessor)
+	p.ExportDir = exportDir
+	p.executor = e
+	p.dial = dial
+	return p
+}
+
+// newClient starts SFTP session over the pooled SSH connection to the host.
+// The session is released once the client is closed
+func newClient(sshconf *ssh.Config) (*sftp.Client, error) {
+	session, release, err := utils.DefaultSshPool.NewSession(sshconf)
+	if err != nil {
+		return nil, utils.FormatError(err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		release()
+		return nil, utils.FormatError(err)
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		release()
+		return nil, utils.FormatError(err)
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		release()
+		return nil, utils.FormatError(err)
+	}
+	// the writes are sent concurrently, so that the throughput
+	// doesn't depend on the round trip time of the link
+	client, err := sftp.NewClientPipe(r, w, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		release()
+		return nil, utils.FormatError(err)
+	}
+	go func() {
+		client.Wait()
+		release()
+	}()
+	return client, nil
+}
+
+func (p *PostProcessor) Id() string {
+	return "TransferPostProcessor"
+}
+
+func (p *PostProcessor) PostProcess(artifacts []deployer.Artifact) error {
+	return p.PostProcessContext(context.Background(), artifacts)
+}
+
+// PostProcessContext uploads the local images unless the context is done.
+// The paths of the artifacts are rewritten to the remote paths.
+// Both the uploaded images and the local ones are recorded by the transaction
+// carried by the context (if any)
+func (p *PostProcessor) PostProcessContext(ctx context.Context, artifacts []deployer.Artifact) error {
+	images := p.images(artifacts)
+	if len(images) == 0 {
+		return nil
+	}
+	m := p.Manifest
+	if m == nil {
+		m = deployer.ManifestFromContext(ctx)
+	}
+	if _, err := p.executor.Execute(ctx, &utils.Command{Cmd: "mkdir -p " + p.ExportDir}); err != nil {
+		return utils.FormatError(err)
+	}
+	client, err := p.dial()
+	if err != nil {
+		return utils.FormatError(err)
+	}
+	defer client.Close()
+
+	pr := progress.FromContext(ctx).WithSource(p.Id())
+	t := deployer.TransactionFromContext(ctx)
+	for _, a := range images {
+		sum, err := checksum(m, a)
+		if err != nil {
+			return utils.FormatError(err)
+		}
+		dst := path.Join(p.ExportDir, a.Name)
+		part := dst + ".part"
+		resumed, err := p.upload(ctx, pr, client, a.Path, part, true)
+		if err != nil {
+			return utils.FormatError(err)
+		}
+		t.RecordArtifact("remove image "+part, p.remove(part))
+		pr.Stage("verify", "sha256sum "+part)
+		err = p.verify(ctx, part, sum)
+		if err != nil && resumed {
+			// the part uploaded before doesn't match the image, start over
+			if _, err = p.upload(ctx, pr, client, a.Path, part, false); err != nil {
+				return utils.FormatError(err)
+			}
+			err = p.verify(ctx, part, sum)
+		}
+		if err != nil {
+			return utils.FormatError(err)
+		}
+
+		if err := client.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return utils.FormatError(err)
+		}
+		if err := client.Rename(part, dst); err != nil {
+			return utils.FormatError(err)
+		}
+		t.RecordArtifact("remove image "+dst, p.remove(dst))
+		// the artifact refers to the remote image from now on,
+		// so the local one is recorded on its own
+		local := *a
+		t.RecordArtifact("remove image "+local.Path, local.Destroy)
+		if p.RemoveLocal {
+			if err := a.Destroy(); err != nil {
+				return utils.FormatError(err)
+			}
+		}
+		a.Path = dst
+		a.SshConfig = p.sshconf
+		a.Executor = p.executor
+	}
+	return nil
+}
+
+// Plan writes the commands uploading the images to w
+func (p *PostProcessor) Plan(w io.Writer, artifacts []deployer.Artifact) error {
+	images := p.images(artifacts)
+	if len(images) == 0 {
+		return nil
+	}
+	host := "<remote host>"
+	if p.sshconf != nil {
+		host = p.sshconf.Host
+	}
+	fmt.Fprintf(w, "# executed on %s\n", host)
+	fmt.Fprintf(w, "mkdir -p %s\n", p.ExportDir)
+	for _, a := range images {
+		dst := path.Join(p.ExportDir, a.Name)
+		fmt.Fprintf(w, "# upload %s to %s over SFTP (resumable, zero blocks are not sent)\n", a.Path, dst+".part")
+		fmt.Fprintf(w, "sha256sum %s\n", dst+".part")
+		fmt.Fprintf(w, "mv -f %s %s\n", dst+".part", dst)
+		if p.RemoveLocal {
+			fmt.Fprintf(w, "# executed locally\nrm -f %s\n", a.Path)
+		}
+	}
+	return nil
+}
+
+// images returns the local image artifacts
+func (p *PostProcessor) images(artifacts []deployer.Artifact) []*deployer.CommonArtifact {
+	var images []*deployer.CommonArtifact
+	for _, a := range artifacts {
+		if a.GetType() != deployer.ImageArtifact {
+			continue
+		}
+		switch c := a.(type) {
+		case *deployer.CommonArtifact:
+			if c.SshConfig == nil {
+				images = append(images, c)
+			}
+		case *deployer.PlannedArtifact:
+			images = append(images, &c.CommonArtifact)
+		}
+	}
+	return images
+}
+
+// checksum returns the checksum the uploaded image is verified against
+func checksum(m *deployer.Manifest, a *deployer.CommonArtifact) (string, error) {
+	if m != nil {
+		for _, ma := range m.Artifacts {
+			if ma.Path == a.Path && !ma.Remote {
+				return ma.Checksum, nil
+			}
+		}
+	}
+	if a.Checksum == "" {
+		if err := a.Inspect(); err != nil {
+			return "", err
+		}
+	}
+	return a.Checksum, nil
+}
+
+// upload uploads the image unless the context is done.
+// If resume is set, the upload continues from the last complete
+// chunk of the existing part.
+// Returns true if the upload is resumed.
+func (p *PostProcessor) upload(ctx context.Context, pr *progress.Reporter, client *sftp.Client, src, dst string, resume bool) (bool, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := fi.Size()
+
+	chunk := p.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultChunkSize
+	}
+	var offset int64
+	if resume {
+		fi, err := client.Stat(dst)
+		switch {
+		case err == nil:
+			offset = fi.Size() / chunk * chunk
+			if offset > size {
+				offset = 0
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return false, err
+		}
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	rf, err := client.OpenFile(dst, flags)
+	if err != nil {
+		return false, err
+	}
+
+	cmd := fmt.Sprintf("upload %s to %s", src, dst)
+	if offset > 0 {
+		cmd += fmt.Sprintf(" (resumed at %d bytes)", offset)
+	}
+	l := &limiter{rate: p.BandwidthLimit, start: time.Now()}
+	buf := make([]byte, blockSize)
+	zero := make([]byte, blockSize)
+	for off := offset; off < size; {
+		if err := ctx.Err(); err != nil {
+			rf.Close()
+			return false, err
+		}
+		n, err := f.ReadAt(buf, off)
+		if err != nil && !(err == io.EOF && n > 0) {
+			rf.Close()
+			return false, err
+		}
+		// zero blocks are skipped, the holes are created by truncating the file
+		if !bytes.Equal(buf[:n], zero[:n]) {
+			if _, err := rf.WriteAt(buf[:n], off); err != nil {
+				rf.Close()
+				return false, err
+			}
+			if err := l.wait(ctx, n); err != nil {
+				rf.Close()
+				return false, err
+			}
+		}
+		off += int64(n)
+		if off%chunk == 0 || off == size {
+			pr.Report(progress.Event{Stage: "upload", Percent: int(off * 100 / size), Bytes: off, Command: cmd})
+		}
+	}
+	if err := rf.Truncate(size); err != nil {
+		rf.Close()
+		return false, err
+	}
+	if err := rf.Close(); err != nil {
+		return false, err
+	}
+	return offset > 0, nil
+}
+
+// verify compares checksum of the remote file with the expected one
+func (p *PostProcessor) verify(ctx context.Context, dst, sum string) error {
+	res, err := p.executor.Execute(ctx, &utils.Command{Cmd: "sha256sum " + dst})
+	if err != nil {
+		return err
+	}
+	actual := ""
+	if fields := strings.Fields(res.Stdout); len(fields) > 0 {
+		actual = fields[0]
+	}
+	if actual != sum {
+		return fmt.Errorf("%s: checksum %s doesn't match the manifest (%s)", dst, actual, sum)
+	}
+	return nil
+}
+
+// remove returns a function removing the remote file
+func (p *PostProcessor) remove(path string) func() error {
+	return func() error {
+		if _, err := utils.Run(p.executor, "rm -f "+path); err != nil {
+			return utils.FormatError(err)
+		}
+		return nil
+	}
+}
+
+// limiter limits the upload rate
+type limiter struct {
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+// wait delays the upload of the next block until the rate is below the limit
+func (l *limiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	l.sent += int64(n)
+	d := time.Duration(float64(l.sent)/float64(l.rate)*float64(time.Second)) - time.Since(l.start)
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dorzheh/deployer/deployer"
+	"github.com/dorzheh/deployer/utils"
+	"github.com/pkg/sftp"
+)
+
+// pipe creates a client of the SFTP server serving the local filesystem
+func pipe() (*sftp.Client, error) {
+	// the pipes are buffered by the kernel, so that the server
+	// doesn't block responding the concurrent writes
+	sr, cw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cr, sw, err := os.Pipe()
+	if err != nil {
+		sr.Close()
+		cw.Close()
+		return nil, err
+	}
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		server.Serve()
+		sr.Close()
+		sw.Close()
+	}()
+	return sftp.NewClientPipe(cr, cw, sftp.UseConcurrentWrites(true))
+}
+
+func TestPostProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "va.img")
+	remote := filepath.Join(dir, "remote")
+
+	// sparse image: data, a hole and data
+	data := bytes.Repeat([]byte("image"), 60000)
+	content := append(append(append([]byte(nil), data...), make([]byte, 1<<20)...), data...)
+	if err := ioutil.WriteFile(local, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &deployer.CommonArtifact{Name: "va.img", Path: local, Type: deployer.ImageArtifact, Executor: utils.NewExecutor(nil)}
+	m, err := deployer.NewManifest("va", []deployer.Artifact{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote host is emulated by the local one
+	p := NewPostProcessorWithClient(utils.NewExecutor(nil), pipe, remote)
+	p.ChunkSize = 1 << 18
+	p.Manifest = m
+
+	// an interrupted upload: the first chunk matches the image, the rest is garbage
+	if err := os.MkdirAll(remote, 0755); err != nil {
+		t.Fatal(err)
+	}
+	part := filepath.Join(remote, "va.img.part")
+	garbage := append(append([]byte(nil), content[:p.ChunkSize]...), bytes.Repeat([]byte("x"), 1000)...)
+	if err := ioutil.WriteFile(part, garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PostProcess([]deployer.Artifact{a}); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(remote, "va.img")
+	if a.Path != dst || a.Executor == nil {
+		t.Fatalf("the artifact is supposed to refer to the remote image %+v", a)
+	}
+	fb, err := ioutil.ReadFile(dst)
+	if err != nil || !bytes.Equal(fb, content) {
+		t.Fatalf("unexpected remote image (%v)", err)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Fatal("the part is supposed to be renamed")
+	}
+
+	// the part doesn't match the image, so the upload starts over
+	a.Path = local
+	if err := ioutil.WriteFile(part, bytes.Repeat([]byte("x"), int(p.ChunkSize)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PostProcess([]deployer.Artifact{a}); err != nil {
+		t.Fatal(err)
+	}
+	if fb, err := ioutil.ReadFile(dst); err != nil || !bytes.Equal(fb, content) {
+		t.Fatalf("unexpected remote image (%v)", err)
+	}
+
+	// the image doesn't match the manifest
+	a.Path = local
+	m.Artifacts[0].Checksum = strings.Repeat("0", 64)
+	if err := p.PostProcess([]deployer.Artifact{a}); err == nil || !strings.Contains(err.Error(), "doesn't match the manifest") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if a.Path != local {
+		t.Fatal("the artifact is not supposed to be rewritten")
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "va.img")
+	if err := ioutil.WriteFile(local, bytes.Repeat([]byte("image"), 100000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &deployer.CommonArtifact{Name: "va.img", Path: local, Type: deployer.ImageArtifact, Executor: utils.NewExecutor(nil)}
+	p := NewPostProcessorWithClient(utils.NewExecutor(nil), pipe, filepath.Join(dir, "remote"))
+	p.BandwidthLimit = 2 << 20
+	start := time.Now()
+	if err := p.PostProcessContext(context.Background(), []deployer.Artifact{a}); err != nil {
+		t.Fatal(err)
+	}
+	// 500000 bytes at 2MB/s
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Fatalf("the upload is supposed to be limited (%v)", d)
+	}
+}
+
+func TestPostProcessTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "va.img")
+	remote := filepath.Join(dir, "remote")
+	if err := ioutil.WriteFile(local, bytes.Repeat([]byte("image"), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &deployer.CommonArtifact{Name: "va.img", Path: local, Type: deployer.ImageArtifact, Executor: utils.NewExecutor(nil)}
+	m, err := deployer.NewManifest("va", []deployer.Artifact{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPostProcessorWithClient(utils.NewExecutor(nil), pipe, remote)
+
+	// the manifest is taken from the context
+	m.Artifacts[0].Checksum = strings.Repeat("0", 64)
+	ctx := deployer.WithManifest(context.Background(), m)
+	if err := p.PostProcessContext(ctx, []deployer.Artifact{a}); err == nil || !strings.Contains(err.Error(), "doesn't match the manifest") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// both the remote image and the local one are removed on rollback
+	tr := deployer.NewTransaction(false)
+	ctx = deployer.WithTransaction(context.Background(), tr)
+	if err := p.PostProcessContext(ctx, []deployer.Artifact{a}); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(remote, "va.img")
+	if _, err := os.Stat(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{local, dst} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s is supposed to be removed (%v)", path, err)
+		}
+	}
+}
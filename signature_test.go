@@ -0,0 +1,219 @@
+package deployer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dorzheh/deployer/deployer"
+)
+
+// signedFlow post-processes the artifact of hostFlow
+type signedFlow struct {
+	hostFlow
+	processed bool
+}
+
+func (f *signedFlow) CreatePostProcessor(c *deployer.CommonData) (deployer.PostProcessor, error) {
+	return f, nil
+}
+
+func (f *signedFlow) PostProcess(artifacts []deployer.Artifact) error {
+	f.processed = true
+	return nil
+}
+
+// trustKey generates the signing key trusted by the product kit in the directory.
+// Returns path to the private key.
+func trustKey(t *testing.T, dir string) string {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(dir, "build.key")
+	if err := ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "trusted_keys"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if der, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "trusted_keys", "build.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignedArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := trustKey(t, dir)
+
+	f := &signedFlow{hostFlow: hostFlow{dir}}
+	c := &deployer.CommonData{RootDir: dir, Host: "kvm1"}
+	if err := DeployContext(context.Background(), c, f); !errors.Is(err, deployer.ErrUnsigned) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if f.processed {
+		t.Fatal("the artifacts of unsigned manifest are not supposed to be post-processed")
+	}
+
+	// the signature is required, but the key is not trusted
+	c = &deployer.CommonData{RootDir: dir, Host: "kvm1", SigningKey: key, TrustedKeys: filepath.Join(dir, "missing"), RequireSignature: true}
+	if err := DeployContext(context.Background(), c, f); !errors.Is(err, deployer.ErrNoTrustedKeys) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if f.processed {
+		t.Fatal("the artifacts are not supposed to be post-processed without trusted keys")
+	}
+
+	c = &deployer.CommonData{RootDir: dir, Host: "kvm1", SigningKey: key, RequireSignature: true}
+	if err := DeployContext(context.Background(), c, f); err != nil {
+		t.Fatal(err)
+	}
+	if !f.processed {
+		t.Fatal("the artifacts of signed manifest are supposed to be post-processed")
+	}
+}
+
+// resumeFlow counts the builds of the artifact of hostFlow
+// and fails the post-processing if fail is set
+type resumeFlow struct {
+	hostFlow
+	builds int
+	fail   bool
+}
+
+func (f *resumeFlow) CreateBuilders(c *deployer.CommonData) ([]deployer.Builder, error) {
+	return []deployer.Builder{&resumeBuilder{hostBuilder{filepath.Join(f.dir, c.Host+".img")}, f}}, nil
+}
+
+func (f *resumeFlow) CreatePostProcessor(c *deployer.CommonData) (deployer.PostProcessor, error) {
+	return f, nil
+}
+
+func (f *resumeFlow) PostProcess(artifacts []deployer.Artifact) error {
+	if f.fail {
+		return errors.New("post-processing failed")
+	}
+	return nil
+}
+
+type resumeBuilder struct {
+	hostBuilder
+	f *resumeFlow
+}
+
+func (b *resumeBuilder) Run() (deployer.Artifact, error) {
+	b.f.builds++
+	return b.hostBuilder.Run()
+}
+
+func TestResumeSignedArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := trustKey(t, dir)
+	data := func() *deployer.CommonData {
+		return &deployer.CommonData{RootDir: dir, Host: "kvm1", SigningKey: key, Checkpoint: filepath.Join(dir, "checkpoint.json")}
+	}
+	ctx := context.Background()
+
+	f := &resumeFlow{hostFlow: hostFlow{dir}, fail: true}
+	if err := DeployContext(ctx, data(), f); err == nil {
+		t.Fatal("error expected")
+	}
+	path := data().ManifestPath()
+	signed, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the manifest signed by the interrupted deployment is verified
+	m, err := deployer.LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Artifacts[0].Size++
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResumeContext(ctx, data(), f); err == nil || !strings.Contains(err.Error(), "signature doesn't match") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// the artifact covered by the signed manifest is restored
+	if err := ioutil.WriteFile(path, signed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.fail = false
+	if err := ResumeContext(ctx, data(), f); err != nil {
+		t.Fatal(err)
+	}
+	if f.builds != 1 {
+		t.Fatalf("the artifact is not supposed to be built again (%d builds)", f.builds)
+	}
+
+	// the artifact the signed manifest doesn't cover is built again
+	f.fail = true
+	if err := DeployContext(ctx, data(), f); err == nil {
+		t.Fatal("error expected")
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	f.fail = false
+	if err := ResumeContext(ctx, data(), f); err != nil {
+		t.Fatal(err)
+	}
+	if f.builds != 3 {
+		t.Fatalf("the artifact is supposed to be built again (%d builds)", f.builds)
+	}
+}
+
+func TestTamperedManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := trustKey(t, dir)
+	defer ResetHooks()
+
+	// the manifest file is modified between the build and the post-processing
+	RegisterHooks(deployer.BeforePostProcess, func(ctx context.Context, d *deployer.HookData) error {
+		path := d.Data.ManifestPath()
+		m, err := deployer.LoadManifest(path)
+		if err != nil {
+			return err
+		}
+		m.Artifacts[0].Checksum = strings.Repeat("0", 64)
+		return m.WriteFile(path)
+	})
+	f := &signedFlow{hostFlow: hostFlow{dir}}
+	c := &deployer.CommonData{RootDir: dir, Host: "kvm1", SigningKey: key}
+	if err := DeployContext(context.Background(), c, f); err == nil || !strings.Contains(err.Error(), "signature doesn't match") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if f.processed {
+		t.Fatal("the artifacts are not supposed to be post-processed")
+	}
+}
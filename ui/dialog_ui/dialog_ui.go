@@ -5,18 +5,62 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/exec"
 	"time"
 
 	"github.com/dorzheh/deployer/utils"
+	"github.com/dorzheh/deployer/utils/progress"
 	. "github.com/dorzheh/go-dialog"
 )
 
+// Deprecated: compare Navigation(err) with ErrExit, ErrMoveBack and ErrNext
+// instead of comparing error strings.
 const (
 	DialogExit     = "exit status 1"
 	DialogMoveBack = "exit status 2"
 	DialogNext     = "exit status 3"
 )
 
+// NavigationError represents a dialog button used for moving
+// between the steps rather than a failure.
+// The value is the exit status of the dialog.
+type NavigationError int
+
+const (
+	ErrExit     NavigationError = 1
+	ErrMoveBack NavigationError = 2
+	ErrNext     NavigationError = 3
+)
+
+func (e NavigationError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// Navigation returns the navigation the error stands for or 0
+// if the error is not a navigation.
+// Both NavigationError and the exit status of the dialog utility
+// (possibly wrapped by utils.FormatError) are recognized.
+// Exit statuses of other commands are not considered navigation.
+func Navigation(err error) NavigationError {
+	var nav NavigationError
+	if errors.As(err, &nav) {
+		return nav
+	}
+	for {
+		e, ok := err.(*utils.Error)
+		if !ok {
+			break
+		}
+		err = e.Err
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if code := NavigationError(e.ExitCode()); code >= ErrExit && code <= ErrNext {
+			return code
+		}
+	}
+	return 0
+}
+
 const (
 	Success      = "Success"
 	Error        = "Failure"
@@ -160,6 +204,64 @@ func (ui *DialogUi) Progress(title, pbMsg string, duration time.Duration, step i
 	return nil
 }
 
+// ProgressEvents implements a progress bar driven by progress events.
+// The bar shows the progress of the latest stage reported
+// Returns error or nil
+func (ui *DialogUi) ProgressEvents(title, pbMsg string, events <-chan progress.Event, done chan error) error {
+	defaultWidth := 60
+	titleWidth := len(title) + 4
+	msgWidth := len(pbMsg) + 4
+	newWidth := defaultWidth
+	if titleWidth > newWidth {
+		newWidth = titleWidth
+	}
+	if msgWidth > newWidth {
+		newWidth = msgWidth
+	}
+	ui.SetTitle(title)
+	ui.SetSize(11, newWidth)
+	pb := ui.Progressbar()
+	percent := 0
+	for {
+		select {
+		case e := <-events:
+			if e.Percent != progress.Unknown {
+				percent = e.Percent
+			} else if e.Bytes == 0 {
+				// new stage started
+				percent = 0
+			}
+			pb.Step(percent, pbMsg+"\n\n"+progressEventMsg(e, newWidth-4))
+		// wait for result
+		case result := <-done:
+			if result != nil {
+				return result
+			}
+			// we are finished - 100% done
+			pb.Step(100, "\n\nDone!")
+			ui.SetSize(6, 15)
+			time.Sleep(time.Second)
+			return nil
+		}
+	}
+}
+
+// progressEventMsg represents the event as a text fitting the width
+func progressEventMsg(e progress.Event, width int) string {
+	msg := e.Source + ": " + e.Stage
+	if e.Bytes > 0 {
+		msg += fmt.Sprintf(" (%d MB)", e.Bytes>>20)
+	}
+	if e.Command != "" {
+		cmd := e.Command
+		if len(cmd) > width {
+			cmd = cmd[:width-3] + "..."
+		}
+		msg += "\n" + cmd
+	}
+	return msg
+}
+
 // Wait communicates with a progress bar while a given function is executed
 // Returns error or nil
 func (ui *DialogUi) Wait(msg string, pause, timeOut time.Duration, done chan error) error {
@@ -337,8 +439,8 @@ MainLoop:
 				ui.HelpButton(true)
 				ui.SetHelpLabel("Back")
 				passwd2, err = ui.Passwordbox(true)
-				switch err.Error() {
-				case DialogMoveBack:
+				switch Navigation(err) {
+				case ErrMoveBack:
 					continue MainLoop
 				default:
 					return
@@ -14,6 +14,7 @@ import (
 	main "github.com/dorzheh/deployer"
 	"github.com/dorzheh/deployer/builder/image"
 	"github.com/dorzheh/deployer/config"
+	"github.com/dorzheh/deployer/config/answers"
 	"github.com/dorzheh/deployer/config/xmlinput"
 	"github.com/dorzheh/deployer/deployer"
 	gui "github.com/dorzheh/deployer/ui/dialog_ui"
@@ -62,11 +63,25 @@ func UiSelectEnv(c *deployer.CommonData, envList []string, envs []deployer.FlowC
 
 	envsNum := len(envs)
 	dType := 0
+	if c.Answers != nil {
+		if c.Answers.Env == "" {
+			if envsNum > 1 {
+				return utils.FormatError(errors.New("answers: environment is not set"))
+			}
+			return main.Deploy(c, envs[dType])
+		}
+		for i, env := range envList {
+			if env == c.Answers.Env {
+				return main.Deploy(c, envs[i])
+			}
+		}
+		return utils.FormatError(fmt.Errorf("answers: unknown environment \"%s\"", c.Answers.Env))
+	}
 	if envsNum > 1 {
 		c.Ui.SetTitle("Select environment")
 		c.Ui.SetSize(envsNum+7, 30)
 		resStr, err := c.Ui.Menu(envsNum, menuList[0:]...)
-		if err != nil && err.Error() == gui.DialogExit {
+		if err != nil && gui.Navigation(err) == gui.ErrExit {
 			os.Exit(0)
 		}
 		dType, err = strconv.Atoi(resStr)
@@ -75,12 +90,15 @@ func UiSelectEnv(c *deployer.CommonData, envList []string, envs []deployer.FlowC
 		}
 		dType--
 	}
+	if c.RecordFile != "" || c.Checkpoint != "" {
+		c.Record = &answers.Answers{Env: envList[dType]}
+	}
 	return main.Deploy(c, envs[dType])
 }
 
 func UiDeploymentResult(ui *gui.DialogUi, msg string, err error) {
 	if err != nil {
-		ui.Output(gui.Error, err.Error())
+		ui.Output(gui.Error, utils.Describe(err))
 	}
 	ui.Output(gui.Success, msg)
 }
@@ -189,10 +207,10 @@ MainLoop:
 			ui.SetHelpLabel("Back")
 			val, err := ui.Menu(2, "1", "Password", "2", "Private key")
 			if err != nil {
-				switch err.Error() {
-				case gui.DialogMoveBack:
+				switch gui.Navigation(err) {
+				case gui.ErrMoveBack:
 					continue MainLoop
-				case gui.DialogExit:
+				case gui.ErrExit:
 					os.Exit(1)
 				}
 			}
@@ -204,10 +222,10 @@ MainLoop:
 				cfg.PrvtKeyFile, err = ui.GetPathToFileFromInput("Path to ssh private key file", "Back", "")
 			}
 			if err != nil {
-				switch err.Error() {
-				case gui.DialogMoveBack:
+				switch gui.Navigation(err) {
+				case gui.ErrMoveBack:
 					continue AuthLoop
-				case gui.DialogExit:
+				case gui.ErrExit:
 					os.Exit(1)
 				}
 			}
@@ -215,12 +233,12 @@ MainLoop:
 		}
 	}
 
-	run := utils.RunFunc(cfg)
+	executor := utils.NewExecutor(cfg)
 	errCh := make(chan error)
 	defer close(errCh)
 	go func() {
 		// verifying that user is able execute a command by using sudo
-		_, err := run("uname")
+		_, err := utils.Run(executor, "uname")
 		errCh <- err
 	}()
 
@@ -253,8 +271,8 @@ MainLoop:
 				var err error
 				modes, err = uiNetworkPolicySelector(ui, net)
 				if err != nil {
-					switch err.Error() {
-					case gui.DialogMoveBack:
+					switch gui.Navigation(err) {
+					case gui.ErrMoveBack:
 						gconf.Networks = gconf.Networks[:i]
 						gconf.NICLists = gconf.NICLists[:i]
 						portCounter = lastPortCounter - 1
@@ -264,10 +282,10 @@ MainLoop:
 						}
 						i--
 						continue MainLoop
-					case gui.DialogNext:
+					case gui.ErrNext:
 						i++
 						continue MainLoop
-					case gui.DialogExit:
+					case gui.ErrExit:
 						os.Exit(1)
 					default:
 						return err
@@ -289,15 +307,15 @@ MainLoop:
 			}
 			list, err := uiNicSelectMenu(ui, data, &portCounter, &guestPciSlotCounter, retainedNics, net, i)
 			if err != nil {
-				switch err.Error() {
-				case gui.DialogMoveBack:
+				switch gui.Navigation(err) {
+				case gui.ErrMoveBack:
 					if i == 0 {
 						return err
 					}
 					gconf.Networks = gconf.Networks[:i]
 					gconf.NICLists = gconf.NICLists[:i]
 					continue PolicyLoop
-				case gui.DialogExit:
+				case gui.ErrExit:
 					os.Exit(1)
 				}
 			}
@@ -349,7 +367,7 @@ func uiNicSelectMenu(ui *gui.DialogUi, data *xmlinput.XMLInputData, guestPortCou
 		ui.SetTitle(fmt.Sprintf("Select interface for network \"%s\"", net.Name))
 		nicNumStr, err := ui.Menu(listLength+5, list[0:]...)
 		if err != nil {
-			if err.Error() == gui.DialogNext {
+			if gui.Navigation(err) == gui.ErrNext {
 				if len(gnics) == 0 && net.Optional == false {
 					continue
 				}
@@ -672,66 +690,17 @@ func uiRamNotOK(ui *gui.DialogUi, selectedRamInMb, installedRamMb, minRamInMb, m
 }
 
 func UiNumaRamNotOK(ui *gui.DialogUi, driver deployer.HostinfoDriver, c *guest.Config, selectedRamInMb int) (bool, error) {
-	// file, err := os.Create("/tmp/_setNUMATuneData.txt")
-	// defer file.Close()
-
 	numas, err := driver.NUMAInfo()
 	if err != nil {
 		return true, utils.FormatError(err)
 	}
-	NumaForCheck := make([]int, 0)
-	// file.WriteString("uiNumaRamNotOK\n")
-	for _, n := range c.NUMAs {
-		// file.WriteString("c.NUMAs\n")
-		for _, nic := range n.NICs {
-			if nic.HostNIC.Type == host.NicTypePhys || nic.HostNIC.Type == host.NicTypePhysVF {
-				isAdd := true
-				for _, v := range NumaForCheck {
-					if v == nic.HostNIC.NUMANode {
-						isAdd = false
-					}
-				}
-				if isAdd {
-					NumaForCheck = append(NumaForCheck, nic.HostNIC.NUMANode)
-					// file.WriteString("NumaForCheck: [" + strconv.Itoa(nic.HostNIC.NUMANode) + "]\n")
-				}
-			}
-		}
-	}
-	// selectedRamInMb = 1
-	var requiredMemory float64
-	var freeRam float64
-	numberOfNumas := len(NumaForCheck)
-	if numberOfNumas < 1 {
-		numberOfNumas = 1
-	}
-	requiredMemoryMB := selectedRamInMb / numberOfNumas
-	requiredMemory = float64(selectedRamInMb / numberOfNumas)
-	requiredMemoryStr := strconv.FormatFloat((requiredMemory / 1024), 'f', 1, 64)
-	// file.WriteString("requiredMemoryStr: " + requiredMemoryStr + " selectedRamInMb:" + strconv.Itoa(selectedRamInMb) + " \n")
-	for _, node := range numas {
-		for _, CellID := range NumaForCheck {
-			// file.WriteString("CellID: " + strconv.Itoa(CellID) + " node.CellID: " + strconv.Itoa(node.CellID) + "\n")
-			if node.CellID != CellID {
-				continue
-			}
-			numafreeRamMb := node.FreeRAM / 1024
-
-			// file.WriteString("requiredMemoryMB: " + strconv.Itoa(requiredMemoryMB) + " node.FreeRAM:" + strconv.Itoa(numafreeRamMb) + " \n")
-			// numafreeRamMb = 0
-			if numafreeRamMb < requiredMemoryMB {
-				freeRam = float64(node.FreeRAM / (1024 * 1024))
-				freeRamStr := strconv.FormatFloat(freeRam, 'f', 1, 64)
-				ui.SetTitle(gui.Warning)
-				ui.SetSize(10, 80)
-				ui.SetLabel("Virtual machine configuration can not be optimized.\n" + requiredMemoryStr + " GB RAM are required on NUMA " + strconv.Itoa(node.CellID) + " but just " + freeRamStr + "Gb are available\n\nDo you want to continue?")
-				return ui.Yesno(), nil
-			}
-		}
+	if msg := c.NUMARamWarning(numas, selectedRamInMb); msg != "" {
+		ui.SetTitle(gui.Warning)
+		ui.SetSize(10, 80)
+		ui.SetLabel(msg + "\n\nDo you want to continue?")
+		return ui.Yesno(), nil
 	}
-
 	return true, nil
-
 }
 
 func uiDiskNotOK(ui *gui.DialogUi, selectedDiskInMb, minDiskInMb, maxDiskInMb int) bool {
@@ -910,8 +879,8 @@ MainLoop:
 			}
 			break
 		}
-		if err.Error() != gui.DialogNext {
-			// file.WriteString("[UiNUMATopology] err.Error() != gui.DialogNext " + err.Error() + " \n")
+		if gui.Navigation(err) != gui.ErrNext {
+			// file.WriteString("[UiNUMATopology] gui.Navigation(err) != gui.ErrNext " + err.Error() + " \n")
 			return isChanged, err
 		}
 
@@ -1029,7 +998,7 @@ MainLoop:
 			lst = append(lst, "Host CPU(s) : ", "2", "1", cpusStr, "2", "15", "30", "0", "0")
 			r, err := ui.Mixedform(label, false, lst[0:]...)
 			if err != nil {
-				if err.Error() == gui.DialogNext {
+				if gui.Navigation(err) == gui.ErrNext {
 					uiShowNumaTopologyHelpMsg(ui)
 					continue
 				}
@@ -0,0 +1,207 @@
+// Responsible for recording the commands executed during the deployment
+// to a JSON-lines audit log
+
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded by the audit log
+const (
+	OpExec   = "exec"
+	OpUpload = "upload"
+	OpAttach = "sshfs-attach"
+	OpDetach = "sshfs-detach"
+)
+
+// Localhost is the host name recorded for local operations
+const Localhost = "localhost"
+
+// DefaultMaxOutput is the default amount of bytes of stdout/stderr kept in the log
+const DefaultMaxOutput = 4096
+
+const redacted = "******"
+
+// passwordRegexp matches password assignments in command lines and outputs
+var passwordRegexp = regexp.MustCompile(`(?i)((?:password|passwd|pass)\s*[=:]\s*)\S+`)
+
+// Entry represents a single operation
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	User       string    `json:"user"`
+	Sudo       bool      `json:"sudo"`
+	Op         string    `json:"op"`
+	Command    string    `json:"command"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitStatus int       `json:"exit_status"`
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Logger writes the entries to the audit log.
+// A nil Logger is valid and records nothing.
+type Logger struct {
+	// MaxOutput is the amount of bytes of stdout/stderr kept in an entry
+	MaxOutput int
+
+	path    string
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	secrets []string
+}
+
+// Open opens (appends to) the audit log file
+func Open(path string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := NewLogger(f)
+	l.path = path
+	l.closer = f
+	return l, nil
+}
+
+// NewLogger creates a logger writing the entries to w
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{MaxOutput: DefaultMaxOutput, w: w}
+}
+
+// Path returns path to the audit log file (if any)
+func (l *Logger) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// AddSecret registers a string that must never appear in the log
+func (l *Logger) AddSecret(secret string) {
+	if l == nil || secret == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.secrets {
+		if s == secret {
+			return
+		}
+	}
+	l.secrets = append(l.secrets, secret)
+}
+
+// Log writes the entry.
+// Secrets and passwords are redacted, stdout and stderr are truncated.
+func (l *Logger) Log(e *Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := *e
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Command = l.redact(entry.Command)
+	entry.Stdout = l.truncate(l.redact(entry.Stdout))
+	entry.Stderr = l.truncate(l.redact(entry.Stderr))
+	entry.Error = l.redact(entry.Error)
+
+	buf, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.w.Write(append(buf, '\n'))
+	return err
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+func (l *Logger) redact(s string) string {
+	for _, secret := range l.secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	return passwordRegexp.ReplaceAllString(s, "${1}"+redacted)
+}
+
+func (l *Logger) truncate(s string) string {
+	if l.MaxOutput > 0 && len(s) > l.MaxOutput {
+		return s[:l.MaxOutput] + "...[truncated]"
+	}
+	return s
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger *Logger
+)
+
+// SetDefault sets the logger the operations are recorded to.
+// Nil disables the audit.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defaultLogger = l
+	defaultMu.Unlock()
+}
+
+// Default returns the logger the operations are recorded to (nil if disabled)
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// Record writes the entry to the default logger (if any).
+// The duration is calculated from the start time.
+func Record(e *Entry, start time.Time) {
+	l := Default()
+	if l == nil {
+		return
+	}
+	e.Time = start
+	e.DurationMs = int64(time.Since(start) / time.Millisecond)
+	l.Log(e)
+}
+
+var (
+	localUserOnce sync.Once
+	localUser     string
+)
+
+// LocalUser returns name of the user running the deployer
+func LocalUser() string {
+	localUserOnce.Do(func() {
+		if u, err := user.Current(); err == nil {
+			localUser = u.Username
+		} else {
+			localUser = os.Getenv("USER")
+		}
+	})
+	return localUser
+}
+
+// ErrorString returns the error message or an empty string
+func ErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf)
+	l.AddSecret("s3cr3t")
+	err := l.Log(&Entry{
+		Host:    "10.0.0.1",
+		Op:      OpExec,
+		Command: "sshpass -p s3cr3t virsh list; mount -o password=other /mnt",
+		Stderr:  "Password: hunter2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cr3t", "other", "hunter2"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("%q is not redacted: %s", secret, buf.String())
+		}
+	}
+
+	var e Entry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Host != "10.0.0.1" || e.Op != OpExec || e.Time.IsZero() {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestLogTruncatesOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf)
+	l.MaxOutput = 10
+	if err := l.Log(&Entry{Stdout: strings.Repeat("x", 100)}); err != nil {
+		t.Fatal(err)
+	}
+	var e Entry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Stdout != strings.Repeat("x", 10)+"...[truncated]" {
+		t.Fatalf("unexpected stdout %q", e.Stdout)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.AddSecret("secret")
+	if err := l.Log(&Entry{Command: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Error describes a failure: the stage of the deployment and the builder
+// or post-processor it happened in, the host and the command.
+// Fields that are not known are empty; Details collects them along
+// the whole chain of causes.
+// The cause is accessible by errors.Is and errors.As.
+type Error struct {
+	// Stage of the deployment (config, build, post-process)
+	Stage string
+
+	// Source is the Id of the builder or post-processor
+	Source string
+
+	// Host the failure happened on
+	Host string
+
+	// Err is the cause
+	Err error
+
+	// Trace is the location the error was raised at ("func[file:line]")
+	Trace string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprint(e.Err)
+	if e.Source != "" {
+		msg = e.Source + ": " + msg
+	}
+	if e.Trace != "" {
+		msg += "\nTRACE: " + e.Trace
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StageError wraps the error of the given stage of the deployment
+func StageError(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Stage: stage, Err: err, Trace: trace(2)}
+}
+
+// SourceError wraps the error of the given builder or post-processor
+func SourceError(source string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Source: source, Err: err}
+}
+
+// HostError wraps the error that happened on the given host
+func HostError(host string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Host: host, Err: err, Trace: trace(2)}
+}
+
+// trace returns location of the caller
+func trace(skip int) string {
+	pc, fn, line, _ := runtime.Caller(skip)
+	return fmt.Sprintf("%s[%s:%d]", runtime.FuncForPC(pc).Name(), filepath.Base(fn), line)
+}
+
+// ErrorDetails contains the context of a failure collected from
+// the chain of causes (the outermost value wins)
+type ErrorDetails struct {
+	Stage    string `json:"stage,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Command  string `json:"command,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+
+	// Message is the message of the innermost cause (without traces)
+	Message string `json:"message"`
+}
+
+// Details returns the context of the failure or nil if err is nil
+func Details(err error) *ErrorDetails {
+	if err == nil {
+		return nil
+	}
+	d := new(ErrorDetails)
+	walkErrors(err, func(err error) {
+		switch e := err.(type) {
+		case *Error:
+			setOnce(&d.Stage, e.Stage)
+			setOnce(&d.Source, e.Source)
+			setOnce(&d.Host, e.Host)
+		case *ExitError:
+			setOnce(&d.Host, e.Host)
+			if d.Command == "" {
+				d.Command = e.Cmd
+				d.ExitCode = e.ExitCode
+				d.Stderr = e.Stderr
+			}
+		}
+		d.Message = err.Error()
+	})
+	return d
+}
+
+// walkErrors calls fn for every error of the chain, depth first.
+// Only the first branch of errors joining several causes is followed.
+func walkErrors(err error, fn func(error)) {
+	for err != nil {
+		fn(err)
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			errs := u.Unwrap()
+			if len(errs) == 0 {
+				return
+			}
+			err = errs[0]
+		default:
+			return
+		}
+	}
+}
+
+func setOnce(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// Describe formats the error for humans: the context of the failure
+// followed by the message and the trace of every wrapper
+func Describe(err error) string {
+	d := Details(err)
+	if d == nil {
+		return ""
+	}
+	var lines []string
+	if d.Stage != "" {
+		lines = append(lines, "Stage: "+d.Stage)
+	}
+	if d.Source != "" {
+		lines = append(lines, "Source: "+d.Source)
+	}
+	if d.Host != "" {
+		lines = append(lines, "Host: "+d.Host)
+	}
+	if d.Command != "" {
+		lines = append(lines, fmt.Sprintf("Command: %s (exit status %d)", d.Command, d.ExitCode))
+	}
+	lines = append(lines, err.Error())
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	if FormatError(nil) != nil {
+		t.Fatal("nil is supposed to remain nil")
+	}
+	err := FormatError(os.ErrNotExist)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("cause is lost: %v", err)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 2 || lines[0] != os.ErrNotExist.Error() ||
+		!strings.HasPrefix(lines[1], "TRACE: ") || !strings.Contains(lines[1], "errors_test.go") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
+
+func TestDetails(t *testing.T) {
+	if Details(nil) != nil {
+		t.Fatal("no details are expected for nil")
+	}
+	_, err := NewExecutor(nil).Execute(context.Background(), &Command{Cmd: "echo failed >&2; exit 4"})
+	err = HostError("kvm1", StageError("build", SourceError("image", FormatError(err))))
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("exit error is lost: %v", err)
+	}
+	d := Details(err)
+	if d.Stage != "build" || d.Source != "image" || d.Host != "kvm1" {
+		t.Fatalf("unexpected context %+v", d)
+	}
+	if d.ExitCode != 4 || !strings.Contains(d.Command, "exit 4") || strings.TrimSpace(d.Stderr) != "failed" {
+		t.Fatalf("unexpected command %+v", d)
+	}
+	if d.Message != exitErr.Error() {
+		t.Fatalf("unexpected message %q", d.Message)
+	}
+
+	desc := Describe(err)
+	for _, s := range []string{"Stage: build", "Source: image", "Host: kvm1", "exit status 4", "TRACE: "} {
+		if !strings.Contains(desc, s) {
+			t.Fatalf("%q is missing in %q", s, desc)
+		}
+	}
+}
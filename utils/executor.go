@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dorzheh/deployer/utils/audit"
+	sshconf "github.com/dorzheh/infra/comm/common"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Command represents a shell command to be executed
+type Command struct {
+	// Cmd is the command line interpreted by the shell
+	Cmd string
+
+	// Stdin (optional) is connected to the standard input of the command
+	Stdin io.Reader
+
+	// Env contains additional environment variables in the form "key=value"
+	Env []string
+
+	// Timeout limits the execution time. Zero means no limit.
+	Timeout time.Duration
+
+	// Stdout and Stderr (optional) receive the output while the command is running
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Result represents result of a command execution
+type Result struct {
+	// Stdout contains the standard output with leading
+	// and trailing white spaces removed
+	Stdout string
+
+	// Stderr contains the standard error
+	Stderr string
+
+	// ExitCode of the command
+	ExitCode int
+}
+
+// ExitError is returned by executors in case the command has exited with non-zero code
+type ExitError struct {
+	Cmd      string
+	Stderr   string
+	ExitCode int
+
+	// Host the command was executed on (empty for local commands)
+	Host string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("executing %s : %s [exit status %d]", e.Cmd, e.Stderr, e.ExitCode)
+}
+
+// Executor runs commands on local or remote host
+type Executor interface {
+	// Execute runs the command unless the context is done.
+	// The command is killed once the context is done or the timeout is expired.
+	// Returns *ExitError if the command has exited with non-zero code.
+	Execute(context.Context, *Command) (*Result, error)
+}
+
+// NewExecutor returns local executor if config is nil
+// and SSH executor otherwise
+func NewExecutor(config *sshconf.Config) Executor {
+	if config == nil {
+		return new(LocalExecutor)
+	}
+	return &SshExecutor{Config: config}
+}
+
+// Run runs the command line and returns its trimmed standard output
+func Run(e Executor, command string) (string, error) {
+	res, err := e.Execute(context.Background(), &Command{Cmd: command})
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// Stream is like Run but the output of the command (both stdout and stderr)
+// is also written to w while the command is running
+func Stream(e Executor, command string, w io.Writer) (string, error) {
+	res, err := e.Execute(context.Background(), &Command{Cmd: command, Stdout: w, Stderr: w})
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// LocalExecutor runs commands on the local host using bash.
+// The shell is started in its own process group, so once the context
+// is done the whole group (the shell and its children) is killed
+type LocalExecutor struct{}
+
+func (e *LocalExecutor) Execute(ctx context.Context, c *Command) (res *Result, err error) {
+	start := time.Now()
+	defer func() {
+		audit.Record(auditEntry(audit.Localhost, audit.LocalUser(), false, c.Cmd, res, err), start)
+	}()
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var stderr bytes.Buffer
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", c.Cmd)
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = teeWriter(&stdout, c.Stdout)
+	cmd.Stderr = teeWriter(&stderr, c.Stderr)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// don't wait for the processes that left the group holding the output
+	cmd.WaitDelay = time.Second
+	if c.Env != nil {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	err = cmd.Wait()
+	res = &Result{
+		Stdout: strings.TrimSpace(stdout.String()),
+		Stderr: stderr.String(),
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return res, fmt.Errorf("executing %s : %w", c.Cmd, ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return res, fmt.Errorf("executing %s  : %s [%s]", c.Cmd, res.Stderr, err)
+		}
+		res.ExitCode = exitErr.ExitCode()
+		return res, &ExitError{Cmd: c.Cmd, Stderr: res.Stderr, ExitCode: res.ExitCode}
+	}
+	return res, nil
+}
+
+// SshExecutor runs commands on a remote host.
+// The commands are executed by means of sudo unless the user is root
+// (make sure that "Defaults !requiretty" is set in sudoers on remote system).
+type SshExecutor struct {
+	Config *sshconf.Config
+
+	// Pool (optional) provides the connection to the remote host.
+	// DefaultSshPool is used if not set.
+	Pool *SshPool
+}
+
+func (e *SshExecutor) Execute(ctx context.Context, c *Command) (res *Result, err error) {
+	sudo := strings.TrimSpace(e.Config.User) != "root"
+	audit.Default().AddSecret(e.Config.Password)
+	start := time.Now()
+	defer func() {
+		audit.Record(auditEntry(e.Config.Host, e.Config.User, sudo, c.Cmd, res, err), start)
+	}()
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("executing %s : %w", c.Cmd, err)
+	}
+
+	pool := e.Pool
+	if pool == nil {
+		pool = DefaultSshPool
+	}
+	session, release, err := pool.NewSession(e.Config)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer release()
+
+	cmd := c.Cmd
+	if len(c.Env) > 0 {
+		// sshd usually doesn't accept environment passed over the session
+		cmd = "env " + strings.Join(quoteArgs(c.Env), " ") + " " + cmd
+	}
+	if sudo {
+		cmd = "sudo " + cmd
+	}
+
+	var stderr bytes.Buffer
+	var stdout bytes.Buffer
+	session.Stdin = c.Stdin
+	session.Stdout = teeWriter(&stdout, c.Stdout)
+	session.Stderr = teeWriter(&stderr, c.Stderr)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(gossh.SIGKILL)
+		session.Close()
+		return nil, fmt.Errorf("executing %s : %w", cmd, ctx.Err())
+	}
+
+	res = &Result{
+		Stdout: strings.TrimSpace(stdout.String()),
+		Stderr: stderr.String(),
+	}
+	if err != nil {
+		var exitErr *gossh.ExitError
+		if !errors.As(err, &exitErr) {
+			return res, fmt.Errorf("executing %s : %s [%s]", cmd, res.Stderr, err)
+		}
+		res.ExitCode = exitErr.ExitStatus()
+		return res, &ExitError{Cmd: cmd, Stderr: res.Stderr, ExitCode: res.ExitCode, Host: e.Config.Host}
+	}
+	return res, nil
+}
+
+// auditEntry describes the command execution for the audit log
+func auditEntry(host, user string, sudo bool, cmd string, res *Result, err error) *audit.Entry {
+	e := &audit.Entry{
+		Host:    host,
+		User:    user,
+		Sudo:    sudo,
+		Op:      audit.OpExec,
+		Command: cmd,
+		Error:   audit.ErrorString(err),
+	}
+	if res != nil {
+		e.ExitStatus = res.ExitCode
+		e.Stdout = res.Stdout
+		e.Stderr = res.Stderr
+	} else if err != nil {
+		e.ExitStatus = -1
+	}
+	return e
+}
+
+// teeWriter returns a writer duplicating its writes to w (if set)
+func teeWriter(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
+
+// quoteArgs quotes the arguments for passing them to the shell
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return quoted
+}
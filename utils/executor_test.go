@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutor(t *testing.T) {
+	e := NewExecutor(nil)
+	res, err := e.Execute(context.Background(), &Command{
+		Cmd:   "read line; echo $line $GREETING",
+		Stdin: strings.NewReader("hello\n"),
+		Env:   []string{"GREETING=world"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "hello world" {
+		t.Fatalf("unexpected output %q", res.Stdout)
+	}
+
+	_, err = e.Execute(context.Background(), &Command{Cmd: "echo failed >&2; exit 3"})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if exitErr.ExitCode != 3 || strings.TrimSpace(exitErr.Stderr) != "failed" {
+		t.Fatalf("unexpected exit error %+v", exitErr)
+	}
+}
+
+func TestLocalExecutorTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := NewExecutor(nil).Execute(context.Background(), &Command{Cmd: "sleep 10; true", Timeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Fatal("supposed to produce an error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the command is not killed")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestLocalExecutorCancelKillsChildren(t *testing.T) {
+	dir, err := ioutil.TempDir("", "executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if fi, err := os.Stat(pidfile); err == nil && fi.Size() > 0 {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	_, err = NewExecutor(nil).Execute(ctx, &Command{Cmd: "sleep 30 & echo $! > " + pidfile + "; wait"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	fb, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := "/proc/" + strings.TrimSpace(string(fb)) + "/stat"
+	for i := 0; ; i++ {
+		// the killed child is either reaped or a zombie
+		fb, err := ioutil.ReadFile(stat)
+		if err != nil || strings.Contains(string(fb), ") Z ") {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the child of the shell is not killed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecordingExecutor(t *testing.T) {
+	e := &RecordingExecutor{
+		Respond: func(c *Command) (*Result, error) {
+			if c.Cmd == "uname -r" {
+				return &Result{Stdout: "4.4.0"}, nil
+			}
+			return &Result{ExitCode: 1}, &ExitError{Cmd: c.Cmd, ExitCode: 1}
+		},
+	}
+	if out, err := Run(e, "uname -r"); err != nil || out != "4.4.0" {
+		t.Fatalf("unexpected result %q (%v)", out, err)
+	}
+	if _, err := Run(e, "false"); err == nil {
+		t.Fatal("supposed to produce an error")
+	}
+	if !reflect.DeepEqual(e.Commands(), []string{"uname -r", "false"}) {
+		t.Fatalf("unexpected commands %v", e.Commands())
+	}
+}
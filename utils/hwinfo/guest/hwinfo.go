@@ -5,7 +5,7 @@ import (
 	"fmt"
 	// "os"
 	"sort"
-	// "strconv"
+	"strconv"
 
 	"github.com/dorzheh/deployer/builder/image"
 	"github.com/dorzheh/deployer/config/xmlinput"
@@ -263,6 +263,49 @@ func (c *Config) ReconfigureMultipleVirtualNUMAs(numas host.NUMANodes) error {
 	return nil
 }
 
+// NUMARamWarning verifies that NUMA nodes the physical NICs are bound to
+// have enough free memory for the selected amount of RAM.
+// Returns appropriate warning message or empty string
+func (c *Config) NUMARamWarning(numas host.NUMANodes, selectedRamInMb int) string {
+	numaForCheck := make([]int, 0)
+	for _, n := range c.NUMAs {
+		for _, nic := range n.NICs {
+			if nic.HostNIC.Type == host.NicTypePhys || nic.HostNIC.Type == host.NicTypePhysVF {
+				isAdd := true
+				for _, v := range numaForCheck {
+					if v == nic.HostNIC.NUMANode {
+						isAdd = false
+					}
+				}
+				if isAdd {
+					numaForCheck = append(numaForCheck, nic.HostNIC.NUMANode)
+				}
+			}
+		}
+	}
+
+	numberOfNumas := len(numaForCheck)
+	if numberOfNumas < 1 {
+		numberOfNumas = 1
+	}
+	requiredMemoryMB := selectedRamInMb / numberOfNumas
+	requiredMemory := float64(selectedRamInMb / numberOfNumas)
+	requiredMemoryStr := strconv.FormatFloat((requiredMemory / 1024), 'f', 1, 64)
+	for _, node := range numas {
+		for _, cellID := range numaForCheck {
+			if node.CellID != cellID {
+				continue
+			}
+			if node.FreeRAM/1024 < requiredMemoryMB {
+				freeRamStr := strconv.FormatFloat(float64(node.FreeRAM/(1024*1024)), 'f', 1, 64)
+				return "Virtual machine configuration can not be optimized.\n" + requiredMemoryStr +
+					" GB RAM are required on NUMA " + strconv.Itoa(node.CellID) + " but just " + freeRamStr + "Gb are available"
+			}
+		}
+	}
+	return ""
+}
+
 func numaNicsMapping(c *Config, numas host.NUMANodes) (map[int][]*NIC, int) {
 	nicNumaMapping := make(map[int][]*NIC)
 	totalAmountOfPorts := 0
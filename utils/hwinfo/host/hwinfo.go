@@ -16,7 +16,8 @@ import (
 )
 
 type Collector struct {
-	Run        func(string) (string, error)
+	// Executor runs the commands on the host the information is collected from
+	Executor   utils.Executor
 	prepare    func() (string, error)
 	hwinfoFile string
 }
@@ -25,12 +26,17 @@ type Collector struct {
 // The output will be represented in JSON format
 func NewCollector(sshconf *ssh.Config, lshwpath, hwinfoFile string) (*Collector, error) {
 	c := new(Collector)
-	c.Run = utils.RunFunc(sshconf)
+	c.Executor = utils.NewExecutor(sshconf)
 	c.hwinfoFile = hwinfoFile
 	c.prepare = prepareFunc(c, sshconf, lshwpath)
 	return c, nil
 }
 
+// Run runs the command on the host the information is collected from
+func (c *Collector) Run(command string) (string, error) {
+	return utils.Run(c.Executor, command)
+}
+
 // Parse parses lshw output
 func (c *Collector) Hwinfo2Json() error {
 	lshwNewPath, err := c.prepare()
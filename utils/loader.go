@@ -0,0 +1,444 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format represents format of a configuration file
+type Format int
+
+const (
+	FormatXML Format = iota
+	FormatJSON
+	FormatYAML
+)
+
+// ConfigExtensions contains the extensions of the configuration files
+// in the order they are looked up by FindConfigFile
+var ConfigExtensions = []string{".xml", ".yaml", ".yml", ".json"}
+
+// FormatOf returns format of the file according to its extension.
+// Files with ".json" extension are JSON, ".yaml" and ".yml" are YAML,
+// anything else is XML.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatXML
+}
+
+// FindConfigFile returns path to the configuration file of the directory
+// having the given name without extension ("packages" matches packages.xml,
+// packages.yaml and so forth). Returns empty string if there is no such file.
+func FindConfigFile(dir, name string) string {
+	for _, ext := range ConfigExtensions {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadFile reads the configuration file to data (a pointer to the structure
+// the XML is decoded to). The format is chosen by the file extension (see FormatOf).
+func LoadFile(path string, data interface{}) error {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return FormatError(err)
+	}
+	if err := Load(fb, FormatOf(path), data); err != nil {
+		return FormatError(fmt.Errorf("%s: %w", path, err))
+	}
+	return nil
+}
+
+// Load decodes the configuration to data (a pointer to the structure
+// the XML is decoded to).
+// JSON and YAML configurations share the schema of the XML one: an object
+// represents content of the root element, the keys are the names of the
+// elements and the attributes (as given by the xml tags), arrays represent
+// repeated elements and paths like "networks>network" are nested objects.
+func Load(fb []byte, format Format, data interface{}) error {
+	if format == FormatXML {
+		if err := xml.NewDecoder(bytes.NewBuffer(fb)).Decode(data); err != nil {
+			return FormatError(err)
+		}
+		return nil
+	}
+	root, err := parse(fb, format)
+	if err != nil {
+		return FormatError(err)
+	}
+
+	t := reflect.TypeOf(data)
+	buf := new(bytes.Buffer)
+	enc := xml.NewEncoder(buf)
+	if err := encodeNode(enc, rootName(t), root, &schema{t: t}); err != nil {
+		return FormatError(err)
+	}
+	if err := enc.Flush(); err != nil {
+		return FormatError(err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), data); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// node is an element or an attribute of the configuration file
+type node struct {
+	name     string
+	attr     bool
+	text     string
+	children []*node
+	line     int
+	column   int
+}
+
+// parse returns the root element of the configuration
+func parse(fb []byte, format Format) (*node, error) {
+	switch format {
+	case FormatXML:
+		return parseXML(fb)
+	case FormatJSON:
+		return parseJSON(fb)
+	case FormatYAML:
+		return parseYAML(fb)
+	}
+	return nil, fmt.Errorf("unsupported format %d", format)
+}
+
+// positions contains the offsets the lines of the configuration begin at
+type positions []int64
+
+func newPositions(fb []byte) positions {
+	p := positions{0}
+	for i, b := range fb {
+		if b == '\n' {
+			p = append(p, int64(i+1))
+		}
+	}
+	return p
+}
+
+// at returns the line and the column of the offset (starting from 1)
+func (p positions) at(offset int64) (int, int) {
+	line := sort.Search(len(p), func(i int) bool { return p[i] > offset })
+	return line, int(offset-p[line-1]) + 1
+}
+
+func parseXML(fb []byte) (*node, error) {
+	pos := newPositions(fb)
+	dec := xml.NewDecoder(bytes.NewReader(fb))
+	var root *node
+	var stack []*node
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			line, column := pos.at(offset)
+			n := &node{name: t.Name.Local, line: line, column: column}
+			for _, a := range t.Attr {
+				n.children = append(n.children, &node{name: a.Name.Local, attr: true, text: a.Value, line: line, column: column})
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("root element is missing")
+	}
+	return root, nil
+}
+
+// jsonParser builds the elements of JSON configuration
+type jsonParser struct {
+	fb  []byte
+	pos positions
+	dec *json.Decoder
+}
+
+func parseJSON(fb []byte) (*node, error) {
+	p := &jsonParser{fb: fb, pos: newPositions(fb), dec: json.NewDecoder(bytes.NewReader(fb))}
+	p.dec.UseNumber()
+	tok, line, column, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("line %d: configuration is supposed to be an object", line)
+	}
+	root := &node{line: line, column: column}
+	if err := p.object(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// next returns the next token and its position
+func (p *jsonParser) next() (json.Token, int, int, error) {
+	offset := p.dec.InputOffset()
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// skip the separators preceding the token
+	for offset < int64(len(p.fb)) && strings.IndexByte(" \t\r\n,:", p.fb[offset]) >= 0 {
+		offset++
+	}
+	line, column := p.pos.at(offset)
+	return tok, line, column, nil
+}
+
+// object reads the members of the object up to the closing brace
+func (p *jsonParser) object(n *node) error {
+	for p.dec.More() {
+		tok, line, column, err := p.next()
+		if err != nil {
+			return err
+		}
+		children, err := p.value(tok.(string), line, column)
+		if err != nil {
+			return err
+		}
+		n.children = append(n.children, children...)
+	}
+	_, err := p.dec.Token()
+	return err
+}
+
+// value reads the value of the member. Arrays produce an element per item.
+func (p *jsonParser) value(name string, line, column int) ([]*node, error) {
+	tok, tline, tcolumn, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{name: name, line: line, column: column}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return []*node{n}, p.object(n)
+		}
+		var items []*node
+		for p.dec.More() {
+			offset := p.dec.InputOffset()
+			for offset < int64(len(p.fb)) && strings.IndexByte(" \t\r\n,", p.fb[offset]) >= 0 {
+				offset++
+			}
+			iline, icolumn := p.pos.at(offset)
+			item, err := p.value(name, iline, icolumn)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item...)
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+		return items, nil
+	case string:
+		n.text = t
+	case json.Number:
+		n.text = t.String()
+	case bool:
+		n.text = strconv.FormatBool(t)
+	}
+	if line == 0 {
+		n.line, n.column = tline, tcolumn
+	}
+	return []*node{n}, nil
+}
+
+func parseYAML(fb []byte) (*node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(fb, &doc); err != nil {
+		return nil, err
+	}
+	root := &node{line: 1, column: 1}
+	if len(doc.Content) == 0 {
+		return root, nil
+	}
+	y := doc.Content[0]
+	if y.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: configuration is supposed to be a mapping", y.Line)
+	}
+	root.line, root.column = y.Line, y.Column
+	root.children = yamlMapping(y)
+	return root, nil
+}
+
+// yamlMapping returns the elements of the mapping
+func yamlMapping(y *yaml.Node) []*node {
+	var children []*node
+	for i := 0; i+1 < len(y.Content); i += 2 {
+		k := y.Content[i]
+		children = append(children, yamlNodes(k.Value, y.Content[i+1], k.Line, k.Column)...)
+	}
+	return children
+}
+
+// yamlNodes returns the elements of the value. Sequences produce an element per item.
+func yamlNodes(name string, y *yaml.Node, line, column int) []*node {
+	for y.Kind == yaml.AliasNode {
+		y = y.Alias
+	}
+	switch y.Kind {
+	case yaml.SequenceNode:
+		var items []*node
+		for _, item := range y.Content {
+			items = append(items, yamlNodes(name, item, item.Line, item.Column)...)
+		}
+		return items
+	case yaml.MappingNode:
+		return []*node{{name: name, children: yamlMapping(y), line: line, column: column}}
+	}
+	n := &node{name: name, line: line, column: column}
+	if y.Tag != "!!null" {
+		n.text = y.Value
+	}
+	return []*node{n}
+}
+
+// schema describes the element being encoded: the type it is decoded to,
+// the validation rules of the field (see Validate) and, inside "a>b" paths,
+// the path elements passed so far
+type schema struct {
+	t     reflect.Type
+	rules string
+	path  []string
+}
+
+// indirect returns the type the pointers and the slices refer to
+func indirect(t reflect.Type) reflect.Type {
+	for t != nil && (t.Kind() == reflect.Ptr || (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8)) {
+		t = t.Elem()
+	}
+	return t
+}
+
+// rootName returns name of the root element of the type
+func rootName(t reflect.Type) string {
+	t = indirect(t)
+	if t != nil && t.Kind() == reflect.Struct {
+		if f, ok := t.FieldByName("XMLName"); ok {
+			if name := strings.Split(f.Tag.Get("xml"), ",")[0]; name != "" {
+				return name
+			}
+		}
+		return t.Name()
+	}
+	return "config"
+}
+
+// child returns the schema of the child element or attribute by name.
+// Returns nil if the name is unknown.
+func (s *schema) child(name string) (child *schema, attr bool) {
+	if s == nil {
+		return nil, false
+	}
+	t := indirect(s.t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	path := append(append([]string(nil), s.path...), name)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Name == "XMLName" {
+			continue
+		}
+		tag := f.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		if f.Anonymous && opts[0] == "" {
+			if c, a := (&schema{t: f.Type, path: s.path}).child(name); c != nil {
+				return c, a
+			}
+			continue
+		}
+		fieldPath := []string{f.Name}
+		if opts[0] != "" {
+			fieldPath = strings.Split(opts[0], ">")
+		}
+		if len(path) > len(fieldPath) || !reflect.DeepEqual(fieldPath[:len(path)], path) {
+			continue
+		}
+		if len(path) < len(fieldPath) {
+			return &schema{t: s.t, path: path}, false
+		}
+		c := &schema{t: f.Type, rules: f.Tag.Get("validate")}
+		for _, o := range opts[1:] {
+			if o == "attr" {
+				return c, true
+			}
+		}
+		return c, false
+	}
+	return nil, false
+}
+
+// encodeNode writes the element. Children known as attributes of
+// the schema become attributes.
+func encodeNode(enc *xml.Encoder, name string, n *node, s *schema) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	var elems []*node
+	for _, c := range n.children {
+		if _, attr := s.child(c.name); attr {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: c.name}, Value: c.text})
+		} else {
+			elems = append(elems, c)
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if n.text != "" {
+		if err := enc.EncodeToken(xml.CharData(n.text)); err != nil {
+			return err
+		}
+	}
+	for _, c := range elems {
+		cs, _ := s.child(c.name)
+		if err := encodeNode(enc, c.name, c, cs); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
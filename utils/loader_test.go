@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type loaderNic struct {
+	Name   string `xml:"name,attr"`
+	Vendor string `xml:"vendor"`
+	Model  string `xml:"model"`
+}
+
+type loaderConfig struct {
+	XMLName   xml.Name    `xml:"config"`
+	Version   string      `xml:"version,attr"`
+	Name      string      `xml:"name"`
+	Cpus      int         `xml:"cpus"`
+	Configure bool        `xml:"networks>configure"`
+	Nics      []loaderNic `xml:"networks>nic"`
+	Tags      []string    `xml:"tags>tag"`
+}
+
+var loaderXML = `
+<config version="2">
+  <name>va</name>
+  <cpus>4</cpus>
+  <networks>
+    <configure>true</configure>
+    <nic name="eth0"><vendor>0x8086</vendor><model>0x10fb</model></nic>
+    <nic name="eth1"><vendor>0x15b3</vendor></nic>
+  </networks>
+  <tags><tag>a</tag><tag>b</tag></tags>
+</config>`
+
+var loaderYAML = `
+version: 2
+name: va
+cpus: 4
+networks:
+  configure: true
+  nic:
+    - name: eth0
+      vendor: "0x8086"
+      model: "0x10fb"
+    - name: eth1
+      vendor: "0x15b3"
+tags:
+  tag: [a, b]
+`
+
+var loaderJSON = `{
+  "version": 2,
+  "name": "va",
+  "cpus": 4,
+  "networks": {
+    "configure": true,
+    "nic": [
+      {"name": "eth0", "vendor": "0x8086", "model": "0x10fb"},
+      {"name": "eth1", "vendor": "0x15b3"}
+    ]
+  },
+  "tags": {"tag": ["a", "b"]}
+}`
+
+func TestLoad(t *testing.T) {
+	expected := new(loaderConfig)
+	if err := Load([]byte(loaderXML), FormatXML, expected); err != nil {
+		t.Fatal(err)
+	}
+	if expected.Version != "2" || len(expected.Nics) != 2 || !expected.Configure {
+		t.Fatalf("unexpected XML config %+v", expected)
+	}
+	for format, data := range map[Format]string{FormatYAML: loaderYAML, FormatJSON: loaderJSON} {
+		c := new(loaderConfig)
+		if err := Load([]byte(data), format, c); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, expected) {
+			t.Fatalf("format %d: expected %+v, got %+v", format, expected, c)
+		}
+	}
+	if err := Load([]byte("cpus: [1"), FormatYAML, new(loaderConfig)); err == nil {
+		t.Fatal("bad YAML is supposed to produce an error")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if FindConfigFile(dir, "config") != "" {
+		t.Fatal("no configuration file is expected")
+	}
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(loaderYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if found := FindConfigFile(dir, "config"); found != path {
+		t.Fatalf("unexpected configuration file %q", found)
+	}
+	c := new(loaderConfig)
+	if err := LoadFile(path, c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "va" || c.Cpus != 4 || len(c.Tags) != 2 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	if FormatOf("a.JSON") != FormatJSON || FormatOf("a.yaml") != FormatYAML || FormatOf("a") != FormatXML {
+		t.Fatal("unexpected format")
+	}
+}
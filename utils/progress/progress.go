@@ -0,0 +1,180 @@
+// Delivers structured progress events emitted by builders and post-processors
+// to a front-end (dialog based UI or any other consumer).
+
+package progress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Unknown is used as a percent value when the progress of a stage cannot be measured
+const Unknown = -1
+
+// Event represents a progress of a single stage
+type Event struct {
+	// Source is the Id of the builder or post-processor
+	Source string
+
+	// Stage is the name of the stage (mkfs, convert and so forth)
+	Stage string
+
+	// Percent is the progress of the stage or Unknown
+	Percent int
+
+	// Bytes is the amount of bytes written by the stage so far
+	Bytes int64
+
+	// Command is the command currently executed
+	Command string
+}
+
+// Reporter forwards events to a channel.
+// A nil Reporter discards the events
+type Reporter struct {
+	source string
+	ch     chan<- Event
+	done   <-chan struct{}
+}
+
+// NewReporter creates a reporter sending events to the channel.
+// Sending is blocked until the event is received or the done channel is closed
+func NewReporter(ch chan<- Event, done <-chan struct{}) *Reporter {
+	return &Reporter{ch: ch, done: done}
+}
+
+// WithSource returns a copy of the reporter setting the source of the events
+func (r *Reporter) WithSource(source string) *Reporter {
+	if r == nil {
+		return nil
+	}
+	return &Reporter{source, r.ch, r.done}
+}
+
+// Report sends the event
+func (r *Reporter) Report(e Event) {
+	if r == nil {
+		return
+	}
+	if e.Source == "" {
+		e.Source = r.source
+	}
+	select {
+	case r.ch <- e:
+	case <-r.done:
+	}
+}
+
+// Stage reports start of a stage which progress is unknown
+func (r *Reporter) Stage(stage, command string) {
+	r.Report(Event{Stage: stage, Percent: Unknown, Command: command})
+}
+
+// Writer returns a writer parsing the output of the command
+// and reporting the progress found in the output (see ParseLine)
+func (r *Reporter) Writer(stage, command string) io.Writer {
+	if r == nil {
+		return ioutil.Discard
+	}
+	r.Stage(stage, command)
+	return &lineWriter{r: r, stage: stage, command: command}
+}
+
+// lineWriter splits the output by "\r", "\n" or "\b"
+// (mkfs overwrites its counters by backspaces)
+type lineWriter struct {
+	sync.Mutex
+	r       *Reporter
+	stage   string
+	command string
+	buf     []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n\b")
+		if i < 0 {
+			break
+		}
+		line := string(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		if percent, bytes, ok := ParseLine(line); ok {
+			w.r.Report(Event{Stage: w.stage, Percent: percent, Bytes: bytes, Command: w.command})
+		}
+	}
+	return len(p), nil
+}
+
+var (
+	// qemu-img -p: "    (45.01/100%)"
+	qemuImgRegexp = regexp.MustCompile(`\((\d+(?:\.\d+)?)/100%\)`)
+	// unsquashfs, pv, rsync: "[====  ] 1234/5678  45%"
+	percentRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+	// dd status=progress: "1048576 bytes (1.0 MB, 1.0 MiB) copied"
+	ddRegexp = regexp.MustCompile(`^\s*(\d+) bytes`)
+	// mkfs: "Writing inode tables:  3/16"
+	fractionRegexp = regexp.MustCompile(`(\d+)/(\d+)\s*$`)
+	// unsquashfs -percentage: "45"
+	numberRegexp = regexp.MustCompile(`^\s*(\d{1,3})\s*$`)
+)
+
+// ParseLine looks for progress information in a line printed by
+// qemu-img, dd, mkfs, unsquashfs and similar utilities.
+// A line containing a number only is treated as percent.
+// Returns percent (or Unknown), amount of bytes and false
+// if the line doesn't contain any progress information
+func ParseLine(line string) (int, int64, bool) {
+	if m := qemuImgRegexp.FindStringSubmatch(line); m != nil {
+		return parsePercent(m[1]), 0, true
+	}
+	if m := percentRegexp.FindStringSubmatch(line); m != nil {
+		return parsePercent(m[1]), 0, true
+	}
+	if m := ddRegexp.FindStringSubmatch(line); m != nil {
+		bytes, _ := strconv.ParseInt(m[1], 10, 64)
+		return Unknown, bytes, true
+	}
+	if m := numberRegexp.FindStringSubmatch(line); m != nil {
+		if percent := parsePercent(m[1]); percent <= 100 {
+			return percent, 0, true
+		}
+	}
+	if m := fractionRegexp.FindStringSubmatch(line); m != nil {
+		done, _ := strconv.Atoi(m[1])
+		total, _ := strconv.Atoi(m[2])
+		if total > 0 && done <= total {
+			return done * 100 / total, 0, true
+		}
+	}
+	return Unknown, 0, false
+}
+
+func parsePercent(s string) int {
+	f, _ := strconv.ParseFloat(s, 64)
+	if f > 100 {
+		f = 100
+	}
+	return int(f)
+}
+
+type reporterKey struct{}
+
+// NewContext returns a copy of the context carrying the reporter
+func NewContext(ctx context.Context, r *Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// FromContext returns the reporter carried by the context or nil
+func FromContext(ctx context.Context) *Reporter {
+	r, _ := ctx.Value(reporterKey{}).(*Reporter)
+	return r
+}
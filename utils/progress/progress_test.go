@@ -0,0 +1,43 @@
+package progress
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	for line, expected := range map[string][2]int64{
+		"    (45.01/100%)":                                      {45, 0},
+		"[=======-       ] 1234/5678  21%":                      {21, 0},
+		"1048576 bytes (1.0 MB, 1.0 MiB) copied, 1 s, 1.0 MB/s": {Unknown, 1048576},
+		"Writing inode tables:  4/16":                           {25, 0},
+		"57":                                                    {57, 0},
+	} {
+		percent, bytes, ok := ParseLine(line)
+		if !ok || int64(percent) != expected[0] || bytes != expected[1] {
+			t.Fatalf("%q: unexpected result %d %d %v", line, percent, bytes, ok)
+		}
+	}
+	if _, _, ok := ParseLine("Creating journal (4096 blocks): done"); ok {
+		t.Fatal("the line doesn't contain progress information")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	ch := make(chan Event, 10)
+	r := NewReporter(ch, nil).WithSource("LocalImageBuilder")
+	w := r.Writer("convert", "qemu-img convert -p")
+	fmt.Fprint(w, "    (0.00/100%)\r    (50.00/100%)\r    (100.00/100%)\n")
+	close(ch)
+
+	var events []Event
+	for e := range ch {
+		events = append(events, e)
+	}
+	if len(events) != 4 {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if events[0].Percent != Unknown || events[2].Percent != 50 || events[3].Source != "LocalImageBuilder" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// RecordingExecutor records the commands instead of executing them.
+// Intended for testing code that depends on Executor.
+type RecordingExecutor struct {
+	mu       sync.Mutex
+	commands []string
+
+	// Respond (optional) provides the result of the command.
+	// By default the commands succeed producing no output.
+	Respond func(*Command) (*Result, error)
+}
+
+func (e *RecordingExecutor) Execute(ctx context.Context, c *Command) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.commands = append(e.commands, c.Cmd)
+	e.mu.Unlock()
+
+	if e.Respond == nil {
+		return new(Result), nil
+	}
+	res, err := e.Respond(c)
+	if res == nil {
+		res = new(Result)
+	}
+	if c.Stdout != nil {
+		io.WriteString(c.Stdout, res.Stdout)
+	}
+	return res, err
+}
+
+// Commands returns the commands executed so far
+func (e *RecordingExecutor) Commands() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.commands...)
+}
@@ -1,53 +1,30 @@
 package utils
 
 import (
-	"bytes"
-	"fmt"
-	"os/exec"
-	"strings"
+	"io"
 
 	sshconf "github.com/dorzheh/infra/comm/common"
-	"github.com/dorzheh/infra/comm/ssh"
 )
 
 // RunFunc is a generic solution for running appropriate commands
-// on local or remote host
+// on local or remote host.
+//
+// Deprecated: use NewExecutor and Run instead.
 func RunFunc(config *sshconf.Config) func(string) (string, error) {
-	if config == nil {
-		return func(command string) (string, error) {
-			var stderr bytes.Buffer
-			var stdout bytes.Buffer
-			c := exec.Command("/bin/bash", "-c", command)
-			c.Stderr = &stderr
-			c.Stdout = &stdout
-			if err := c.Start(); err != nil {
-				return "", FormatError(err)
-			}
-			if err := c.Wait(); err != nil {
-				return "", fmt.Errorf("executing %s  : %s [%s]", command, stderr.String(), err)
-			}
-			return strings.TrimSpace(stdout.String()), nil
-		}
-	}
+	e := NewExecutor(config)
 	return func(command string) (string, error) {
-		c, err := ssh.NewSshConn(config)
-		if err != nil {
-			return "", FormatError(err)
-		}
-		defer c.ConnClose()
-
-		var cmd string
-		if strings.TrimSpace(config.User) == "root" {
-			cmd = command
-		} else {
-			//IMPORTANT! Make sure that "Defaults !requiretty" is set in sudoers on remote system
-			cmd = "sudo " + command
-		}
+		return Run(e, command)
+	}
+}
 
-		outstr, errstr, err := c.Run(cmd)
-		if err != nil {
-			return "", fmt.Errorf("executing %s : %s [%s]", cmd, errstr, err)
-		}
-		return strings.TrimSpace(outstr), nil
+// RunStreamFunc is like RunFunc but the output of the command (both stdout and stderr)
+// is also written to the given writer while the command is running.
+// Intended for commands reporting their progress (qemu-img -p, dd status=progress and so forth).
+//
+// Deprecated: use NewExecutor and Stream instead.
+func RunStreamFunc(config *sshconf.Config) func(string, io.Writer) (string, error) {
+	e := NewExecutor(config)
+	return func(command string, w io.Writer) (string, error) {
+		return Stream(e, command, w)
 	}
 }
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dorzheh/deployer/utils/audit"
+	sshconf "github.com/dorzheh/infra/comm/common"
+	"github.com/dorzheh/infra/comm/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultSshPool is shared by the remote executors not having their own pool
+var DefaultSshPool = NewSshPool()
+
+// SshPool keeps a single SSH connection per remote host and user
+// and multiplexes the sessions of all the remote commands over it.
+// Broken connections are re-established on demand.
+// The pool remains usable after Close: the next session opens a new connection.
+type SshPool struct {
+	// KeepAlive is the interval the keepalive requests are sent at.
+	// Zero disables keepalives.
+	KeepAlive time.Duration
+
+	// MaxSessions limits the amount of sessions opened over a connection
+	// simultaneously (sshd allows 10 by default). Zero means no limit.
+	MaxSessions int
+
+	mu    sync.Mutex
+	conns map[string]*pooledConn
+}
+
+type pooledConn struct {
+	client *gossh.Client
+	slots  chan struct{}
+	done   chan struct{}
+}
+
+// NewSshPool creates a pool with the default settings
+func NewSshPool() *SshPool {
+	return &SshPool{
+		KeepAlive:   30 * time.Second,
+		MaxSessions: 10,
+		conns:       make(map[string]*pooledConn),
+	}
+}
+
+// NewSession opens a session on the connection to the host described by config.
+// A broken connection is re-established once.
+// The returned function must be called once the session is not needed anymore.
+func (p *SshPool) NewSession(config *sshconf.Config) (*gossh.Session, func(), error) {
+	for attempt := 0; ; attempt++ {
+		c, err := p.conn(config)
+		if err != nil {
+			return nil, nil, FormatError(err)
+		}
+		if c.slots != nil {
+			c.slots <- struct{}{}
+		}
+		release := func() {
+			if c.slots != nil {
+				<-c.slots
+			}
+		}
+
+		session, err := c.client.NewSession()
+		if err == nil {
+			return session, func() {
+				session.Close()
+				release()
+			}, nil
+		}
+		release()
+
+		var rejected *gossh.OpenChannelError
+		if errors.As(err, &rejected) || attempt > 0 {
+			return nil, nil, FormatError(err)
+		}
+		// the connection is broken
+		p.drop(config, c)
+	}
+}
+
+// Close closes all the connections
+func (p *SshPool) Close() error {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*pooledConn)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, c := range conns {
+		close(c.done)
+		if err := c.client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func poolKey(config *sshconf.Config) string {
+	return fmt.Sprintf("%s@%s:%s", config.User, config.Host, config.Port)
+}
+
+// conn returns the connection to the host, establishing it if needed
+func (p *SshPool) conn(config *sshconf.Config) (*pooledConn, error) {
+	key := poolKey(config)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conns == nil {
+		p.conns = make(map[string]*pooledConn)
+	}
+	if c, ok := p.conns[key]; ok {
+		return c, nil
+	}
+
+	sc, err := ssh.NewSshConn(config)
+	if err != nil {
+		return nil, err
+	}
+	c := &pooledConn{
+		client: sc.Client,
+		done:   make(chan struct{}),
+	}
+	if p.MaxSessions > 0 {
+		c.slots = make(chan struct{}, p.MaxSessions)
+	}
+	p.conns[key] = c
+
+	go func() {
+		// forget the connection once it is closed by the peer
+		c.client.Wait()
+		p.drop(config, c)
+	}()
+	if p.KeepAlive > 0 {
+		go p.keepAlive(config, c)
+	}
+	return c, nil
+}
+
+// drop closes the connection and removes it from the pool
+func (p *SshPool) drop(config *sshconf.Config, c *pooledConn) {
+	key := poolKey(config)
+	p.mu.Lock()
+	if p.conns[key] == c {
+		delete(p.conns, key)
+		close(c.done)
+	}
+	p.mu.Unlock()
+	c.client.Close()
+}
+
+// keepAlive sends keepalive requests until the connection is dropped
+func (p *SshPool) keepAlive(config *sshconf.Config, c *pooledConn) {
+	t := time.NewTicker(p.KeepAlive)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-t.C:
+			if _, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				p.drop(config, c)
+				return
+			}
+		}
+	}
+}
+
+// Run runs the command on the remote host as is (without sudo).
+// Returns the standard output and the standard error of the command
+func (p *SshPool) Run(config *sshconf.Config, cmd string) (stdout string, stderr string, err error) {
+	start := time.Now()
+	defer func() {
+		res := &Result{Stdout: stdout, Stderr: stderr, ExitCode: exitStatus(err)}
+		audit.Record(auditEntry(config.Host, config.User, false, cmd, res, err), start)
+	}()
+
+	session, release, err := p.NewSession(config)
+	if err != nil {
+		return "", "", err
+	}
+	defer release()
+
+	var outBuf bytes.Buffer
+	var errBuf bytes.Buffer
+	session.Stdout = &outBuf
+	session.Stderr = &errBuf
+	if err := session.Run(cmd); err != nil {
+		return "", errBuf.String(), err
+	}
+	return outBuf.String(), "", nil
+}
+
+// Upload copies the local file to the remote host by means of scp
+func (p *SshPool) Upload(config *sshconf.Config, src, dst string) (err error) {
+	start := time.Now()
+	defer func() {
+		audit.Record(&audit.Entry{
+			Host:       config.Host,
+			User:       config.User,
+			Op:         audit.OpUpload,
+			Command:    "scp " + src + " " + dst,
+			ExitStatus: exitStatus(err),
+			Error:      audit.ErrorString(err),
+		}, start)
+	}()
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		return FormatError(err)
+	}
+	fd, err := os.Open(src)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer fd.Close()
+
+	session, release, err := p.NewSession(config)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer release()
+
+	w, err := session.StdinPipe()
+	if err != nil {
+		return FormatError(err)
+	}
+	go func() {
+		defer w.Close()
+		fmt.Fprintln(w, "C0644", stat.Size(), filepath.Base(dst))
+		io.Copy(w, fd)
+		fmt.Fprint(w, "\x00")
+	}()
+	if err := session.Run("scp  -qrt " + filepath.Dir(dst)); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// exitStatus returns exit status of the remote command
+// or -1 if the command has not been run
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *gossh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+
+	sshconf "github.com/dorzheh/infra/comm/common"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshServer accepts connections and answers every exec request
+// with the command line itself
+type sshServer struct {
+	listener net.Listener
+	config   *gossh.ServerConfig
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newSshServer(t *testing.T) *sshServer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &gossh.ServerConfig{
+		PasswordCallback: func(gossh.ConnMetadata, []byte) (*gossh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sshServer{listener: l, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *sshServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *sshServer) handle(c net.Conn) {
+	_, chans, reqs, err := gossh.NewServerConn(c, s.config)
+	if err != nil {
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	for nc := range chans {
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				cmd := req.Payload[4 : 4+binary.BigEndian.Uint32(req.Payload)]
+				ch.Write(cmd)
+				ch.SendRequest("exit-status", false, []byte{0, 0, 0, 0})
+				return
+			}
+		}()
+	}
+}
+
+// dropConnections closes connections on the server side
+func (s *sshServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *sshServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *sshServer) sshConfig() *sshconf.Config {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return &sshconf.Config{Host: host, Port: port, User: "root", Password: "secret"}
+}
+
+func TestSshPoolReusesConnection(t *testing.T) {
+	s := newSshServer(t)
+	defer s.listener.Close()
+
+	pool := NewSshPool()
+	defer pool.Close()
+	e := &SshExecutor{Config: s.sshConfig(), Pool: pool}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := Run(e, "uname"); err != nil || out != "uname" {
+				t.Errorf("unexpected result %q (%v)", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := s.connections(); n != 1 {
+		t.Fatalf("%d connections established", n)
+	}
+}
+
+func TestSshPoolReconnects(t *testing.T) {
+	s := newSshServer(t)
+	defer s.listener.Close()
+
+	pool := NewSshPool()
+	e := &SshExecutor{Config: s.sshConfig(), Pool: pool}
+	if _, err := Run(e, "uname"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.dropConnections()
+	if _, err := Run(e, "uname"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool is usable after Close
+	if _, err := Run(e, "uname"); err != nil {
+		t.Fatal(err)
+	}
+	pool.Close()
+	if n := s.connections(); n != 3 {
+		t.Fatalf("%d connections established", n)
+	}
+}
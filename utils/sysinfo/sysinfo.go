@@ -12,17 +12,20 @@ import (
 )
 
 type Collector struct {
-	run func(string) (string, error)
+	executor utils.Executor
 }
 
 func NewCollector(config *ssh.Config) *Collector {
-	c := new(Collector)
-	c.run = utils.RunFunc(config)
-	return c
+	return NewCollectorWithExecutor(utils.NewExecutor(config))
+}
+
+// NewCollectorWithExecutor creates a collector running the commands by means of the executor
+func NewCollectorWithExecutor(e utils.Executor) *Collector {
+	return &Collector{executor: e}
 }
 
 func (c *Collector) KernelVersion() (string, error) {
-	return c.run("uname -r")
+	return utils.Run(c.executor, "uname -r")
 }
 
 func (c *Collector) KernelMajorMinorEqualOrGreaterThan(other string) bool {
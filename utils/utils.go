@@ -4,16 +4,13 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	sshconf "github.com/dorzheh/infra/comm/common"
-	"github.com/dorzheh/infra/comm/ssh"
 )
 
 // ProcessTemplate is responsible for writing appapropriate user data to any metadata
@@ -47,14 +44,9 @@ func WaitForResult(ch <-chan error, num int) error {
 // UploadBinaries is intended to create a temporary directory on a remote server,
 // upload binaries to the temporary location and return path to the directory.
 // The tempoary directory will be removed before the program exits
+// The connection is taken from DefaultSshPool.
 func UploadBinaries(conf *sshconf.Config, pathbins ...string) (string, error) {
-	c, err := ssh.NewSshConn(conf)
-	if err != nil {
-		return "", FormatError(err)
-	}
-	defer c.ConnClose()
-
-	dir, errout, err := c.Run("mktemp -d --suffix _deployer_bin")
+	dir, errout, err := DefaultSshPool.Run(conf, "mktemp -d --suffix _deployer_bin")
 	if err != nil {
 		return "", FormatError(fmt.Errorf("%s [%v]", errout, err))
 	}
@@ -63,22 +55,24 @@ func UploadBinaries(conf *sshconf.Config, pathbins ...string) (string, error) {
 
 	for _, src := range pathbins {
 		dst := filepath.Join(dir, filepath.Base(src))
-		if err := c.Upload(src, dst); err != nil {
+		if err := DefaultSshPool.Upload(conf, src, dst); err != nil {
 			return "", FormatError(err)
 		}
-		if _, errout, err := c.Run("chmod 755 " + dst); err != nil {
+		if _, errout, err := DefaultSshPool.Run(conf, "chmod 755 "+dst); err != nil {
 			return "", FormatError(fmt.Errorf("%s [%v]", errout, err))
 		}
 	}
 	return dir, nil
 }
 
+// ParseXMLFile decodes the configuration file to data and returns data.
+//
+// Deprecated: use LoadFile, which also handles YAML and JSON files.
 func ParseXMLFile(xmlpath string, data interface{}) (interface{}, error) {
-	fb, err := ioutil.ReadFile(xmlpath)
-	if err != nil {
-		return nil, FormatError(err)
+	if err := LoadFile(xmlpath, data); err != nil {
+		return nil, err
 	}
-	return ParseXMLBuff(fb, data)
+	return data, nil
 }
 
 func ParseXMLBuff(fb []byte, data interface{}) (interface{}, error) {
@@ -90,9 +84,14 @@ func ParseXMLBuff(fb []byte, data interface{}) (interface{}, error) {
 	return data, nil
 }
 
+// FormatError wraps the error recording the location it is raised at.
+// The location is printed as a TRACE line following the message
+// and the error remains accessible by errors.Is and errors.As.
 func FormatError(err error) error {
-	pc, fn, line, _ := runtime.Caller(1)
-	return fmt.Errorf("%v\nTRACE: %s[%s:%d]", err, runtime.FuncForPC(pc).Name(), filepath.Base(fn), line)
+	if err == nil {
+		return nil
+	}
+	return &Error{Err: err, Trace: trace(2)}
 }
 
 func IntToHexString(number int) string {
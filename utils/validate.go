@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError describes a problem of the configuration file
+type ValidationError struct {
+	File   string
+	Line   int
+	Column int
+
+	// Path of the element ("storage/config/disk/size_mb")
+	Path string
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if e.File != "" {
+		parts = append(parts, e.File)
+	}
+	if e.Line > 0 {
+		parts = append(parts, fmt.Sprintf("%d:%d", e.Line, e.Column))
+	}
+	loc := strings.Join(parts, ":")
+	if e.Path != "" {
+		loc = strings.TrimPrefix(loc+": "+e.Path, ": ")
+	}
+	return strings.TrimPrefix(loc+": "+e.Msg, ": ")
+}
+
+// ValidationErrors contains all the problems of the configuration file
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateFile validates the configuration file (see Validate).
+// The format is chosen by the file extension (see FormatOf).
+func ValidateFile(path string, data interface{}) error {
+	fb, err := ioutil.ReadFile(path)
+	if err != nil {
+		return FormatError(err)
+	}
+	err = Validate(fb, FormatOf(path), data)
+	if errs, ok := err.(ValidationErrors); ok {
+		for _, e := range errs {
+			e.File = path
+		}
+	}
+	return err
+}
+
+// Validate checks the configuration against the structure it is decoded to
+// (data is a pointer to the structure, its value is not used).
+// Unlike decoding, it reports unknown elements and attributes, repeated
+// elements, values that don't fit the type of the field and violations
+// of the rules given by the validate tags of the fields:
+//
+//	required      the element (or the attribute) must be present
+//	min=N, max=N  the number must be in the range
+//	oneof=a b c   the value must be one of the listed
+//
+// For example:
+//
+//	SizeMb int `xml:"size_mb" validate:"required,min=1"`
+//
+// Returns ValidationErrors locating every problem by line and column.
+func Validate(fb []byte, format Format, data interface{}) error {
+	root, err := parse(fb, format)
+	if err != nil {
+		return ValidationErrors{syntaxError(fb, err)}
+	}
+
+	t := reflect.TypeOf(data)
+	v := &validator{xml: format == FormatXML}
+	name := rootName(t)
+	if format == FormatXML {
+		if rt := indirect(t); rt != nil && rt.Kind() == reflect.Struct {
+			if f, ok := rt.FieldByName("XMLName"); ok && f.Tag.Get("xml") != "" && root.name != name {
+				v.errorf(root, root.name, "unexpected root element, expected <%s>", name)
+			}
+		}
+		name = root.name
+	}
+	v.element(root, name, &schema{t: t})
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// syntaxError locates the error of the parser
+func syntaxError(fb []byte, err error) *ValidationError {
+	e := &ValidationError{Msg: err.Error()}
+	switch serr := err.(type) {
+	case *xml.SyntaxError:
+		e.Line, e.Msg = serr.Line, serr.Msg
+	case *json.SyntaxError:
+		e.Line, e.Column = newPositions(fb).at(serr.Offset)
+	default:
+		if m := yamlLine.FindStringSubmatch(e.Msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+		}
+	}
+	if e.Line > 0 && e.Column == 0 {
+		e.Column = 1
+	}
+	return e
+}
+
+// validator collects the problems of the configuration
+type validator struct {
+	xml  bool
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(n *node, path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Line: n.line, Column: n.column, Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// element validates the children of the element
+func (v *validator) element(n *node, path string, s *schema) {
+	seen := make(map[string]bool)
+	for _, c := range n.children {
+		cpath := path + "/" + c.name
+		cs, attr := s.child(c.name)
+		if cs == nil || (v.xml && c.attr != attr) {
+			kind := "element"
+			if c.attr {
+				kind = "attribute"
+			}
+			v.errorf(c, cpath, "unknown %s", kind)
+			continue
+		}
+		if cs.path != nil {
+			v.element(c, cpath, cs)
+			continue
+		}
+		if seen[c.name] && indirectPtr(cs.t).Kind() != reflect.Slice {
+			v.errorf(c, cpath, "element is repeated")
+		}
+		seen[c.name] = true
+		v.value(c, cpath, cs)
+	}
+	if s.path == nil {
+		v.required(n, path, s.t)
+	}
+}
+
+// required reports the required fields missing in the element
+func (v *validator) required(n *node, path string, t reflect.Type) {
+	t = indirect(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Name == "XMLName" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("xml"), ",")[0]
+		if f.Anonymous && name == "" {
+			v.required(n, path, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if hasRule(f.Tag.Get("validate"), "required") && !present(n, strings.Split(name, ">")) {
+			v.errorf(n, path, "%s is required", strings.Replace(name, ">", "/", -1))
+		}
+	}
+}
+
+// present returns true if the element contains the path
+func present(n *node, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	for _, c := range n.children {
+		if c.name == path[0] && present(c, path[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// value validates the element (or the attribute) decoded to the field
+func (v *validator) value(n *node, path string, s *schema) {
+	t := indirect(s.t)
+	if t.Kind() == reflect.Struct {
+		if len(n.children) == 0 && strings.TrimSpace(n.text) != "" {
+			v.errorf(n, path, "unexpected value %q, expected nested elements", strings.TrimSpace(n.text))
+			return
+		}
+		v.element(n, path, s)
+		return
+	}
+	if len(n.children) > 0 {
+		v.errorf(n, path, "unexpected nested elements, expected %s", kindName(t))
+		return
+	}
+
+	text := strings.TrimSpace(n.text)
+	if text == "" {
+		if hasRule(s.rules, "required") {
+			v.errorf(n, path, "value is required")
+		}
+		return
+	}
+	var num float64
+	var err error
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(text, 10, t.Bits())
+		num = float64(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, t.Bits())
+		num = float64(u)
+	case reflect.Float32, reflect.Float64:
+		num, err = strconv.ParseFloat(text, t.Bits())
+	case reflect.Bool:
+		_, err = strconv.ParseBool(text)
+	}
+	if err != nil {
+		if nerr, ok := err.(*strconv.NumError); ok && nerr.Err == strconv.ErrRange {
+			v.errorf(n, path, "value %s is out of range of %s", text, kindName(t))
+		} else {
+			v.errorf(n, path, "invalid value %q, expected %s", text, kindName(t))
+		}
+		return
+	}
+
+	for _, rule := range strings.Split(s.rules, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "min":
+			if min, _ := strconv.ParseFloat(parts[1], 64); num < min {
+				v.errorf(n, path, "value %s is less than %s", text, parts[1])
+			}
+		case "max":
+			if max, _ := strconv.ParseFloat(parts[1], 64); num > max {
+				v.errorf(n, path, "value %s is greater than %s", text, parts[1])
+			}
+		case "oneof":
+			allowed := strings.Fields(parts[1])
+			found := false
+			for _, a := range allowed {
+				if a == text {
+					found = true
+					break
+				}
+			}
+			if !found {
+				v.errorf(n, path, "value %q is not one of %s", text, strings.Join(allowed, ", "))
+			}
+		}
+	}
+}
+
+// hasRule returns true if the validation rules contain the rule
+func hasRule(rules, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// indirectPtr returns the type the pointers refer to
+func indirectPtr(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// kindName returns description of the values of the type
+func kindName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return "text"
+}
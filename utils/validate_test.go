@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+type validatedPartition struct {
+	Sequence int    `xml:"sequence" validate:"required,min=1"`
+	Percents int    `xml:"size_percents" validate:"min=0,max=100"`
+	Label    string `xml:"label"`
+}
+
+type validatedDisk struct {
+	Type       string                `xml:"type,attr" validate:"oneof=raw qcow2"`
+	SizeMb     int                   `xml:"size_mb" validate:"required,min=1"`
+	Bootable   bool                  `xml:"bootable"`
+	Partitions []*validatedPartition `xml:"partitions>partition"`
+}
+
+type validatedStorage struct {
+	XMLName xml.Name         `xml:"storage"`
+	Disks   []*validatedDisk `xml:"disk"`
+}
+
+var invalidXML = `<storage>
+  <disk type="vdi">
+    <size_mb>0</size_mb>
+    <bootable>yes</bootable>
+    <partitions>
+      <partition>
+        <size_percents>120</size_percents>
+      </partition>
+      <partition><sequence>2</sequence><lable>SWAP</lable></partition>
+    </partitions>
+  </disk>
+</storage>`
+
+var invalidYAML = `disk:
+  - type: vdi
+    size_mb: 0
+    bootable: yes
+    partitions:
+      partition:
+        - size_percents: 120
+        - sequence: 2
+          lable: SWAP
+`
+
+var invalidJSON = `{"disk": [{"type": "vdi", "size_mb": 0, "bootable": "yes",
+  "partitions": {"partition": [{"size_percents": 120},
+    {"sequence": 2, "lable": "SWAP"}]}}]}`
+
+// location describes the validation error
+type location struct {
+	line int
+	path string
+}
+
+func locations(t *testing.T, err error) []location {
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var locs []location
+	for _, e := range errs {
+		locs = append(locs, location{e.Line, e.Path})
+	}
+	return locs
+}
+
+func TestValidate(t *testing.T) {
+	valid := `<storage><disk type="raw"><size_mb>10</size_mb>
+		<partitions><partition><sequence>1</sequence></partition></partitions></disk></storage>`
+	if err := Validate([]byte(valid), FormatXML, new(validatedStorage)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []location{
+		{2, "storage/disk/type"},
+		{3, "storage/disk/size_mb"},
+		{4, "storage/disk/bootable"},
+		{7, "storage/disk/partitions/partition/size_percents"},
+		{6, "storage/disk/partitions/partition"},
+		{9, "storage/disk/partitions/partition/lable"},
+	}
+	if locs := locations(t, Validate([]byte(invalidXML), FormatXML, new(validatedStorage))); !reflect.DeepEqual(locs, expected) {
+		t.Fatalf("XML: unexpected errors %v", locs)
+	}
+	if locs := locations(t, Validate([]byte(invalidYAML), FormatYAML, new(validatedStorage))); !reflect.DeepEqual(locs, []location{
+		{2, "storage/disk/type"},
+		{3, "storage/disk/size_mb"},
+		{4, "storage/disk/bootable"},
+		{7, "storage/disk/partitions/partition/size_percents"},
+		{7, "storage/disk/partitions/partition"},
+		{9, "storage/disk/partitions/partition/lable"},
+	}) {
+		t.Fatalf("YAML: unexpected errors %v", locs)
+	}
+	errs := Validate([]byte(invalidJSON), FormatJSON, new(validatedStorage)).(ValidationErrors)
+	if len(errs) != 6 || errs[0].Line != 1 || errs[0].Column != 12 || errs[5].Line != 3 || errs[5].Path != "storage/disk/partitions/partition/lable" {
+		t.Fatalf("JSON: unexpected errors %v", errs)
+	}
+
+	for format, data := range map[Format]string{FormatXML: "<storage>\n<disk>", FormatJSON: "{\n\"disk\": [}", FormatYAML: "disk:\n  - [a\n"} {
+		errs, ok := Validate([]byte(data), format, new(validatedStorage)).(ValidationErrors)
+		if !ok || len(errs) != 1 || errs[0].Line == 0 {
+			t.Fatalf("format %d: syntax error is supposed to be located: %v", format, errs)
+		}
+	}
+}